@@ -0,0 +1,263 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"   // RSAES_OAEP_SHA_1 hash // RSAES_OAEP_SHA_1 哈希
+	_ "crypto/sha256" // RSAES_OAEP_SHA_256 hash // RSAES_OAEP_SHA_256 哈希
+	"crypto/x509"
+	"encoding/base64"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// PublicKeyAPI defines the KMS operation used to fetch public keys of asymmetric KMS keys
+//
+// PublicKeyAPI 定义获取非对称 KMS 密钥公钥所使用的 KMS 操作
+type PublicKeyAPI interface {
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+}
+
+var _ PublicKeyAPI = (*kms.Client)(nil)
+
+// EncryptAsymmetric encrypts plaintext with the RSA KMS key using the given RSAES-OAEP algorithm
+// Supports RSA_2048, RSA_3072 and RSA_4096 keys with RSAES_OAEP_SHA_1 and RSAES_OAEP_SHA_256
+// Plaintext is limited by the key size, e.g. 190 bytes on RSA_2048 with RSAES_OAEP_SHA_256
+//
+// EncryptAsymmetric 使用 RSA KMS 密钥和给定的 RSAES-OAEP 算法加密明文
+// 支持 RSA_2048、RSA_3072 和 RSA_4096 密钥，以及 RSAES_OAEP_SHA_1 和 RSAES_OAEP_SHA_256
+// 明文长度受密钥大小限制，例如 RSA_2048 搭配 RSAES_OAEP_SHA_256 时为 190 字节
+func (a *AwsKms) EncryptAsymmetric(plaintext []byte, algorithm types.EncryptionAlgorithmSpec) ([]byte, error) {
+	return a.EncryptAsymmetricContext(context.Background(), plaintext, algorithm)
+}
+
+// EncryptAsymmetricContext encrypts plaintext with the RSA KMS key with the given context
+//
+// EncryptAsymmetricContext 使用给定的上下文通过 RSA KMS 密钥加密明文
+func (a *AwsKms) EncryptAsymmetricContext(ctx context.Context, plaintext []byte, algorithm types.EncryptionAlgorithmSpec) ([]byte, error) {
+	if _, err := rsaOaepHash(algorithm); err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := a.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:               &a.encryptKeyID,
+		Plaintext:           plaintext,
+		EncryptionAlgorithm: algorithm,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res.CiphertextBlob, nil
+}
+
+// DecryptAsymmetric decrypts RSA ciphertext through KMS, the private key never leaves KMS
+// Accepts ciphertext from EncryptAsymmetric and from offline RsaEncrypter alike
+// The algorithm must match the one used at encryption
+//
+// DecryptAsymmetric 通过 KMS 解密 RSA 密文，私钥不会离开 KMS
+// 同样接受来自 EncryptAsymmetric 和离线 RsaEncrypter 的密文
+// 算法必须与加密时使用的一致
+func (a *AwsKms) DecryptAsymmetric(ciphertextBlob []byte, algorithm types.EncryptionAlgorithmSpec) ([]byte, error) {
+	return a.DecryptAsymmetricContext(context.Background(), ciphertextBlob, algorithm)
+}
+
+// DecryptAsymmetricContext decrypts RSA ciphertext through KMS with the given context
+// RSA ciphertext carries no key ID, so the configured encryption ID is sent along
+//
+// DecryptAsymmetricContext 使用给定的上下文通过 KMS 解密 RSA 密文
+// RSA 密文不包含 key ID，因此会一并发送配置的加密 ID
+func (a *AwsKms) DecryptAsymmetricContext(ctx context.Context, ciphertextBlob []byte, algorithm types.EncryptionAlgorithmSpec) ([]byte, error) {
+	if _, err := rsaOaepHash(algorithm); err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := a.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:               &a.encryptKeyID,
+		CiphertextBlob:      ciphertextBlob,
+		EncryptionAlgorithm: algorithm,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res.Plaintext, nil
+}
+
+// EncryptsAsymmetric encrypts plaintext string with the RSA KMS key and returns base64 outcome
+//
+// EncryptsAsymmetric 使用 RSA KMS 密钥加密明文字符串并返回 base64 结果
+func (a *AwsKms) EncryptsAsymmetric(plaintext string, algorithm types.EncryptionAlgorithmSpec) (string, error) {
+	return a.EncryptsAsymmetricContext(context.Background(), plaintext, algorithm)
+}
+
+// EncryptsAsymmetricContext encrypts plaintext string with the RSA KMS key with the given context
+//
+// EncryptsAsymmetricContext 使用给定的上下文通过 RSA KMS 密钥加密明文字符串
+func (a *AwsKms) EncryptsAsymmetricContext(ctx context.Context, plaintext string, algorithm types.EncryptionAlgorithmSpec) (string, error) {
+	ciphertextBlob, err := a.EncryptAsymmetricContext(ctx, []byte(plaintext), algorithm)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertextBlob), nil
+}
+
+// DecryptsAsymmetric decrypts base64 RSA ciphertext through KMS and returns the plaintext string
+//
+// DecryptsAsymmetric 通过 KMS 解密 base64 RSA 密文并返回明文字符串
+func (a *AwsKms) DecryptsAsymmetric(cipherText string, algorithm types.EncryptionAlgorithmSpec) (string, error) {
+	return a.DecryptsAsymmetricContext(context.Background(), cipherText, algorithm)
+}
+
+// DecryptsAsymmetricContext decrypts base64 RSA ciphertext through KMS with the given context
+//
+// DecryptsAsymmetricContext 使用给定的上下文通过 KMS 解密 base64 RSA 密文
+func (a *AwsKms) DecryptsAsymmetricContext(ctx context.Context, cipherText string, algorithm types.EncryptionAlgorithmSpec) (string, error) {
+	ciphertextBlob, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	plaintext, err := a.DecryptAsymmetricContext(ctx, ciphertextBlob, algorithm)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return string(plaintext), nil
+}
+
+// FetchRsaEncrypter fetches the RSA public key via GetPublicKey and returns an offline encrypter
+// The public key is fetched once and kept, so later encryption makes no KMS calls
+//
+// FetchRsaEncrypter 通过 GetPublicKey 获取 RSA 公钥并返回离线加密器
+// 公钥只获取一次并被保存，之后的加密不再调用 KMS
+func (a *AwsKms) FetchRsaEncrypter(algorithm types.EncryptionAlgorithmSpec) (*RsaEncrypter, error) {
+	return a.FetchRsaEncrypterContext(context.Background(), algorithm)
+}
+
+// FetchRsaEncrypterContext fetches the RSA public key with the given context and returns an offline encrypter
+// Checks the key is an ENCRYPT_DECRYPT RSA key which supports the algorithm
+//
+// FetchRsaEncrypterContext 使用给定的上下文获取 RSA 公钥并返回离线加密器
+// 检查密钥是支持该算法的 ENCRYPT_DECRYPT 用途 RSA 密钥
+func (a *AwsKms) FetchRsaEncrypterContext(ctx context.Context, algorithm types.EncryptionAlgorithmSpec) (*RsaEncrypter, error) {
+	client, err := clientAs[PublicKeyAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: &a.encryptKeyID,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if res.KeyUsage != types.KeyUsageTypeEncryptDecrypt {
+		return nil, erero.Errorf("key usage %s is not ENCRYPT_DECRYPT", res.KeyUsage)
+	}
+	if !slices.Contains(res.EncryptionAlgorithms, algorithm) {
+		return nil, erero.Errorf("key does not support encryption algorithm %s", algorithm)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, erero.Errorf("key spec %s is not an RSA key", res.KeySpec)
+	}
+	encrypter, err := NewRsaEncrypter(rsaPublicKey, algorithm)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	encrypter.keyID = aws.ToString(res.KeyId)
+	return encrypter, nil
+}
+
+// RsaEncrypter encrypts locally with a KMS RSA public key using crypto/rsa
+// Suits untrusted edge services: they encrypt without KMS access and only the backend decrypts via KMS
+// Safe in concurrent use across goroutines
+//
+// RsaEncrypter 使用 KMS RSA 公钥通过 crypto/rsa 在本地加密
+// 适用于不受信任的边缘服务：无需 KMS 权限即可加密，只有后端通过 KMS 解密
+// 可在多个 goroutine 中并发使用
+type RsaEncrypter struct {
+	publicKey *rsa.PublicKey                // RSA public key of the KMS key // KMS 密钥的 RSA 公钥
+	algorithm types.EncryptionAlgorithmSpec // RSAES-OAEP algorithm in use // 使用的 RSAES-OAEP 算法
+	hash      crypto.Hash                   // OAEP and MGF1 hash of the algorithm // 算法对应的 OAEP 和 MGF1 哈希
+	keyID     string                        // Key ARN when fetched from KMS // 从 KMS 获取时的密钥 ARN
+}
+
+// NewRsaEncrypter creates RsaEncrypter from a public key distributed out of band, e.g. as PEM
+// Use AwsKms.FetchRsaEncrypter when the public key should come from KMS GetPublicKey
+//
+// NewRsaEncrypter 使用通过其它渠道分发（例如 PEM）的公钥创建 RsaEncrypter
+// 需要从 KMS GetPublicKey 获取公钥时使用 AwsKms.FetchRsaEncrypter
+func NewRsaEncrypter(publicKey *rsa.PublicKey, algorithm types.EncryptionAlgorithmSpec) (*RsaEncrypter, error) {
+	hash, err := rsaOaepHash(algorithm)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &RsaEncrypter{
+		publicKey: must.Nice(publicKey),
+		algorithm: algorithm,
+		hash:      hash,
+	}, nil
+}
+
+// Encrypt encrypts plaintext locally, producing ciphertext that AwsKms.DecryptAsymmetric decrypts
+//
+// Encrypt 在本地加密明文，生成的密文可以由 AwsKms.DecryptAsymmetric 解密
+func (e *RsaEncrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	ciphertext, err := rsa.EncryptOAEP(e.hash.New(), rand.Reader, e.publicKey, plaintext, nil)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return ciphertext, nil
+}
+
+// Encrypts encrypts plaintext string locally and returns base64 outcome, decryptable with AwsKms.DecryptsAsymmetric
+//
+// Encrypts 在本地加密明文字符串并返回 base64 结果，可以使用 AwsKms.DecryptsAsymmetric 解密
+func (e *RsaEncrypter) Encrypts(plaintext string) (string, error) {
+	ciphertext, err := e.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// PublicKey returns the RSA public key in use
+//
+// PublicKey 返回使用的 RSA 公钥
+func (e *RsaEncrypter) PublicKey() *rsa.PublicKey {
+	return e.publicKey
+}
+
+// Algorithm returns the RSAES-OAEP algorithm in use
+//
+// Algorithm 返回使用的 RSAES-OAEP 算法
+func (e *RsaEncrypter) Algorithm() types.EncryptionAlgorithmSpec {
+	return e.algorithm
+}
+
+// KeyID returns the KMS key ARN when fetched from KMS, otherwise empty
+//
+// KeyID 从 KMS 获取时返回 KMS 密钥 ARN，否则为空
+func (e *RsaEncrypter) KeyID() string {
+	return e.keyID
+}
+
+// rsaOaepHash returns the hash of the RSAES-OAEP algorithm, KMS uses the same hash in MGF1
+//
+// rsaOaepHash 返回 RSAES-OAEP 算法的哈希，KMS 在 MGF1 中使用相同的哈希
+func rsaOaepHash(algorithm types.EncryptionAlgorithmSpec) (crypto.Hash, error) {
+	switch algorithm {
+	case types.EncryptionAlgorithmSpecRsaesOaepSha1:
+		return crypto.SHA1, nil
+	case types.EncryptionAlgorithmSpecRsaesOaepSha256:
+		return crypto.SHA256, nil
+	default:
+		return 0, erero.Errorf("encryption algorithm %q is not an RSAES-OAEP algorithm", algorithm)
+	}
+}
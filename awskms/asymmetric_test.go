@@ -0,0 +1,113 @@
+package awskms_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeRsaAwsKms creates AwsKms backed by FakeKms with one RSA_2048 encryption key
+//
+// newFakeRsaAwsKms 创建基于 FakeKms 和一个 RSA_2048 加密密钥的 AwsKms
+func newFakeRsaAwsKms(t *testing.T) (*awskms.AwsKms, *awskmstest.FakeKms) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt)
+	return awskms.NewAwsKms(fake, keyID), fake
+}
+
+// TestAwsKms_EncryptAsymmetric tests RSA encryption through KMS with both OAEP algorithms
+//
+// TestAwsKms_EncryptAsymmetric 测试使用两种 OAEP 算法通过 KMS 进行 RSA 加密
+func TestAwsKms_EncryptAsymmetric(t *testing.T) {
+	awsKms, _ := newFakeRsaAwsKms(t)
+
+	for _, algorithm := range []types.EncryptionAlgorithmSpec{
+		types.EncryptionAlgorithmSpecRsaesOaepSha1,
+		types.EncryptionAlgorithmSpecRsaesOaepSha256,
+	} {
+		ciphertext, err := awsKms.EncryptAsymmetric([]byte("test message"), algorithm)
+		require.NoError(t, err)
+		require.Len(t, ciphertext, 256)
+
+		plaintext, err := awsKms.DecryptAsymmetric(ciphertext, algorithm)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	}
+
+	cipherText, err := awsKms.EncryptsAsymmetric("test message", types.EncryptionAlgorithmSpecRsaesOaepSha256)
+	require.NoError(t, err)
+
+	res, err := awsKms.DecryptsAsymmetric(cipherText, types.EncryptionAlgorithmSpecRsaesOaepSha256)
+	require.NoError(t, err)
+	require.Equal(t, "test message", res)
+
+	t.Run("WrongAlgorithm", func(t *testing.T) {
+		ciphertext, err := awsKms.EncryptAsymmetric([]byte("test message"), types.EncryptionAlgorithmSpecRsaesOaepSha1)
+		require.NoError(t, err)
+
+		_, err = awsKms.DecryptAsymmetric(ciphertext, types.EncryptionAlgorithmSpecRsaesOaepSha256)
+		require.Error(t, err)
+	})
+
+	t.Run("NotOaep", func(t *testing.T) {
+		_, err := awsKms.EncryptAsymmetric([]byte("test message"), types.EncryptionAlgorithmSpecSymmetricDefault)
+		require.Error(t, err)
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		_, err := awsKms.EncryptAsymmetric(bytes.Repeat([]byte("x"), 191), types.EncryptionAlgorithmSpecRsaesOaepSha256)
+		require.Error(t, err)
+	})
+
+	t.Run("SymmetricEncryptFails", func(t *testing.T) {
+		_, err := awsKms.Encrypt([]byte("test message"))
+		require.Error(t, err)
+	})
+}
+
+// TestAwsKms_FetchRsaEncrypter tests offline encryption with the fetched public key and KMS decryption
+//
+// TestAwsKms_FetchRsaEncrypter 测试使用获取的公钥离线加密并通过 KMS 解密
+func TestAwsKms_FetchRsaEncrypter(t *testing.T) {
+	awsKms, fake := newFakeRsaAwsKms(t)
+
+	encrypter, err := awsKms.FetchRsaEncrypter(types.EncryptionAlgorithmSpecRsaesOaepSha256)
+	require.NoError(t, err)
+	require.Equal(t, 2048, encrypter.PublicKey().N.BitLen())
+	require.Contains(t, encrypter.KeyID(), "arn:aws:kms:")
+
+	// the edge service only holds the public key, nothing reaches KMS when encrypting // 边缘服务只持有公钥，加密时不访问 KMS
+	fake.FailNext(1, &types.KMSInternalException{})
+	ciphertext, err := encrypter.Encrypt([]byte("test message"))
+	require.NoError(t, err)
+	_, err = awsKms.DecryptAsymmetric(ciphertext, types.EncryptionAlgorithmSpecRsaesOaepSha256)
+	require.Error(t, err) // consumes the injected fault // 消耗注入的错误
+
+	plaintext, err := awsKms.DecryptAsymmetric(ciphertext, types.EncryptionAlgorithmSpecRsaesOaepSha256)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	offline, err := awskms.NewRsaEncrypter(encrypter.PublicKey(), types.EncryptionAlgorithmSpecRsaesOaepSha1)
+	require.NoError(t, err)
+	cipherText, err := offline.Encrypts("test message")
+	require.NoError(t, err)
+
+	res, err := awsKms.DecryptsAsymmetric(cipherText, types.EncryptionAlgorithmSpecRsaesOaepSha1)
+	require.NoError(t, err)
+	require.Equal(t, "test message", res)
+
+	t.Run("SymmetricKey", func(t *testing.T) {
+		symmetricKms, _ := newFakeAwsKms(t)
+		_, err := symmetricKms.FetchRsaEncrypter(types.EncryptionAlgorithmSpecRsaesOaepSha256)
+		require.Error(t, err)
+	})
+
+	t.Run("NotOaep", func(t *testing.T) {
+		_, err := awskms.NewRsaEncrypter(encrypter.PublicKey(), types.EncryptionAlgorithmSpecSymmetricDefault)
+		require.Error(t, err)
+	})
+}
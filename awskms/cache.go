@@ -0,0 +1,458 @@
+package awskms
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// CacheOptions defines the limits of data key reuse in CachedAwsKms
+// A cached encryption data key is replaced once any one of the limits is reached
+// Supports chain configuration pattern like EnvOptions
+//
+// CacheOptions 定义 CachedAwsKms 中数据密钥复用的限制
+// 任意一个限制达到后缓存的加密数据密钥就会被替换
+// 与 EnvOptions 一样支持链式配置模式
+type CacheOptions struct {
+	MaxMessages       int           // Messages encrypted with one data key // 单个数据密钥可加密的消息数
+	MaxBytes          int64         // Plaintext bytes encrypted with one data key, larger messages skip the cache // 单个数据密钥可加密的明文字节数，更大的消息不使用缓存
+	MaxAge            time.Duration // Lifetime of cached data keys // 缓存数据密钥的存活时间
+	MaxEncryptEntries int           // Encryption data keys kept, one per encryption context // 保留的加密数据密钥数，每个加密上下文一个
+	MaxDecryptEntries int           // Unwrapped data keys kept in the decrypt cache // 解密缓存中保留的已解包数据密钥数
+}
+
+// NewCacheOptions creates CacheOptions with conservative defaults
+// Defaults: 1000 messages, 1 GiB, 5 minutes, 100 encrypt entries, 1000 decrypt entries
+//
+// NewCacheOptions 创建使用保守默认值的 CacheOptions
+// 默认值：1000 条消息、1 GiB、5 分钟、100 个加密缓存项、1000 个解密缓存项
+func NewCacheOptions() *CacheOptions {
+	return &CacheOptions{
+		MaxMessages:       1000,
+		MaxBytes:          1 << 30,
+		MaxAge:            5 * time.Minute,
+		MaxEncryptEntries: 100,
+		MaxDecryptEntries: 1000,
+	}
+}
+
+// WithMaxMessages sets the number of messages encrypted with one data key
+// Returns self in method chaining
+//
+// WithMaxMessages 设置单个数据密钥可加密的消息数
+// 返回自身以支持链式调用
+func (op *CacheOptions) WithMaxMessages(maxMessages int) *CacheOptions {
+	op.MaxMessages = maxMessages
+	return op
+}
+
+// WithMaxBytes sets the plaintext bytes encrypted with one data key
+// A message larger than maxBytes gets a fresh data key of its own and leaves the cache untouched
+// Returns self in method chaining
+//
+// WithMaxBytes 设置单个数据密钥可加密的明文字节数
+// 大于 maxBytes 的消息使用单独生成的新数据密钥，不影响缓存
+// 返回自身以支持链式调用
+func (op *CacheOptions) WithMaxBytes(maxBytes int64) *CacheOptions {
+	op.MaxBytes = maxBytes
+	return op
+}
+
+// WithMaxAge sets the lifetime of cached data keys
+// Returns self in method chaining
+//
+// WithMaxAge 设置缓存数据密钥的存活时间
+// 返回自身以支持链式调用
+func (op *CacheOptions) WithMaxAge(maxAge time.Duration) *CacheOptions {
+	op.MaxAge = maxAge
+	return op
+}
+
+// WithMaxEncryptEntries sets the number of encryption data keys kept, one per encryption context
+// Returns self in method chaining
+//
+// WithMaxEncryptEntries 设置保留的加密数据密钥数，每个加密上下文一个
+// 返回自身以支持链式调用
+func (op *CacheOptions) WithMaxEncryptEntries(maxEncryptEntries int) *CacheOptions {
+	op.MaxEncryptEntries = maxEncryptEntries
+	return op
+}
+
+// WithMaxDecryptEntries sets the number of unwrapped data keys kept in the decrypt cache
+// Returns self in method chaining
+//
+// WithMaxDecryptEntries 设置解密缓存中保留的已解包数据密钥数
+// 返回自身以支持链式调用
+func (op *CacheOptions) WithMaxDecryptEntries(maxDecryptEntries int) *CacheOptions {
+	op.MaxDecryptEntries = maxDecryptEntries
+	return op
+}
+
+// CacheStats is a snapshot of CachedAwsKms counters
+//
+// CacheStats 是 CachedAwsKms 计数器的快照
+type CacheStats struct {
+	EncryptHits   int64 // Encryptions served by a cached data key // 由缓存数据密钥完成的加密次数
+	EncryptMisses int64 // Encryptions that generated a new data key // 生成新数据密钥的加密次数
+	DecryptHits   int64 // Decryptions served by a cached data key // 由缓存数据密钥完成的解密次数
+	DecryptMisses int64 // Decryptions that unwrapped the data key via KMS // 通过 KMS 解包数据密钥的解密次数
+	Evictions     int64 // Cached data keys zeroed and dropped // 被清零并丢弃的缓存数据密钥数
+}
+
+// EncryptHitRate returns the share of encryptions served from cache, 0 when there is none
+//
+// EncryptHitRate 返回由缓存完成的加密占比，没有加密时返回 0
+func (s CacheStats) EncryptHitRate() float64 {
+	return hitRate(s.EncryptHits, s.EncryptMisses)
+}
+
+// DecryptHitRate returns the share of decryptions served from cache, 0 when there is none
+//
+// DecryptHitRate 返回由缓存完成的解密占比，没有解密时返回 0
+func (s CacheStats) DecryptHitRate() float64 {
+	return hitRate(s.DecryptHits, s.DecryptMisses)
+}
+
+func hitRate(hits int64, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// CachedAwsKms wraps AwsKms with envelope encryption reusing cached data keys
+// Encryption reuses one generated data key until a CacheOptions limit is reached
+// Decryption caches unwrapped data keys keyed by the encryption context and wrapped key blob
+// Including the context in cache keys keeps the KMS context check from being bypassed by a hit
+// Blobs are the same format as AwsKms.EncryptEnvelope and decrypt with either type
+//
+// CachedAwsKms 为 AwsKms 包装复用缓存数据密钥的信封加密
+// 加密时复用同一个生成的数据密钥，直到达到 CacheOptions 中的限制
+// 解密时按加密上下文和被包装的密钥块缓存已解包的数据密钥
+// 缓存键包含加密上下文，避免缓存命中绕过 KMS 的上下文校验
+// 密文块格式与 AwsKms.EncryptEnvelope 相同，两种类型都可以解密
+type CachedAwsKms struct {
+	awsKms       *AwsKms                   // Underlying KMS operations // 底层 KMS 操作
+	options      *CacheOptions             // Data key reuse limits // 数据密钥复用限制
+	encryptMutex sync.Mutex                // Guards encryptKeys // 保护 encryptKeys
+	encryptKeys  map[string]*cachedDataKey // Current encryption data keys by context // 按加密上下文索引的当前加密数据密钥
+	decryptMutex sync.Mutex                // Guards decryptKeys and decryptLRU // 保护 decryptKeys 和 decryptLRU
+	decryptKeys  map[string]*list.Element  // Decrypt cache entries by wrapped key // 按被包装密钥索引的解密缓存项
+	decryptLRU   *list.List                // Decrypt cache entries, most recent first // 解密缓存项，最近使用的在前
+	stats        cacheCounters             // Hit and miss counters // 命中和未命中计数器
+}
+
+// cachedDataKey is one cached data key with its usage counters
+//
+// cachedDataKey 是带有使用计数的单个缓存数据密钥
+type cachedDataKey struct {
+	cacheKey   string    // Key of this entry in the cache map // 该缓存项在 map 中的键
+	plaintext  []byte    // Unwrapped data key, zeroed on eviction // 已解包的数据密钥，淘汰时清零
+	wrappedKey []byte    // Data key encrypted by KMS // 由 KMS 加密的数据密钥
+	createdAt  time.Time // When the data key was cached // 数据密钥缓存的时间
+	messages   int       // Messages encrypted so far // 已加密的消息数
+	bytes      int64     // Plaintext bytes encrypted so far // 已加密的明文字节数
+}
+
+type cacheCounters struct {
+	encryptHits   atomic.Int64
+	encryptMisses atomic.Int64
+	decryptHits   atomic.Int64
+	decryptMisses atomic.Int64
+	evictions     atomic.Int64
+}
+
+// NewCachedAwsKms creates CachedAwsKms on top of awsKms with the given limits
+// Limits must be positive, and MaxMessages must stay within the AES-GCM random nonce bound
+//
+// NewCachedAwsKms 基于 awsKms 使用给定限制创建 CachedAwsKms
+// 各项限制必须为正数，且 MaxMessages 不能超过 AES-GCM 随机 nonce 的安全上限
+func NewCachedAwsKms(awsKms *AwsKms, options *CacheOptions) *CachedAwsKms {
+	must.Full(awsKms)
+	must.Full(options)
+	must.True(options.MaxMessages > 0 && int64(options.MaxMessages) <= 1<<32)
+	must.True(options.MaxBytes > 0)
+	must.True(options.MaxAge > 0)
+	must.True(options.MaxEncryptEntries > 0)
+	must.True(options.MaxDecryptEntries > 0)
+	return &CachedAwsKms{
+		awsKms:      awsKms,
+		options:     options,
+		encryptKeys: map[string]*cachedDataKey{},
+		decryptKeys: map[string]*list.Element{},
+		decryptLRU:  list.New(),
+	}
+}
+
+// EncryptEnvelope encrypts plaintext using envelope encryption with a cached data key
+//
+// EncryptEnvelope 使用缓存的数据密钥以信封加密方式加密明文
+func (c *CachedAwsKms) EncryptEnvelope(plaintext []byte) ([]byte, error) {
+	return c.EncryptEnvelopeContext(context.Background(), plaintext)
+}
+
+// EncryptEnvelopeContext encrypts plaintext with a cached data key, generating one via KMS when needed
+// The data key is replaced once it reaches MaxMessages, MaxBytes or MaxAge
+// Plaintext larger than MaxBytes bypasses the cache and is counted as a miss
+//
+// EncryptEnvelopeContext 使用缓存的数据密钥加密明文，需要时通过 KMS 生成新的数据密钥
+// 数据密钥达到 MaxMessages、MaxBytes 或 MaxAge 后会被替换
+// 大于 MaxBytes 的明文不使用缓存，并计为一次未命中
+func (c *CachedAwsKms) EncryptEnvelopeContext(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return c.EncryptEnvelopeWithEncryptionContext(ctx, plaintext, nil)
+}
+
+// EncryptEnvelopeWithEncryptionContext encrypts plaintext with the cached data key of the encryption context
+// Each distinct context has its own data key, generated via KMS with that context
+//
+// EncryptEnvelopeWithEncryptionContext 使用该加密上下文对应的缓存数据密钥加密明文
+// 每个不同的上下文有各自的数据密钥，并使用该上下文通过 KMS 生成
+func (c *CachedAwsKms) EncryptEnvelopeWithEncryptionContext(ctx context.Context, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	dataKey, wrappedKey, err := c.takeEncryptKey(ctx, int64(len(plaintext)), encryptionContext)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(dataKey)
+
+	return sealEnvelope([]byte(envelopePrefixV1), dataKey, wrappedKey, plaintext)
+}
+
+// DecryptEnvelope decrypts an envelope blob using a cached unwrapped data key when present
+//
+// DecryptEnvelope 存在缓存的已解包数据密钥时使用它解密信封密文块
+func (c *CachedAwsKms) DecryptEnvelope(envelopeBlob []byte) ([]byte, error) {
+	return c.DecryptEnvelopeContext(context.Background(), envelopeBlob)
+}
+
+// DecryptEnvelopeContext decrypts an envelope blob, unwrapping the data key via KMS on cache miss
+//
+// DecryptEnvelopeContext 解密信封密文块，缓存未命中时通过 KMS 解包数据密钥
+func (c *CachedAwsKms) DecryptEnvelopeContext(ctx context.Context, envelopeBlob []byte) ([]byte, error) {
+	return c.DecryptEnvelopeWithEncryptionContext(ctx, envelopeBlob, nil)
+}
+
+// DecryptEnvelopeWithEncryptionContext decrypts an envelope blob expecting the given encryption context
+// Cache hits require the same context, so a wrong context still goes to KMS and gets rejected
+//
+// DecryptEnvelopeWithEncryptionContext 使用期望的加密上下文解密信封密文块
+// 缓存命中要求上下文相同，因此错误的上下文仍会发送到 KMS 并被拒绝
+func (c *CachedAwsKms) DecryptEnvelopeWithEncryptionContext(ctx context.Context, envelopeBlob []byte, encryptionContext map[string]string) ([]byte, error) {
+	envelope, err := parseEnvelope(envelopeBlob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	dataKey, err := c.takeDecryptKey(ctx, envelope.wrappedKey, encryptionContext)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(dataKey)
+
+	return envelope.open(dataKey)
+}
+
+// Stats returns a snapshot of cache hit, miss and eviction counters
+//
+// Stats 返回缓存命中、未命中和淘汰计数器的快照
+func (c *CachedAwsKms) Stats() CacheStats {
+	return CacheStats{
+		EncryptHits:   c.stats.encryptHits.Load(),
+		EncryptMisses: c.stats.encryptMisses.Load(),
+		DecryptHits:   c.stats.decryptHits.Load(),
+		DecryptMisses: c.stats.decryptMisses.Load(),
+		Evictions:     c.stats.evictions.Load(),
+	}
+}
+
+// Purge zeroes and drops every cached data key
+//
+// Purge 清零并丢弃所有缓存的数据密钥
+func (c *CachedAwsKms) Purge() {
+	c.encryptMutex.Lock()
+	for _, entry := range c.encryptKeys {
+		c.removeEncryptEntry(entry)
+	}
+	c.encryptMutex.Unlock()
+
+	c.decryptMutex.Lock()
+	for c.decryptLRU.Len() > 0 {
+		c.removeDecryptEntry(c.decryptLRU.Back())
+	}
+	c.decryptMutex.Unlock()
+}
+
+// takeEncryptKey returns a copy of the usable encryption data key, replacing it when exhausted
+// The copy lets callers use the key after the cached one has been zeroed by eviction
+// A size above MaxBytes could never share its key, so it gets an uncached key and the cached one stays
+// KMS is called outside the lock so a slow GenerateDataKey does not block hits of other contexts
+//
+// takeEncryptKey 返回可用加密数据密钥的副本，密钥用尽时替换
+// 使用副本使调用方在缓存的密钥被淘汰清零后仍可使用
+// 超过 MaxBytes 的大小无法共享密钥，因此使用不缓存的密钥，已缓存的密钥保持不变
+// 在锁外调用 KMS，避免较慢的 GenerateDataKey 阻塞其它上下文的缓存命中
+func (c *CachedAwsKms) takeEncryptKey(ctx context.Context, size int64, encryptionContext map[string]string) ([]byte, []byte, error) {
+	if size > c.options.MaxBytes {
+		res, err := c.generateDataKey(ctx, encryptionContext)
+		if err != nil {
+			return nil, nil, erero.Wro(err)
+		}
+		c.stats.encryptMisses.Add(1)
+		return res.Plaintext, res.CiphertextBlob, nil
+	}
+	cacheKey := encryptionContextKey(encryptionContext)
+
+	c.encryptMutex.Lock()
+	if entry, exists := c.encryptKeys[cacheKey]; exists {
+		if entry.messages < c.options.MaxMessages && entry.bytes+size <= c.options.MaxBytes && time.Since(entry.createdAt) < c.options.MaxAge {
+			entry.messages++
+			entry.bytes += size
+			c.stats.encryptHits.Add(1)
+			dataKey, wrappedKey := bytes.Clone(entry.plaintext), entry.wrappedKey
+			c.encryptMutex.Unlock()
+			return dataKey, wrappedKey, nil
+		}
+		c.removeEncryptEntry(entry)
+	}
+	c.encryptMutex.Unlock()
+
+	res, err := c.generateDataKey(ctx, encryptionContext)
+	if err != nil {
+		return nil, nil, erero.Wro(err)
+	}
+	c.stats.encryptMisses.Add(1)
+	dataKey := bytes.Clone(res.Plaintext)
+
+	c.encryptMutex.Lock()
+	defer c.encryptMutex.Unlock()
+	if entry, exists := c.encryptKeys[cacheKey]; exists {
+		c.removeEncryptEntry(entry) // replaced by a concurrent miss // 被并发的未命中替换
+	}
+	for len(c.encryptKeys) >= c.options.MaxEncryptEntries {
+		c.removeEncryptEntry(c.oldestEncryptEntry())
+	}
+	c.encryptKeys[cacheKey] = &cachedDataKey{
+		cacheKey:   cacheKey,
+		plaintext:  res.Plaintext,
+		wrappedKey: res.CiphertextBlob,
+		createdAt:  time.Now(),
+		messages:   1,
+		bytes:      size,
+	}
+	return dataKey, res.CiphertextBlob, nil
+}
+
+// generateDataKey generates an AES-256 data key bound to the encryption context via KMS GenerateDataKey
+//
+// generateDataKey 通过 KMS GenerateDataKey 生成绑定加密上下文的 AES-256 数据密钥
+func (c *CachedAwsKms) generateDataKey(ctx context.Context, encryptionContext map[string]string) (*kms.GenerateDataKeyOutput, error) {
+	client, err := clientAs[DataKeyAPI](c.awsKms.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             &c.awsKms.encryptKeyID,
+		KeySpec:           types.DataKeySpecAes256,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res, nil
+}
+
+// takeDecryptKey returns a copy of the unwrapped data key, calling KMS Decrypt on cache miss
+// KMS is called outside the lock so slow unwraps do not block cache hits
+//
+// takeDecryptKey 返回已解包数据密钥的副本，缓存未命中时调用 KMS Decrypt
+// 在锁外调用 KMS，避免较慢的解包阻塞缓存命中
+func (c *CachedAwsKms) takeDecryptKey(ctx context.Context, wrappedKey []byte, encryptionContext map[string]string) ([]byte, error) {
+	cacheKey := encryptionContextKey(encryptionContext) + string(wrappedKey)
+
+	c.decryptMutex.Lock()
+	if element, exists := c.decryptKeys[cacheKey]; exists {
+		entry := element.Value.(*cachedDataKey)
+		if time.Since(entry.createdAt) < c.options.MaxAge {
+			c.decryptLRU.MoveToFront(element)
+			c.stats.decryptHits.Add(1)
+			dataKey := bytes.Clone(entry.plaintext)
+			c.decryptMutex.Unlock()
+			return dataKey, nil
+		}
+		c.removeDecryptEntry(element)
+	}
+	c.decryptMutex.Unlock()
+
+	res, err := c.awsKms.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    wrappedKey,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	c.stats.decryptMisses.Add(1)
+	dataKey := bytes.Clone(res.Plaintext)
+
+	c.decryptMutex.Lock()
+	defer c.decryptMutex.Unlock()
+	if element, exists := c.decryptKeys[cacheKey]; exists {
+		c.removeDecryptEntry(element) // replaced by a concurrent miss // 被并发的未命中替换
+	}
+	c.decryptKeys[cacheKey] = c.decryptLRU.PushFront(&cachedDataKey{
+		cacheKey:   cacheKey,
+		plaintext:  res.Plaintext,
+		wrappedKey: bytes.Clone(wrappedKey),
+		createdAt:  time.Now(),
+	})
+	for c.decryptLRU.Len() > c.options.MaxDecryptEntries {
+		c.removeDecryptEntry(c.decryptLRU.Back())
+	}
+	return dataKey, nil
+}
+
+// removeDecryptEntry drops one decrypt cache entry and zeroes its data key
+// Caller must hold decryptMutex
+//
+// removeDecryptEntry 删除一个解密缓存项并清零其数据密钥
+// 调用方必须持有 decryptMutex
+func (c *CachedAwsKms) removeDecryptEntry(element *list.Element) {
+	entry := c.decryptLRU.Remove(element).(*cachedDataKey)
+	delete(c.decryptKeys, entry.cacheKey)
+	c.evict(entry)
+}
+
+// removeEncryptEntry drops one encryption data key and zeroes it
+// Caller must hold encryptMutex
+//
+// removeEncryptEntry 删除一个加密数据密钥并将其清零
+// 调用方必须持有 encryptMutex
+func (c *CachedAwsKms) removeEncryptEntry(entry *cachedDataKey) {
+	delete(c.encryptKeys, entry.cacheKey)
+	c.evict(entry)
+}
+
+// oldestEncryptEntry returns the encryption data key created first
+// Caller must hold encryptMutex
+//
+// oldestEncryptEntry 返回最早创建的加密数据密钥
+// 调用方必须持有 encryptMutex
+func (c *CachedAwsKms) oldestEncryptEntry() *cachedDataKey {
+	var oldest *cachedDataKey
+	for _, entry := range c.encryptKeys {
+		if oldest == nil || entry.createdAt.Before(oldest.createdAt) {
+			oldest = entry
+		}
+	}
+	return oldest
+}
+
+func (c *CachedAwsKms) evict(entry *cachedDataKey) {
+	clear(entry.plaintext)
+	c.stats.evictions.Add(1)
+}
@@ -0,0 +1,191 @@
+package awskms_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFakeKms wraps FakeKms and counts GenerateDataKey calls
+//
+// countingFakeKms 包装 FakeKms 并统计 GenerateDataKey 调用次数
+type countingFakeKms struct {
+	*awskmstest.FakeKms
+	generateDataKeyCalls atomic.Int64
+}
+
+func (c *countingFakeKms) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	c.generateDataKeyCalls.Add(1)
+	return c.FakeKms.GenerateDataKey(ctx, params, optFns...)
+}
+
+// blockingFakeKms wraps FakeKms and holds GenerateDataKey calls carrying an encryption context until release is closed
+//
+// blockingFakeKms 包装 FakeKms，带加密上下文的 GenerateDataKey 调用会一直等待到 release 被关闭
+type blockingFakeKms struct {
+	*awskmstest.FakeKms
+	release chan struct{}
+	blocked atomic.Bool
+}
+
+func (b *blockingFakeKms) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	if len(params.EncryptionContext) > 0 {
+		b.blocked.Store(true)
+		<-b.release
+	}
+	return b.FakeKms.GenerateDataKey(ctx, params, optFns...)
+}
+
+// TestCachedAwsKms_EncryptEnvelope tests data key reuse limits by messages, bytes and age
+//
+// TestCachedAwsKms_EncryptEnvelope 测试按消息数、字节数和时间限制数据密钥复用
+func TestCachedAwsKms_EncryptEnvelope(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+
+	t.Run("MaxMessages", func(t *testing.T) {
+		cached := awskms.NewCachedAwsKms(awsKms, awskms.NewCacheOptions().WithMaxMessages(3))
+		for i := 0; i < 7; i++ {
+			_, err := cached.EncryptEnvelope([]byte("test message"))
+			require.NoError(t, err)
+		}
+		stats := cached.Stats()
+		require.EqualValues(t, 3, stats.EncryptMisses)
+		require.EqualValues(t, 4, stats.EncryptHits)
+		require.EqualValues(t, 2, stats.Evictions)
+		require.InDelta(t, 4.0/7.0, stats.EncryptHitRate(), 1e-9)
+	})
+
+	t.Run("MaxBytes", func(t *testing.T) {
+		cached := awskms.NewCachedAwsKms(awsKms, awskms.NewCacheOptions().WithMaxBytes(100))
+		for i := 0; i < 3; i++ {
+			_, err := cached.EncryptEnvelope(make([]byte, 60))
+			require.NoError(t, err)
+		}
+		require.EqualValues(t, 3, cached.Stats().EncryptMisses)
+	})
+
+	t.Run("Oversized", func(t *testing.T) {
+		fake := &countingFakeKms{FakeKms: awskmstest.NewFakeKms()}
+		keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+		cached := awskms.NewCachedAwsKms(awskms.NewAwsKms(fake, keyID), awskms.NewCacheOptions().WithMaxBytes(100))
+
+		_, err := cached.EncryptEnvelope([]byte("small"))
+		require.NoError(t, err)
+		require.EqualValues(t, 1, fake.generateDataKeyCalls.Load())
+
+		// each oversized message gets its own data key // 每条超大消息使用各自的数据密钥
+		for i := 0; i < 3; i++ {
+			blob, err := cached.EncryptEnvelope(make([]byte, 101))
+			require.NoError(t, err)
+			plaintext, err := cached.DecryptEnvelope(blob)
+			require.NoError(t, err)
+			require.Len(t, plaintext, 101)
+		}
+		require.EqualValues(t, 4, fake.generateDataKeyCalls.Load())
+
+		// the cached data key of small messages is still in use // 小消息的缓存数据密钥仍在使用
+		_, err = cached.EncryptEnvelope([]byte("small"))
+		require.NoError(t, err)
+		require.EqualValues(t, 4, fake.generateDataKeyCalls.Load())
+
+		stats := cached.Stats()
+		require.EqualValues(t, 4, stats.EncryptMisses)
+		require.EqualValues(t, 1, stats.EncryptHits)
+		require.Zero(t, stats.Evictions)
+	})
+
+	t.Run("MaxAge", func(t *testing.T) {
+		cached := awskms.NewCachedAwsKms(awsKms, awskms.NewCacheOptions().WithMaxAge(50*time.Millisecond))
+		_, err := cached.EncryptEnvelope([]byte("first"))
+		require.NoError(t, err)
+		_, err = cached.EncryptEnvelope([]byte("second"))
+		require.NoError(t, err)
+		time.Sleep(80 * time.Millisecond)
+		_, err = cached.EncryptEnvelope([]byte("third"))
+		require.NoError(t, err)
+
+		stats := cached.Stats()
+		require.EqualValues(t, 2, stats.EncryptMisses)
+		require.EqualValues(t, 1, stats.EncryptHits)
+	})
+
+	t.Run("SlowMiss", func(t *testing.T) {
+		fake := &blockingFakeKms{FakeKms: awskmstest.NewFakeKms(), release: make(chan struct{})}
+		keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+		cached := awskms.NewCachedAwsKms(awskms.NewAwsKms(fake, keyID), awskms.NewCacheOptions())
+		ctx := context.Background()
+
+		_, err := cached.EncryptEnvelope([]byte("warm up"))
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := cached.EncryptEnvelopeWithEncryptionContext(ctx, []byte("slow"), map[string]string{"tenant": "slow"})
+			done <- err
+		}()
+
+		// a hit of another context is served while the slow GenerateDataKey is pending // 慢的 GenerateDataKey 未完成时，其它上下文的命中照常完成
+		require.Eventually(t, func() bool { return fake.blocked.Load() }, time.Second, time.Millisecond)
+		_, err = cached.EncryptEnvelope([]byte("fast"))
+		require.NoError(t, err)
+		require.EqualValues(t, 1, cached.Stats().EncryptHits)
+
+		close(fake.release)
+		require.NoError(t, <-done)
+	})
+}
+
+// TestCachedAwsKms_DecryptEnvelope tests the decrypt cache, its eviction and blob compatibility with AwsKms
+//
+// TestCachedAwsKms_DecryptEnvelope 测试解密缓存、缓存淘汰以及与 AwsKms 的密文块兼容性
+func TestCachedAwsKms_DecryptEnvelope(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+	cached := awskms.NewCachedAwsKms(awsKms, awskms.NewCacheOptions().WithMaxDecryptEntries(2))
+
+	blob, err := cached.EncryptEnvelope([]byte("test message"))
+	require.NoError(t, err)
+
+	plaintext, err := awsKms.DecryptEnvelope(blob)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	var blobs [][]byte
+	for i := 0; i < 3; i++ {
+		blob, err := awsKms.EncryptEnvelope([]byte("test message"))
+		require.NoError(t, err)
+		blobs = append(blobs, blob)
+	}
+
+	for round := 0; round < 2; round++ {
+		for _, blob := range blobs[:2] {
+			plaintext, err := cached.DecryptEnvelope(blob)
+			require.NoError(t, err)
+			require.Equal(t, "test message", string(plaintext))
+		}
+	}
+	stats := cached.Stats()
+	require.EqualValues(t, 2, stats.DecryptMisses)
+	require.EqualValues(t, 2, stats.DecryptHits)
+	require.InDelta(t, 0.5, stats.DecryptHitRate(), 1e-9)
+
+	// A third data key evicts the least recently used entry // 第三个数据密钥会淘汰最久未使用的缓存项
+	_, err = cached.DecryptEnvelope(blobs[2])
+	require.NoError(t, err)
+	_, err = cached.DecryptEnvelope(blobs[0])
+	require.NoError(t, err)
+	stats = cached.Stats()
+	require.EqualValues(t, 4, stats.DecryptMisses)
+	require.EqualValues(t, 2, stats.Evictions)
+
+	cached.Purge()
+	_, err = cached.DecryptEnvelope(blobs[0])
+	require.NoError(t, err)
+	require.EqualValues(t, 5, cached.Stats().DecryptMisses)
+}
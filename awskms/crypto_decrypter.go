@@ -0,0 +1,167 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"io"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// DecrypterAPI defines the KMS operations used by AwsKmsCryptoDecrypter
+//
+// DecrypterAPI 定义 AwsKmsCryptoDecrypter 使用的 KMS 操作
+type DecrypterAPI interface {
+	PublicKeyAPI
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+var _ DecrypterAPI = (*kms.Client)(nil)
+
+var _ crypto.Decrypter = (*AwsKmsCryptoDecrypter)(nil)
+
+// AwsKmsCryptoDecrypter implements crypto.Decrypter with an RSA ENCRYPT_DECRYPT KMS key
+// Plugs KMS keys into CMS/PKCS#7 tooling and key transport code, the private key never leaves KMS
+// Only RSAES-OAEP is available, since KMS does not support PKCS#1 v1.5 decryption
+//
+// AwsKmsCryptoDecrypter 使用 RSA ENCRYPT_DECRYPT KMS 密钥实现 crypto.Decrypter
+// 可将 KMS 密钥接入 CMS/PKCS#7 工具和密钥传输代码，私钥不会离开 KMS
+// 只支持 RSAES-OAEP，因为 KMS 不支持 PKCS#1 v1.5 解密
+type AwsKmsCryptoDecrypter struct {
+	client               DecrypterAPI                    // AWS KMS client to handle API operations // AWS KMS 客户端用于处理 API 操作
+	keyID                string                          // Key ARN reported by GetPublicKey // GetPublicKey 返回的密钥 ARN
+	publicKey            *rsa.PublicKey                  // Public key fetched at creation // 创建时获取的公钥
+	encryptionAlgorithms []types.EncryptionAlgorithmSpec // Algorithms the key supports // 密钥支持的算法
+}
+
+// NewAwsKmsCryptoDecrypter creates AwsKmsCryptoDecrypter, fetching the public key via GetPublicKey
+// Accepts any DecrypterAPI client, e.g. *kms.Client
+//
+// NewAwsKmsCryptoDecrypter 创建 AwsKmsCryptoDecrypter，并通过 GetPublicKey 获取公钥
+// 接受任意 DecrypterAPI 客户端，例如 *kms.Client
+func NewAwsKmsCryptoDecrypter(client DecrypterAPI, decryptKeyID string) (*AwsKmsCryptoDecrypter, error) {
+	return NewAwsKmsCryptoDecrypterContext(context.Background(), client, decryptKeyID)
+}
+
+// NewAwsKmsCryptoDecrypterContext creates AwsKmsCryptoDecrypter, fetching the public key with the given context
+// Checks the key is an RSA key with ENCRYPT_DECRYPT usage
+//
+// NewAwsKmsCryptoDecrypterContext 创建 AwsKmsCryptoDecrypter，使用给定的上下文获取公钥
+// 检查密钥是 ENCRYPT_DECRYPT 用途的 RSA 密钥
+func NewAwsKmsCryptoDecrypterContext(ctx context.Context, client DecrypterAPI, decryptKeyID string) (*AwsKmsCryptoDecrypter, error) {
+	utils.MustClient(client)
+	must.Nice(decryptKeyID)
+
+	res, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: &decryptKeyID,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if res.KeyUsage != types.KeyUsageTypeEncryptDecrypt {
+		return nil, erero.Errorf("key usage %s is not ENCRYPT_DECRYPT", res.KeyUsage)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, erero.Errorf("key spec %s is not an RSA key", res.KeySpec)
+	}
+	return &AwsKmsCryptoDecrypter{
+		client:               client,
+		keyID:                aws.ToString(res.KeyId),
+		publicKey:            rsaPublicKey,
+		encryptionAlgorithms: res.EncryptionAlgorithms,
+	}, nil
+}
+
+// Public returns the RSA public key as *rsa.PublicKey
+//
+// Public 返回 RSA 公钥，类型为 *rsa.PublicKey
+func (d *AwsKmsCryptoDecrypter) Public() crypto.PublicKey {
+	return d.publicKey
+}
+
+// KeyID returns the KMS key ARN
+//
+// KeyID 返回 KMS 密钥 ARN
+func (d *AwsKmsCryptoDecrypter) KeyID() string {
+	return d.keyID
+}
+
+// Decrypt decrypts msg through KMS Decrypt, implementing crypto.Decrypter
+// The rand argument is ignored since decryption happens inside KMS
+//
+// Decrypt 通过 KMS Decrypt 解密 msg，实现 crypto.Decrypter
+// rand 参数被忽略，解密在 KMS 内部进行
+func (d *AwsKmsCryptoDecrypter) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return d.DecryptContext(context.Background(), msg, opts)
+}
+
+// DecryptContext decrypts msg through KMS Decrypt with the given context
+// opts must be *rsa.OAEPOptions with SHA-1 or SHA-256, the same MGF1 hash and no label
+//
+// DecryptContext 使用给定的上下文通过 KMS Decrypt 解密 msg
+// opts 必须是使用 SHA-1 或 SHA-256、相同 MGF1 哈希且没有标签的 *rsa.OAEPOptions
+func (d *AwsKmsCryptoDecrypter) DecryptContext(ctx context.Context, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	algorithm, err := d.encryptionAlgorithm(opts)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := d.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:               &d.keyID,
+		CiphertextBlob:      msg,
+		EncryptionAlgorithm: algorithm,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res.Plaintext, nil
+}
+
+// encryptionAlgorithm maps decrypter opts to the KMS RSAES-OAEP algorithm
+//
+// encryptionAlgorithm 将解密选项映射为 KMS RSAES-OAEP 算法
+func (d *AwsKmsCryptoDecrypter) encryptionAlgorithm(opts crypto.DecrypterOpts) (types.EncryptionAlgorithmSpec, error) {
+	var oaepOptions *rsa.OAEPOptions
+	switch opts := opts.(type) {
+	case *rsa.OAEPOptions:
+		oaepOptions = opts
+	case rsa.OAEPOptions:
+		oaepOptions = &opts
+	case nil, *rsa.PKCS1v15DecryptOptions, rsa.PKCS1v15DecryptOptions:
+		return "", erero.New("PKCS#1 v1.5 decryption is not supported by KMS, use *rsa.OAEPOptions")
+	default:
+		return "", erero.Errorf("decrypter opts %T are not supported, use *rsa.OAEPOptions", opts)
+	}
+
+	var algorithm types.EncryptionAlgorithmSpec
+	switch oaepOptions.Hash {
+	case crypto.SHA1:
+		algorithm = types.EncryptionAlgorithmSpecRsaesOaepSha1
+	case crypto.SHA256:
+		algorithm = types.EncryptionAlgorithmSpecRsaesOaepSha256
+	default:
+		return "", erero.Errorf("OAEP hash %s is not supported by KMS, use SHA-1 or SHA-256", oaepOptions.Hash)
+	}
+	if oaepOptions.MGFHash != 0 && oaepOptions.MGFHash != oaepOptions.Hash {
+		return "", erero.Errorf("OAEP MGF1 hash %s differs from %s, KMS uses the same hash", oaepOptions.MGFHash, oaepOptions.Hash)
+	}
+	if len(oaepOptions.Label) != 0 {
+		return "", erero.New("OAEP label is not supported by KMS")
+	}
+	if !slices.Contains(d.encryptionAlgorithms, algorithm) {
+		return "", erero.Errorf("key does not support encryption algorithm %s", algorithm)
+	}
+	return algorithm, nil
+}
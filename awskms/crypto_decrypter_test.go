@@ -0,0 +1,59 @@
+package awskms_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKmsCryptoDecrypter_Decrypt tests the crypto.Decrypter with OAEP options and rejected options
+//
+// TestAwsKmsCryptoDecrypter_Decrypt 测试使用 OAEP 选项的 crypto.Decrypter 以及被拒绝的选项
+func TestAwsKmsCryptoDecrypter_Decrypt(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	decrypter, err := awskms.NewAwsKmsCryptoDecrypter(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt))
+	require.NoError(t, err)
+	publicKey := decrypter.Public().(*rsa.PublicKey)
+
+	var _ crypto.Decrypter = decrypter
+
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, []byte("test message"), nil)
+	require.NoError(t, err)
+
+	plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	sha1Ciphertext, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, []byte("test message"), nil)
+	require.NoError(t, err)
+
+	plaintext, err = decrypter.Decrypt(rand.Reader, sha1Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA1, MGFHash: crypto.SHA1})
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	t.Run("UnsupportedOptions", func(t *testing.T) {
+		for _, opts := range []crypto.DecrypterOpts{
+			nil,
+			&rsa.PKCS1v15DecryptOptions{},
+			&rsa.OAEPOptions{Hash: crypto.SHA512},
+			&rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA1},
+			&rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label")},
+		} {
+			_, err := decrypter.Decrypt(rand.Reader, ciphertext, opts)
+			require.Error(t, err)
+		}
+	})
+
+	t.Run("SignKey", func(t *testing.T) {
+		_, err := awskms.NewAwsKmsCryptoDecrypter(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify))
+		require.Error(t, err)
+	})
+}
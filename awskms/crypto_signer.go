@@ -0,0 +1,203 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"io"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+var _ crypto.Signer = (*AwsKmsCryptoSigner)(nil)
+
+// AwsKmsCryptoSigner implements crypto.Signer with a SIGN_VERIFY KMS key
+// Plugs KMS keys into x509, TLS and JWT libraries, the private key never leaves KMS
+// The signing algorithm is chosen on each call from crypto.SignerOpts, *rsa.PSSOptions included
+//
+// AwsKmsCryptoSigner 使用 SIGN_VERIFY KMS 密钥实现 crypto.Signer
+// 可将 KMS 密钥接入 x509、TLS 和 JWT 等库，私钥不会离开 KMS
+// 每次调用根据 crypto.SignerOpts（包括 *rsa.PSSOptions）选择签名算法
+type AwsKmsCryptoSigner struct {
+	client            SignerAPI                    // AWS KMS client to handle API operations // AWS KMS 客户端用于处理 API 操作
+	keyID             string                       // Key ARN reported by GetPublicKey // GetPublicKey 返回的密钥 ARN
+	publicKey         crypto.PublicKey             // Public key fetched at creation // 创建时获取的公钥
+	signingAlgorithms []types.SigningAlgorithmSpec // Algorithms the key supports // 密钥支持的算法
+}
+
+// NewAwsKmsCryptoSigner creates AwsKmsCryptoSigner, fetching the public key via GetPublicKey
+// Accepts any SignerAPI client, e.g. *kms.Client
+//
+// NewAwsKmsCryptoSigner 创建 AwsKmsCryptoSigner，并通过 GetPublicKey 获取公钥
+// 接受任意 SignerAPI 客户端，例如 *kms.Client
+func NewAwsKmsCryptoSigner(client SignerAPI, signKeyID string) (*AwsKmsCryptoSigner, error) {
+	return NewAwsKmsCryptoSignerContext(context.Background(), client, signKeyID)
+}
+
+// NewAwsKmsCryptoSignerContext creates AwsKmsCryptoSigner, fetching the public key with the given context
+// crypto.Signer.Public returns no error, so the key is fetched up front and checked to be SIGN_VERIFY
+//
+// NewAwsKmsCryptoSignerContext 创建 AwsKmsCryptoSigner，使用给定的上下文获取公钥
+// crypto.Signer.Public 不返回错误，因此预先获取公钥并检查其用途为 SIGN_VERIFY
+func NewAwsKmsCryptoSignerContext(ctx context.Context, client SignerAPI, signKeyID string) (*AwsKmsCryptoSigner, error) {
+	utils.MustClient(client)
+	must.Nice(signKeyID)
+
+	res, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: &signKeyID,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if res.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, erero.Errorf("key usage %s is not SIGN_VERIFY", res.KeyUsage)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &AwsKmsCryptoSigner{
+		client:            client,
+		keyID:             aws.ToString(res.KeyId),
+		publicKey:         publicKey,
+		signingAlgorithms: res.SigningAlgorithms,
+	}, nil
+}
+
+// Public returns the public key, *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+//
+// Public 返回公钥，类型为 *rsa.PublicKey、*ecdsa.PublicKey 或 ed25519.PublicKey
+func (s *AwsKmsCryptoSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// KeyID returns the KMS key ARN
+//
+// KeyID 返回 KMS 密钥 ARN
+func (s *AwsKmsCryptoSigner) KeyID() string {
+	return s.keyID
+}
+
+// Sign signs the digest through KMS Sign, implementing crypto.Signer
+// The rand argument is ignored since randomness comes from KMS
+//
+// Sign 通过 KMS Sign 对摘要签名，实现 crypto.Signer
+// rand 参数被忽略，随机性由 KMS 提供
+func (s *AwsKmsCryptoSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.SignContext(context.Background(), digest, opts)
+}
+
+// SignContext signs the digest through KMS Sign with the given context
+// RSA keys use RSASSA-PSS when opts is *rsa.PSSOptions and RSASSA-PKCS1-v1_5 otherwise
+// KMS PSS signatures use a salt as long as the hash, so other fixed salt lengths are rejected
+// Ed25519 keys follow ed25519.PrivateKey: opts must have hash 0 and the digest argument is the whole message
+//
+// SignContext 使用给定的上下文通过 KMS Sign 对摘要签名
+// RSA 密钥在 opts 为 *rsa.PSSOptions 时使用 RSASSA-PSS，否则使用 RSASSA-PKCS1-v1_5
+// KMS 的 PSS 签名盐长等于哈希长度，因此拒绝其它固定的盐长
+// Ed25519 密钥遵循 ed25519.PrivateKey 的约定：opts 的哈希必须为 0，digest 参数为完整消息
+func (s *AwsKmsCryptoSigner) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := s.publicKey.(ed25519.PublicKey); ok {
+		return s.signEd25519(ctx, digest, opts)
+	}
+	algorithm, err := s.signingAlgorithm(opts)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if len(digest) != opts.HashFunc().Size() {
+		return nil, erero.Errorf("digest length %d does not match %s", len(digest), opts.HashFunc())
+	}
+	res, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            &s.keyID,
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: algorithm,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res.Signature, nil
+}
+
+// signingAlgorithm maps the public key type and opts to the KMS signing algorithm
+//
+// signingAlgorithm 根据公钥类型和 opts 映射到 KMS 签名算法
+func (s *AwsKmsCryptoSigner) signingAlgorithm(opts crypto.SignerOpts) (types.SigningAlgorithmSpec, error) {
+	if opts == nil {
+		return "", erero.New("signer opts are required")
+	}
+	var algorithms map[crypto.Hash]types.SigningAlgorithmSpec
+	switch s.publicKey.(type) {
+	case *rsa.PublicKey:
+		if pssOptions, ok := opts.(*rsa.PSSOptions); ok {
+			saltLength := pssOptions.SaltLength
+			if saltLength != rsa.PSSSaltLengthAuto && saltLength != rsa.PSSSaltLengthEqualsHash && saltLength != opts.HashFunc().Size() {
+				return "", erero.Errorf("PSS salt length %d is not supported, KMS uses the hash length", saltLength)
+			}
+			algorithms = map[crypto.Hash]types.SigningAlgorithmSpec{
+				crypto.SHA256: types.SigningAlgorithmSpecRsassaPssSha256,
+				crypto.SHA384: types.SigningAlgorithmSpecRsassaPssSha384,
+				crypto.SHA512: types.SigningAlgorithmSpecRsassaPssSha512,
+			}
+		} else {
+			algorithms = map[crypto.Hash]types.SigningAlgorithmSpec{
+				crypto.SHA256: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+				crypto.SHA384: types.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+				crypto.SHA512: types.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+			}
+		}
+	case *ecdsa.PublicKey:
+		algorithms = map[crypto.Hash]types.SigningAlgorithmSpec{
+			crypto.SHA256: types.SigningAlgorithmSpecEcdsaSha256,
+			crypto.SHA384: types.SigningAlgorithmSpecEcdsaSha384,
+			crypto.SHA512: types.SigningAlgorithmSpecEcdsaSha512,
+		}
+	default:
+		return "", erero.Errorf("public key type %T is not supported", s.publicKey)
+	}
+	algorithm, ok := algorithms[opts.HashFunc()]
+	if !ok {
+		return "", erero.Errorf("hash %s is not supported", opts.HashFunc())
+	}
+	if !slices.Contains(s.signingAlgorithms, algorithm) {
+		return "", erero.Errorf("key does not support signing algorithm %s", algorithm)
+	}
+	return algorithm, nil
+}
+
+// signEd25519 signs the whole message with pure Ed25519, rejecting Ed25519ph and Ed25519ctx options
+//
+// signEd25519 使用纯 Ed25519 对完整消息签名，拒绝 Ed25519ph 和 Ed25519ctx 选项
+func (s *AwsKmsCryptoSigner) signEd25519(ctx context.Context, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts == nil || opts.HashFunc() != 0 {
+		return nil, erero.New("Ed25519 keys sign the message with hash 0, prehashed Ed25519ph is not supported")
+	}
+	if options, ok := opts.(*ed25519.Options); ok && options.Context != "" {
+		return nil, erero.New("Ed25519ctx is not supported")
+	}
+	if !slices.Contains(s.signingAlgorithms, SigningAlgorithmSpecEd25519Sha512) {
+		return nil, erero.Errorf("key does not support signing algorithm %s", SigningAlgorithmSpecEd25519Sha512)
+	}
+	if len(message) == 0 || len(message) > maxRawMessageSize {
+		return nil, erero.Errorf("message length %d is not between 1 and %d", len(message), maxRawMessageSize)
+	}
+	res, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            &s.keyID,
+		Message:          message,
+		MessageType:      types.MessageTypeRaw,
+		SigningAlgorithm: SigningAlgorithmSpecEd25519Sha512,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res.Signature, nil
+}
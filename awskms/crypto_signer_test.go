@@ -0,0 +1,99 @@
+package awskms_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKmsCryptoSigner_Sign tests the crypto.Signer with PKCS1 v1.5, PSS and ECDSA options
+//
+// TestAwsKmsCryptoSigner_Sign 测试使用 PKCS1 v1.5、PSS 和 ECDSA 选项的 crypto.Signer
+func TestAwsKmsCryptoSigner_Sign(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	digest := sha256.Sum256([]byte("test message"))
+
+	t.Run("RSA", func(t *testing.T) {
+		signer, err := awskms.NewAwsKmsCryptoSigner(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify))
+		require.NoError(t, err)
+		publicKey := signer.Public().(*rsa.PublicKey)
+
+		signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		require.NoError(t, rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature))
+
+		pssOptions := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		signature, err = signer.Sign(rand.Reader, digest[:], pssOptions)
+		require.NoError(t, err)
+		require.NoError(t, rsa.VerifyPSS(publicKey, crypto.SHA256, digest[:], signature, pssOptions))
+
+		digest384 := sha512.Sum384([]byte("test message"))
+		signature, err = signer.Sign(rand.Reader, digest384[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: crypto.SHA384})
+		require.NoError(t, err)
+		require.NoError(t, rsa.VerifyPSS(publicKey, crypto.SHA384, digest384[:], signature, nil))
+
+		_, err = signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: 8, Hash: crypto.SHA256})
+		require.Error(t, err)
+
+		_, err = signer.Sign(rand.Reader, digest[:20], crypto.SHA1)
+		require.Error(t, err)
+	})
+
+	t.Run("ECDSA", func(t *testing.T) {
+		signer, err := awskms.NewAwsKmsCryptoSigner(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify))
+		require.NoError(t, err)
+
+		signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		require.True(t, ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], signature))
+
+		digest512 := sha512.Sum512([]byte("test message"))
+		_, err = signer.Sign(rand.Reader, digest512[:], crypto.SHA512)
+		require.Error(t, err) // P-256 keys only support ECDSA_SHA_256 // P-256 密钥只支持 ECDSA_SHA_256
+	})
+
+	t.Run("EncryptKey", func(t *testing.T) {
+		_, err := awskms.NewAwsKmsCryptoSigner(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt))
+		require.Error(t, err)
+	})
+}
+
+// TestAwsKmsCryptoSigner_X509 tests signing a self-signed certificate through the standard library
+//
+// TestAwsKmsCryptoSigner_X509 测试通过标准库签发自签名证书
+func TestAwsKmsCryptoSigner_X509(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	for _, keySpec := range []types.KeySpec{types.KeySpecRsa2048, types.KeySpecEccNistP384} {
+		signer, err := awskms.NewAwsKmsCryptoSigner(fake, fake.MustCreateKey(keySpec, types.KeyUsageTypeSignVerify))
+		require.NoError(t, err)
+
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "kms test"},
+			NotBefore:             time.Now().Add(-time.Minute),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+		require.NoError(t, err)
+
+		certificate, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		require.NoError(t, certificate.CheckSignatureFrom(certificate))
+	}
+}
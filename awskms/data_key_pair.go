@@ -0,0 +1,351 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"math/big"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// DataKeyPairAPI defines the KMS operations used to generate data key pairs
+//
+// DataKeyPairAPI 定义生成数据密钥对使用的 KMS 操作
+type DataKeyPairAPI interface {
+	GenerateDataKeyPair(ctx context.Context, params *kms.GenerateDataKeyPairInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairOutput, error)
+	GenerateDataKeyPairWithoutPlaintext(ctx context.Context, params *kms.GenerateDataKeyPairWithoutPlaintextInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairWithoutPlaintextOutput, error)
+}
+
+var _ DataKeyPairAPI = (*kms.Client)(nil)
+
+// DataKeyPair is an asymmetric data key pair whose private key is wrapped by the symmetric KMS key
+// Devices keep the public key and wrapped private key, encrypt offline and never hold the private key
+// RSA_2048/3072/4096 and ECC_NIST_P256/P384/P521 specs are supported
+//
+// DataKeyPair 是非对称数据密钥对，其私钥由对称 KMS 密钥包装
+// 设备保存公钥和被包装的私钥，离线加密且从不持有私钥
+// 支持 RSA_2048/3072/4096 和 ECC_NIST_P256/P384/P521 规格
+type DataKeyPair struct {
+	KeyPairSpec              types.DataKeyPairSpec // Spec of the key pair // 密钥对规格
+	KeyID                    string                // ARN of the KMS key wrapping the private key // 包装私钥的 KMS 密钥 ARN
+	PublicKey                crypto.PublicKey      // *rsa.PublicKey or *ecdsa.PublicKey // *rsa.PublicKey 或 *ecdsa.PublicKey
+	PrivateKeyCiphertextBlob []byte                // PKCS#8 private key encrypted by KMS // 由 KMS 加密的 PKCS#8 私钥
+	privateKey               crypto.PrivateKey     // Plaintext private key from GenerateDataKeyPair, nil once cleared // 来自 GenerateDataKeyPair 的明文私钥，清除后为 nil
+}
+
+// GenerateDataKeyPair generates a data key pair, returning the plaintext private key along with the wrapped one
+// Call ClearPrivateKey once the plaintext private key is no longer needed, which wipes it on a best-effort basis only
+//
+// GenerateDataKeyPair 生成数据密钥对，同时返回明文私钥和被包装的私钥
+// 不再需要明文私钥时调用 ClearPrivateKey，但它只能尽力清除私钥
+func (a *AwsKms) GenerateDataKeyPair(keyPairSpec types.DataKeyPairSpec) (*DataKeyPair, error) {
+	return a.GenerateDataKeyPairContext(context.Background(), keyPairSpec)
+}
+
+// GenerateDataKeyPairContext generates a data key pair with the given context
+//
+// GenerateDataKeyPairContext 使用给定的上下文生成数据密钥对
+func (a *AwsKms) GenerateDataKeyPairContext(ctx context.Context, keyPairSpec types.DataKeyPairSpec) (*DataKeyPair, error) {
+	return a.GenerateDataKeyPairWithEncryptionContext(ctx, keyPairSpec, nil)
+}
+
+// GenerateDataKeyPairWithEncryptionContext generates a data key pair whose wrapped private key is bound to the encryption context
+// The PKCS#8 bytes from KMS are zeroed once parsed
+//
+// GenerateDataKeyPairWithEncryptionContext 生成数据密钥对，被包装的私钥绑定加密上下文
+// 来自 KMS 的 PKCS#8 字节在解析后会被清零
+func (a *AwsKms) GenerateDataKeyPairWithEncryptionContext(ctx context.Context, keyPairSpec types.DataKeyPairSpec, encryptionContext map[string]string) (*DataKeyPair, error) {
+	must.Nice(keyPairSpec)
+
+	client, err := clientAs[DataKeyPairAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GenerateDataKeyPair(ctx, &kms.GenerateDataKeyPairInput{
+		KeyId:             &a.encryptKeyID,
+		KeyPairSpec:       keyPairSpec,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(res.PrivateKeyPlaintext)
+
+	dataKeyPair, err := newDataKeyPair(res.KeyPairSpec, aws.ToString(res.KeyId), res.PublicKey, res.PrivateKeyCiphertextBlob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(res.PrivateKeyPlaintext)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	dataKeyPair.privateKey = privateKey
+	return dataKeyPair, nil
+}
+
+// GenerateDataKeyPairWithoutPlaintext generates a data key pair returning only the public key and wrapped private key
+// Suits provisioning of offline devices, which must never see the private key
+//
+// GenerateDataKeyPairWithoutPlaintext 生成数据密钥对，只返回公钥和被包装的私钥
+// 适用于为离线设备分配密钥，设备不应接触私钥
+func (a *AwsKms) GenerateDataKeyPairWithoutPlaintext(keyPairSpec types.DataKeyPairSpec) (*DataKeyPair, error) {
+	return a.GenerateDataKeyPairWithoutPlaintextContext(context.Background(), keyPairSpec)
+}
+
+// GenerateDataKeyPairWithoutPlaintextContext generates a data key pair without plaintext with the given context
+//
+// GenerateDataKeyPairWithoutPlaintextContext 使用给定的上下文生成不含明文的数据密钥对
+func (a *AwsKms) GenerateDataKeyPairWithoutPlaintextContext(ctx context.Context, keyPairSpec types.DataKeyPairSpec) (*DataKeyPair, error) {
+	return a.GenerateDataKeyPairWithoutPlaintextWithEncryptionContext(ctx, keyPairSpec, nil)
+}
+
+// GenerateDataKeyPairWithoutPlaintextWithEncryptionContext generates a data key pair without plaintext bound to the encryption context
+//
+// GenerateDataKeyPairWithoutPlaintextWithEncryptionContext 生成不含明文的数据密钥对并绑定加密上下文
+func (a *AwsKms) GenerateDataKeyPairWithoutPlaintextWithEncryptionContext(ctx context.Context, keyPairSpec types.DataKeyPairSpec, encryptionContext map[string]string) (*DataKeyPair, error) {
+	must.Nice(keyPairSpec)
+
+	client, err := clientAs[DataKeyPairAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GenerateDataKeyPairWithoutPlaintext(ctx, &kms.GenerateDataKeyPairWithoutPlaintextInput{
+		KeyId:             &a.encryptKeyID,
+		KeyPairSpec:       keyPairSpec,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	dataKeyPair, err := newDataKeyPair(res.KeyPairSpec, aws.ToString(res.KeyId), res.PublicKey, res.PrivateKeyCiphertextBlob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return dataKeyPair, nil
+}
+
+// UseDataKeyPairPrivateKey unwraps the private key through AwsKms.Decrypt, runs fn with it and clears it afterwards
+// The private key is *rsa.PrivateKey or *ecdsa.PrivateKey and must not be kept beyond fn
+// Clearing is best effort and does not guarantee the key is gone from memory, see ClearPrivateKey
+//
+// UseDataKeyPairPrivateKey 通过 AwsKms.Decrypt 解包私钥，用其执行 fn 并在之后清除
+// 私钥为 *rsa.PrivateKey 或 *ecdsa.PrivateKey，不得在 fn 之外保留
+// 清除只是尽力而为，不能保证私钥已从内存中消失，参见 ClearPrivateKey
+func (a *AwsKms) UseDataKeyPairPrivateKey(privateKeyCiphertextBlob []byte, fn func(privateKey crypto.PrivateKey) error) error {
+	return a.UseDataKeyPairPrivateKeyContext(context.Background(), privateKeyCiphertextBlob, fn)
+}
+
+// UseDataKeyPairPrivateKeyContext unwraps the private key with the given context and runs fn with it
+//
+// UseDataKeyPairPrivateKeyContext 使用给定的上下文解包私钥并用其执行 fn
+func (a *AwsKms) UseDataKeyPairPrivateKeyContext(ctx context.Context, privateKeyCiphertextBlob []byte, fn func(privateKey crypto.PrivateKey) error) error {
+	return a.UseDataKeyPairPrivateKeyWithEncryptionContext(ctx, privateKeyCiphertextBlob, nil, fn)
+}
+
+// UseDataKeyPairPrivateKeyWithEncryptionContext unwraps the private key bound to the encryption context and runs fn with it
+// Clearing is best effort: the PKCS#8 bytes and the exported big.Int words of the key are wiped
+//
+// UseDataKeyPairPrivateKeyWithEncryptionContext 解包绑定加密上下文的私钥并用其执行 fn
+// 清除只是尽力而为：只清除 PKCS#8 字节和私钥中导出的 big.Int 数据
+func (a *AwsKms) UseDataKeyPairPrivateKeyWithEncryptionContext(ctx context.Context, privateKeyCiphertextBlob []byte, encryptionContext map[string]string, fn func(privateKey crypto.PrivateKey) error) error {
+	must.True(fn != nil)
+
+	privateKeyDer, err := a.DecryptWithEncryptionContext(ctx, privateKeyCiphertextBlob, encryptionContext)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	defer clear(privateKeyDer)
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(privateKeyDer)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	defer zeroPrivateKey(privateKey)
+
+	if err := fn(privateKey); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// DecryptWithDataKeyPair decrypts ciphertext from DataKeyPair.Encrypt, unwrapping the private key only for this call
+//
+// DecryptWithDataKeyPair 解密来自 DataKeyPair.Encrypt 的密文，私钥只在本次调用中被解包
+func (a *AwsKms) DecryptWithDataKeyPair(privateKeyCiphertextBlob []byte, ciphertext []byte) ([]byte, error) {
+	return a.DecryptWithDataKeyPairContext(context.Background(), privateKeyCiphertextBlob, ciphertext)
+}
+
+// DecryptWithDataKeyPairContext decrypts ciphertext from DataKeyPair.Encrypt with the given context
+//
+// DecryptWithDataKeyPairContext 使用给定的上下文解密来自 DataKeyPair.Encrypt 的密文
+func (a *AwsKms) DecryptWithDataKeyPairContext(ctx context.Context, privateKeyCiphertextBlob []byte, ciphertext []byte) ([]byte, error) {
+	return a.DecryptWithDataKeyPairWithEncryptionContext(ctx, privateKeyCiphertextBlob, nil, ciphertext)
+}
+
+// DecryptWithDataKeyPairWithEncryptionContext decrypts ciphertext from DataKeyPair.Encrypt with a private key bound to the encryption context
+//
+// DecryptWithDataKeyPairWithEncryptionContext 使用绑定加密上下文的私钥解密来自 DataKeyPair.Encrypt 的密文
+func (a *AwsKms) DecryptWithDataKeyPairWithEncryptionContext(ctx context.Context, privateKeyCiphertextBlob []byte, encryptionContext map[string]string, ciphertext []byte) ([]byte, error) {
+	var plaintext []byte
+	if err := a.UseDataKeyPairPrivateKeyWithEncryptionContext(ctx, privateKeyCiphertextBlob, encryptionContext, func(privateKey crypto.PrivateKey) error {
+		res, err := decryptWithPrivateKey(privateKey, ciphertext)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		plaintext = res
+		return nil
+	}); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return plaintext, nil
+}
+
+// Encrypt encrypts plaintext offline with the public key, decryptable with AwsKms.DecryptWithDataKeyPair
+// RSA pairs use RSAES-OAEP with SHA-256 and are limited by the key size, ECC pairs use ECIES and accept any size
+//
+// Encrypt 使用公钥离线加密明文，可以使用 AwsKms.DecryptWithDataKeyPair 解密
+// RSA 密钥对使用 SHA-256 的 RSAES-OAEP，长度受密钥大小限制，ECC 密钥对使用 ECIES，接受任意大小
+func (p *DataKeyPair) Encrypt(plaintext []byte) ([]byte, error) {
+	switch publicKey := p.PublicKey.(type) {
+	case *rsa.PublicKey:
+		encrypter, err := NewRsaEncrypter(publicKey, types.EncryptionAlgorithmSpecRsaesOaepSha256)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return encrypter.Encrypt(plaintext)
+	case *ecdsa.PublicKey:
+		encrypter, err := NewEciesEncrypter(publicKey)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return encrypter.Encrypt(plaintext)
+	default:
+		return nil, erero.Errorf("public key type %T is not supported", publicKey)
+	}
+}
+
+// PrivateKey returns the plaintext private key from GenerateDataKeyPair, nil without plaintext or once cleared
+//
+// PrivateKey 返回来自 GenerateDataKeyPair 的明文私钥，不含明文或已清除时为 nil
+func (p *DataKeyPair) PrivateKey() crypto.PrivateKey {
+	return p.privateKey
+}
+
+// ClearPrivateKey drops the plaintext private key after a best-effort wipe, keeping the wrapped one
+// Only the exported big.Int fields can be wiped: crypto/rsa keeps unexported precomputed values,
+// ECDH via privateKey.ECDH() makes its own scalar copy, and the garbage collector may have moved the words
+// Treat it as reducing exposure, not as a guarantee the key is gone from memory
+//
+// ClearPrivateKey 尽力清除明文私钥后将其丢弃，保留被包装的私钥
+// 只能清除导出的 big.Int 字段：crypto/rsa 保留未导出的预计算值，
+// 通过 privateKey.ECDH() 进行 ECDH 时会复制一份标量，垃圾回收也可能已移动过这些数据
+// 应视为减少暴露，而不是保证私钥已从内存中消失
+func (p *DataKeyPair) ClearPrivateKey() {
+	if p.privateKey != nil {
+		zeroPrivateKey(p.privateKey)
+		p.privateKey = nil
+	}
+}
+
+// newDataKeyPair parses the DER SPKI public key, accepting RSA and NIST ECC keys
+//
+// newDataKeyPair 解析 DER SPKI 公钥，接受 RSA 和 NIST ECC 密钥
+func newDataKeyPair(keyPairSpec types.DataKeyPairSpec, keyID string, publicKeyDer []byte, privateKeyCiphertextBlob []byte) (*DataKeyPair, error) {
+	publicKey, err := x509.ParsePKIXPublicKey(publicKeyDer)
+	if err != nil {
+		return nil, erero.Wrapf(err, "key pair spec %s is not supported", keyPairSpec)
+	}
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, erero.Errorf("key pair spec %s is not supported", keyPairSpec)
+	}
+	return &DataKeyPair{
+		KeyPairSpec:              keyPairSpec,
+		KeyID:                    keyID,
+		PublicKey:                publicKey,
+		PrivateKeyCiphertextBlob: privateKeyCiphertextBlob,
+	}, nil
+}
+
+// decryptWithPrivateKey reverses DataKeyPair.Encrypt, RSAES-OAEP-SHA-256 with RSA keys and ECIES with ECC keys
+//
+// decryptWithPrivateKey 是 DataKeyPair.Encrypt 的逆操作，RSA 密钥使用 RSAES-OAEP-SHA-256，ECC 密钥使用 ECIES
+func decryptWithPrivateKey(privateKey crypto.PrivateKey, ciphertext []byte) ([]byte, error) {
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		plaintext, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, ciphertext, nil)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return plaintext, nil
+	case *ecdsa.PrivateKey:
+		blob, err := parseEciesBlob(ciphertext)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		ephemeralKey, err := x509.ParsePKIXPublicKey(blob.ephemeralKey)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		ephemeralEcdsaKey, ok := ephemeralKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, erero.Errorf("ephemeral key type %T is not an ECC key", ephemeralKey)
+		}
+		ephemeralEcdhKey, err := ephemeralEcdsaKey.ECDH()
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		ecdhPrivateKey, err := privateKey.ECDH()
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		sharedSecret, err := ecdhPrivateKey.ECDH(ephemeralEcdhKey)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		defer clear(sharedSecret)
+
+		return blob.open(sharedSecret)
+	default:
+		return nil, erero.Errorf("private key type %T is not supported", privateKey)
+	}
+}
+
+// zeroPrivateKey clears the exported secret big.Int words of RSA and ECDSA private keys
+// Best effort only, copies held in unexported fields of crypto/rsa and crypto/ecdh are out of reach
+//
+// zeroPrivateKey 清除 RSA 和 ECDSA 私钥中导出的秘密 big.Int 数据
+// 只是尽力而为，crypto/rsa 和 crypto/ecdh 未导出字段中的副本无法触及
+func zeroPrivateKey(privateKey crypto.PrivateKey) {
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		zeroBigInts(privateKey.D, privateKey.Precomputed.Dp, privateKey.Precomputed.Dq, privateKey.Precomputed.Qinv)
+		zeroBigInts(privateKey.Primes...)
+		for _, crtValue := range privateKey.Precomputed.CRTValues {
+			zeroBigInts(crtValue.Exp, crtValue.Coeff, crtValue.R)
+		}
+	case *ecdsa.PrivateKey:
+		zeroBigInts(privateKey.D)
+	}
+}
+
+// zeroBigInts clears the words of each big.Int and sets it to zero
+//
+// zeroBigInts 清除每个 big.Int 的数据并将其置零
+func zeroBigInts(values ...*big.Int) {
+	for _, value := range values {
+		if value != nil {
+			clear(value.Bits())
+			value.SetInt64(0)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package awskms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKms_GenerateDataKeyPairWithoutPlaintext tests offline encryption with the public key and decryption via the wrapped private key
+//
+// TestAwsKms_GenerateDataKeyPairWithoutPlaintext 测试使用公钥离线加密并通过被包装的私钥解密
+func TestAwsKms_GenerateDataKeyPairWithoutPlaintext(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt))
+
+	for _, keyPairSpec := range []types.DataKeyPairSpec{
+		types.DataKeyPairSpecRsa2048,
+		types.DataKeyPairSpecEccNistP256,
+		types.DataKeyPairSpecEccNistP384,
+		types.DataKeyPairSpecEccNistP521,
+	} {
+		t.Run(string(keyPairSpec), func(t *testing.T) {
+			dataKeyPair, err := awsKms.GenerateDataKeyPairWithoutPlaintext(keyPairSpec)
+			require.NoError(t, err)
+			require.Equal(t, keyPairSpec, dataKeyPair.KeyPairSpec)
+			require.Contains(t, dataKeyPair.KeyID, "arn:aws:kms:")
+			require.NotEmpty(t, dataKeyPair.PrivateKeyCiphertextBlob)
+			require.Nil(t, dataKeyPair.PrivateKey())
+
+			ciphertext, err := dataKeyPair.Encrypt([]byte("sensor reading"))
+			require.NoError(t, err)
+
+			plaintext, err := awsKms.DecryptWithDataKeyPair(dataKeyPair.PrivateKeyCiphertextBlob, ciphertext)
+			require.NoError(t, err)
+			require.Equal(t, "sensor reading", string(plaintext))
+		})
+	}
+
+	t.Run("UnsupportedSpec", func(t *testing.T) {
+		_, err := awsKms.GenerateDataKeyPairWithoutPlaintext(types.DataKeyPairSpecSm2)
+		require.Error(t, err)
+	})
+
+	t.Run("AsymmetricWrappingKey", func(t *testing.T) {
+		other := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt))
+		_, err := other.GenerateDataKeyPairWithoutPlaintext(types.DataKeyPairSpecEccNistP256)
+		require.Error(t, err)
+	})
+}
+
+// TestAwsKms_GenerateDataKeyPair tests the plaintext private key matches the public key and is dropped once cleared
+//
+// TestAwsKms_GenerateDataKeyPair 测试明文私钥与公钥匹配，并在清除后被丢弃
+func TestAwsKms_GenerateDataKeyPair(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt))
+
+	dataKeyPair, err := awsKms.GenerateDataKeyPair(types.DataKeyPairSpecEccNistP256)
+	require.NoError(t, err)
+	privateKey, ok := dataKeyPair.PrivateKey().(*ecdsa.PrivateKey)
+	require.True(t, ok)
+	require.True(t, privateKey.PublicKey.Equal(dataKeyPair.PublicKey))
+
+	dataKeyPair.ClearPrivateKey()
+	require.Nil(t, dataKeyPair.PrivateKey())
+
+	ciphertext, err := dataKeyPair.Encrypt(bytes.Repeat([]byte("x"), 10000))
+	require.NoError(t, err)
+	plaintext, err := awsKms.DecryptWithDataKeyPair(dataKeyPair.PrivateKeyCiphertextBlob, ciphertext)
+	require.NoError(t, err)
+	require.Len(t, plaintext, 10000)
+}
+
+// TestAwsKms_UseDataKeyPairPrivateKey tests the unwrapped private key is handed to fn and the encryption context is enforced
+//
+// TestAwsKms_UseDataKeyPairPrivateKey 测试解包的私钥被交给 fn，并且加密上下文被强制校验
+func TestAwsKms_UseDataKeyPairPrivateKey(t *testing.T) {
+	ctx := context.Background()
+	fake := awskmstest.NewFakeKms()
+	awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt))
+	encryptionContext := map[string]string{"device": "sensor-1"}
+
+	dataKeyPair, err := awsKms.GenerateDataKeyPairWithoutPlaintextWithEncryptionContext(ctx, types.DataKeyPairSpecRsa2048, encryptionContext)
+	require.NoError(t, err)
+
+	err = awsKms.UseDataKeyPairPrivateKeyWithEncryptionContext(ctx, dataKeyPair.PrivateKeyCiphertextBlob, encryptionContext, func(privateKey crypto.PrivateKey) error {
+		used, ok := privateKey.(*rsa.PrivateKey)
+		require.True(t, ok)
+		require.True(t, used.PublicKey.Equal(dataKeyPair.PublicKey))
+		return nil
+	})
+	require.NoError(t, err)
+
+	ciphertext, err := dataKeyPair.Encrypt([]byte("sensor reading"))
+	require.NoError(t, err)
+	plaintext, err := awsKms.DecryptWithDataKeyPairWithEncryptionContext(ctx, dataKeyPair.PrivateKeyCiphertextBlob, encryptionContext, ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "sensor reading", string(plaintext))
+
+	t.Run("MissingEncryptionContext", func(t *testing.T) {
+		_, err := awsKms.DecryptWithDataKeyPair(dataKeyPair.PrivateKeyCiphertextBlob, ciphertext)
+		require.Error(t, err)
+	})
+
+	t.Run("CallbackError", func(t *testing.T) {
+		errCallback := errors.New("callback failed")
+		err := awsKms.UseDataKeyPairPrivateKeyWithEncryptionContext(ctx, dataKeyPair.PrivateKeyCiphertextBlob, encryptionContext, func(privateKey crypto.PrivateKey) error {
+			return errCallback
+		})
+		require.ErrorIs(t, err, errCallback)
+	})
+}
@@ -0,0 +1,305 @@
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyAgreementAPI defines the KMS operation used by ECIES decryption
+//
+// KeyAgreementAPI 定义 ECIES 解密使用的 KMS 操作
+type KeyAgreementAPI interface {
+	DeriveSharedSecret(ctx context.Context, params *kms.DeriveSharedSecretInput, optFns ...func(*kms.Options)) (*kms.DeriveSharedSecretOutput, error)
+}
+
+var _ KeyAgreementAPI = (*kms.Client)(nil)
+
+const (
+	eciesMagic    = "AKEC"                            // Magic bytes at the start of ECIES blobs // ECIES 密文块开头的魔数
+	eciesVersion1 = 0x01                              // ECIES layout: magic | version | uint16 len | ephemeral key | nonce | ciphertext // ECIES 格式版本
+	eciesHkdfInfo = "go-aws-kms ECIES AES-256-GCM v1" // HKDF info label, the ephemeral key is appended // HKDF info 标签，后接临时公钥
+)
+
+// FetchEciesEncrypter fetches the ECC public key via GetPublicKey and returns an offline ECIES encrypter
+// The public key is fetched once and kept, so later encryption makes no KMS calls
+//
+// FetchEciesEncrypter 通过 GetPublicKey 获取 ECC 公钥并返回离线 ECIES 加密器
+// 公钥只获取一次并被保存，之后的加密不再调用 KMS
+func (a *AwsKms) FetchEciesEncrypter() (*EciesEncrypter, error) {
+	return a.FetchEciesEncrypterContext(context.Background())
+}
+
+// FetchEciesEncrypterContext fetches the ECC public key with the given context and returns an offline ECIES encrypter
+// Checks the key is a KEY_AGREEMENT ECC_NIST_P256, P384 or P521 key which supports ECDH
+//
+// FetchEciesEncrypterContext 使用给定的上下文获取 ECC 公钥并返回离线 ECIES 加密器
+// 检查密钥是支持 ECDH 的 KEY_AGREEMENT 用途 ECC_NIST_P256、P384 或 P521 密钥
+func (a *AwsKms) FetchEciesEncrypterContext(ctx context.Context) (*EciesEncrypter, error) {
+	client, err := clientAs[PublicKeyAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: &a.encryptKeyID,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if res.KeyUsage != types.KeyUsageTypeKeyAgreement {
+		return nil, erero.Errorf("key usage %s is not KEY_AGREEMENT", res.KeyUsage)
+	}
+	if !slices.Contains(res.KeyAgreementAlgorithms, types.KeyAgreementAlgorithmSpecEcdh) {
+		return nil, erero.Errorf("key does not support key agreement algorithm %s", types.KeyAgreementAlgorithmSpecEcdh)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, erero.Errorf("key spec %s is not a NIST ECC key", res.KeySpec)
+	}
+	encrypter, err := NewEciesEncrypter(ecdsaPublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	encrypter.keyID = aws.ToString(res.KeyId)
+	return encrypter, nil
+}
+
+// DecryptEcies decrypts ECIES ciphertext from EciesEncrypter, deriving the shared secret through KMS DeriveSharedSecret
+// The private key never leaves KMS, only the ECDH shared secret of the ephemeral key is returned
+//
+// DecryptEcies 解密来自 EciesEncrypter 的 ECIES 密文，通过 KMS DeriveSharedSecret 派生共享密钥
+// 私钥不会离开 KMS，只返回与临时公钥的 ECDH 共享密钥
+func (a *AwsKms) DecryptEcies(ciphertext []byte) ([]byte, error) {
+	return a.DecryptEciesContext(context.Background(), ciphertext)
+}
+
+// DecryptEciesContext decrypts ECIES ciphertext with the given context
+//
+// DecryptEciesContext 使用给定的上下文解密 ECIES 密文
+func (a *AwsKms) DecryptEciesContext(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	blob, err := parseEciesBlob(ciphertext)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	client, err := clientAs[KeyAgreementAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.DeriveSharedSecret(ctx, &kms.DeriveSharedSecretInput{
+		KeyId:                 &a.encryptKeyID,
+		KeyAgreementAlgorithm: types.KeyAgreementAlgorithmSpecEcdh,
+		PublicKey:             blob.ephemeralKey,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(res.SharedSecret)
+
+	return blob.open(res.SharedSecret)
+}
+
+// DecryptsEcies decrypts base64 ECIES ciphertext through KMS and returns the plaintext string
+//
+// DecryptsEcies 通过 KMS 解密 base64 ECIES 密文并返回明文字符串
+func (a *AwsKms) DecryptsEcies(cipherText string) (string, error) {
+	return a.DecryptsEciesContext(context.Background(), cipherText)
+}
+
+// DecryptsEciesContext decrypts base64 ECIES ciphertext through KMS with the given context
+//
+// DecryptsEciesContext 使用给定的上下文通过 KMS 解密 base64 ECIES 密文
+func (a *AwsKms) DecryptsEciesContext(ctx context.Context, cipherText string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	plaintext, err := a.DecryptEciesContext(ctx, ciphertext)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return string(plaintext), nil
+}
+
+// EciesEncrypter encrypts locally to a KMS ECC key: ephemeral ECDH, HKDF-SHA256 and AES-256-GCM
+// Any sender holding the public key can encrypt, only the KMS key holder decrypts via DeriveSharedSecret
+// Safe in concurrent use across goroutines
+//
+// EciesEncrypter 在本地向 KMS ECC 密钥加密：临时 ECDH、HKDF-SHA256 和 AES-256-GCM
+// 任何持有公钥的发送方都可以加密，只有 KMS 密钥持有方通过 DeriveSharedSecret 解密
+// 可在多个 goroutine 中并发使用
+type EciesEncrypter struct {
+	publicKey *ecdh.PublicKey // ECDH public key of the KMS key // KMS 密钥的 ECDH 公钥
+	keyID     string          // Key ARN when fetched from KMS // 从 KMS 获取时的密钥 ARN
+}
+
+// NewEciesEncrypter creates EciesEncrypter from a NIST P-256, P-384 or P-521 public key distributed out of band
+// Use AwsKms.FetchEciesEncrypter when the public key should come from KMS GetPublicKey
+//
+// NewEciesEncrypter 使用通过其它渠道分发的 NIST P-256、P-384 或 P-521 公钥创建 EciesEncrypter
+// 需要从 KMS GetPublicKey 获取公钥时使用 AwsKms.FetchEciesEncrypter
+func NewEciesEncrypter(publicKey *ecdsa.PublicKey) (*EciesEncrypter, error) {
+	must.Nice(publicKey)
+
+	ecdhPublicKey, err := publicKey.ECDH()
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &EciesEncrypter{
+		publicKey: ecdhPublicKey,
+	}, nil
+}
+
+// Encrypt encrypts plaintext of any size locally, producing ciphertext that AwsKms.DecryptEcies decrypts
+// Each call uses a new ephemeral key, so equal plaintexts give unrelated ciphertexts
+//
+// Encrypt 在本地加密任意大小的明文，生成的密文可以由 AwsKms.DecryptEcies 解密
+// 每次调用使用新的临时密钥，相同的明文会得到无关的密文
+func (e *EciesEncrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	ephemeralPrivateKey, err := e.publicKey.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	sharedSecret, err := ephemeralPrivateKey.ECDH(e.publicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(sharedSecret)
+
+	ephemeralKey, err := x509.MarshalPKIXPublicKey(ephemeralPrivateKey.PublicKey())
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	contentKey, err := deriveEciesKey(sharedSecret, ephemeralKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(contentKey)
+
+	gcm, err := utils.NewAesGcm(contentKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	header := append([]byte(eciesMagic), eciesVersion1)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(ephemeralKey)))
+	header = append(header, ephemeralKey...)
+
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, erero.Wro(err)
+	}
+	sealed := gcm.Seal(nil, nonce, plaintext, header) // sealed apart, AEAD dst must not overlap the additional data // 单独加密，AEAD 的 dst 不能与附加数据重叠
+	blob := append(header, nonce...)
+	return append(blob, sealed...), nil
+}
+
+// Encrypts encrypts plaintext string locally and returns base64 outcome, decryptable with AwsKms.DecryptsEcies
+//
+// Encrypts 在本地加密明文字符串并返回 base64 结果，可以使用 AwsKms.DecryptsEcies 解密
+func (e *EciesEncrypter) Encrypts(plaintext string) (string, error) {
+	ciphertext, err := e.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// PublicKey returns the ECDH public key in use
+//
+// PublicKey 返回使用的 ECDH 公钥
+func (e *EciesEncrypter) PublicKey() *ecdh.PublicKey {
+	return e.publicKey
+}
+
+// KeyID returns the KMS key ARN when fetched from KMS, otherwise empty
+//
+// KeyID 从 KMS 获取时返回 KMS 密钥 ARN，否则为空
+func (e *EciesEncrypter) KeyID() string {
+	return e.keyID
+}
+
+// eciesBlob holds the parsed parts of an ECIES blob
+//
+// eciesBlob 保存解析后的 ECIES 密文块各部分
+type eciesBlob struct {
+	header       []byte // Authenticated header: magic | version | uint16 len | ephemeral key // 参与认证的头部
+	ephemeralKey []byte // DER SPKI of the ephemeral public key // 临时公钥的 DER SPKI
+	nonce        []byte // AES-GCM nonce // AES-GCM nonce
+	sealed       []byte // AES-GCM ciphertext with tag // 带认证标签的 AES-GCM 密文
+}
+
+// parseEciesBlob splits an ECIES blob, checking the magic, version and lengths
+//
+// parseEciesBlob 拆分 ECIES 密文块，并检查魔数、版本和长度
+func parseEciesBlob(blob []byte) (*eciesBlob, error) {
+	prefixSize := len(eciesMagic) + 1
+	if !bytes.HasPrefix(blob, []byte(eciesMagic)) || len(blob) < prefixSize+2 {
+		return nil, erero.New("blob is not ECIES ciphertext")
+	}
+	if blob[len(eciesMagic)] != eciesVersion1 {
+		return nil, erero.Errorf("ECIES version %d is not supported", blob[len(eciesMagic)])
+	}
+	keySize := int(binary.BigEndian.Uint16(blob[prefixSize:]))
+	headerSize := prefixSize + 2 + keySize
+	if len(blob) < headerSize+gcmNonceSize {
+		return nil, erero.New("ECIES ciphertext is truncated")
+	}
+	return &eciesBlob{
+		header:       blob[:headerSize],
+		ephemeralKey: blob[prefixSize+2 : headerSize],
+		nonce:        blob[headerSize : headerSize+gcmNonceSize],
+		sealed:       blob[headerSize+gcmNonceSize:],
+	}, nil
+}
+
+// open derives the content key from the ECDH shared secret and decrypts the payload
+//
+// open 根据 ECDH 共享密钥派生内容密钥并解密载荷
+func (b *eciesBlob) open(sharedSecret []byte) ([]byte, error) {
+	contentKey, err := deriveEciesKey(sharedSecret, b.ephemeralKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(contentKey)
+
+	gcm, err := utils.NewAesGcm(contentKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	plaintext, err := gcm.Open(nil, b.nonce, b.sealed, b.header)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return plaintext, nil
+}
+
+// deriveEciesKey derives the AES-256 content key with HKDF-SHA256, binding it to the ephemeral key
+//
+// deriveEciesKey 使用 HKDF-SHA256 派生 AES-256 内容密钥，并将其与临时公钥绑定
+func deriveEciesKey(sharedSecret []byte, ephemeralKey []byte) ([]byte, error) {
+	info := append([]byte(eciesHkdfInfo), ephemeralKey...)
+	contentKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, nil, info), contentKey); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return contentKey, nil
+}
@@ -0,0 +1,110 @@
+package awskms_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEciesEncrypter_Encrypt tests local ECIES encryption to P-256, P-384 and P-521 keys decrypts via DeriveSharedSecret
+//
+// TestEciesEncrypter_Encrypt 测试在本地向 P-256、P-384 和 P-521 密钥进行 ECIES 加密后可通过 DeriveSharedSecret 解密
+func TestEciesEncrypter_Encrypt(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	for _, keySpec := range []types.KeySpec{types.KeySpecEccNistP256, types.KeySpecEccNistP384, types.KeySpecEccNistP521} {
+		t.Run(string(keySpec), func(t *testing.T) {
+			awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(keySpec, types.KeyUsageTypeKeyAgreement))
+
+			encrypter, err := awsKms.FetchEciesEncrypter()
+			require.NoError(t, err)
+			require.Contains(t, encrypter.KeyID(), "arn:aws:kms:")
+
+			plaintext := bytes.Repeat([]byte("large message "), 1000)
+			ciphertext, err := encrypter.Encrypt(plaintext)
+			require.NoError(t, err)
+
+			other, err := encrypter.Encrypt(plaintext)
+			require.NoError(t, err)
+			require.NotEqual(t, ciphertext, other)
+
+			res, err := awsKms.DecryptEcies(ciphertext)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, res)
+		})
+	}
+}
+
+// TestEciesEncrypter_Encrypts tests base64 ECIES with an encrypter built from a PEM distributed public key
+//
+// TestEciesEncrypter_Encrypts 测试使用通过 PEM 分发的公钥创建的加密器进行 base64 ECIES 加密
+func TestEciesEncrypter_Encrypts(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeKeyAgreement))
+
+	fetched, err := awsKms.FetchEciesEncrypter()
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(fetched.PublicKey())
+	require.NoError(t, err)
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	require.NoError(t, err)
+
+	encrypter, err := awskms.NewEciesEncrypter(publicKey.(*ecdsa.PublicKey))
+	require.NoError(t, err)
+	require.Empty(t, encrypter.KeyID())
+
+	cipherText, err := encrypter.Encrypts("test message")
+	require.NoError(t, err)
+	res, err := awsKms.DecryptsEcies(cipherText)
+	require.NoError(t, err)
+	require.Equal(t, "test message", res)
+}
+
+// TestAwsKms_DecryptEcies tests tampered ciphertext, other keys and wrong key usages are rejected
+//
+// TestAwsKms_DecryptEcies 测试被篡改的密文、其它密钥和错误的密钥用途会被拒绝
+func TestAwsKms_DecryptEcies(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeKeyAgreement))
+	encrypter, err := awsKms.FetchEciesEncrypter()
+	require.NoError(t, err)
+	ciphertext, err := encrypter.Encrypt([]byte("test message"))
+	require.NoError(t, err)
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := bytes.Clone(ciphertext)
+		tampered[len(tampered)-1] ^= 0xff
+		_, err := awsKms.DecryptEcies(tampered)
+		require.Error(t, err)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := awsKms.DecryptEcies(ciphertext[:20])
+		require.Error(t, err)
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		other := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeKeyAgreement))
+		_, err := other.DecryptEcies(ciphertext)
+		require.Error(t, err)
+	})
+
+	t.Run("OtherCurve", func(t *testing.T) {
+		other := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecEccNistP384, types.KeyUsageTypeKeyAgreement))
+		_, err := other.DecryptEcies(ciphertext)
+		require.Error(t, err)
+	})
+
+	t.Run("SigningKey", func(t *testing.T) {
+		other := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify))
+		_, err := other.FetchEciesEncrypter()
+		require.Error(t, err)
+		_, err = other.DecryptEcies(ciphertext)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,167 @@
+package awskms
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// Ed25519 enum values of KMS, declared here since the pinned SDK predates them
+// The SDK sends enum values as plain strings, so these work against KMS as is
+//
+// KMS 的 Ed25519 枚举值，由于固定的 SDK 版本早于这些值而在此声明
+// SDK 以普通字符串发送枚举值，因此可以直接用于 KMS
+const (
+	KeySpecEccNistEdwards25519        types.KeySpec              = "ECC_NIST_EDWARDS25519" // Ed25519 key spec // Ed25519 密钥规格
+	SigningAlgorithmSpecEd25519Sha512 types.SigningAlgorithmSpec = "ED25519_SHA_512"       // Pure Ed25519 on RAW messages // 对 RAW 消息的纯 Ed25519
+)
+
+// AwsKmsEd25519Signer signs with an ECC_NIST_EDWARDS25519 KMS key, producing standard 64-byte Ed25519 signatures
+// Pure Ed25519 hashes the whole message inside KMS, so messages are limited to 4096 bytes
+// Verification runs locally with crypto/ed25519 after fetching the public key once
+//
+// AwsKmsEd25519Signer 使用 ECC_NIST_EDWARDS25519 KMS 密钥签名，生成标准的 64 字节 Ed25519 签名
+// 纯 Ed25519 在 KMS 内部对完整消息做哈希，因此消息长度限制为 4096 字节
+// 获取一次公钥后使用 crypto/ed25519 在本地校验
+type AwsKmsEd25519Signer struct {
+	client    SignerAPI         // AWS KMS client to handle API operations // AWS KMS 客户端用于处理 API 操作
+	signKeyID string            // KMS ID used in signing // 用于签名的 KMS ID
+	mutex     sync.Mutex        // Guards publicKey // 保护 publicKey
+	publicKey ed25519.PublicKey // Cached public key, nil until fetched // 缓存的公钥，获取前为 nil
+}
+
+// NewAwsKmsEd25519Signer creates AwsKmsEd25519Signer with given KMS client and Ed25519 key ID
+//
+// NewAwsKmsEd25519Signer 使用给定的 KMS 客户端和 Ed25519 密钥 ID 创建 AwsKmsEd25519Signer
+func NewAwsKmsEd25519Signer(client SignerAPI, signKeyID string) *AwsKmsEd25519Signer {
+	return &AwsKmsEd25519Signer{
+		client:    utils.MustClient(client),
+		signKeyID: must.Nice(signKeyID),
+	}
+}
+
+// SignMessage signs the message through KMS Sign with ED25519_SHA_512
+//
+// SignMessage 通过 KMS Sign 使用 ED25519_SHA_512 对消息签名
+func (s *AwsKmsEd25519Signer) SignMessage(message []byte) ([]byte, error) {
+	return s.SignMessageContext(context.Background(), message)
+}
+
+// SignMessageContext signs the message through KMS Sign with the given context
+//
+// SignMessageContext 使用给定的上下文通过 KMS Sign 对消息签名
+func (s *AwsKmsEd25519Signer) SignMessageContext(ctx context.Context, message []byte) ([]byte, error) {
+	if len(message) == 0 || len(message) > maxRawMessageSize {
+		return nil, erero.Errorf("message length %d is not between 1 and %d", len(message), maxRawMessageSize)
+	}
+	res, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            &s.signKeyID,
+		Message:          message,
+		MessageType:      types.MessageTypeRaw,
+		SigningAlgorithm: SigningAlgorithmSpecEd25519Sha512,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if len(res.Signature) != ed25519.SignatureSize {
+		return nil, erero.Errorf("signature length %d is not %d", len(res.Signature), ed25519.SignatureSize)
+	}
+	return res.Signature, nil
+}
+
+// VerifyMessage verifies the signature through KMS Verify
+// Returns false without exception when the signature does not match
+//
+// VerifyMessage 通过 KMS Verify 校验签名
+// 签名不匹配时返回 false 且不返回异常
+func (s *AwsKmsEd25519Signer) VerifyMessage(message []byte, signature []byte) (bool, error) {
+	return s.VerifyMessageContext(context.Background(), message, signature)
+}
+
+// VerifyMessageContext verifies the signature through KMS Verify with the given context
+//
+// VerifyMessageContext 使用给定的上下文通过 KMS Verify 校验签名
+func (s *AwsKmsEd25519Signer) VerifyMessageContext(ctx context.Context, message []byte, signature []byte) (bool, error) {
+	res, err := s.client.Verify(ctx, &kms.VerifyInput{
+		KeyId:            &s.signKeyID,
+		Message:          message,
+		MessageType:      types.MessageTypeRaw,
+		Signature:        signature,
+		SigningAlgorithm: SigningAlgorithmSpecEd25519Sha512,
+	})
+	if err != nil {
+		var invalidSignature *types.KMSInvalidSignatureException
+		if errors.As(err, &invalidSignature) {
+			return false, nil
+		}
+		return false, erero.Wro(err)
+	}
+	return res.SignatureValid, nil
+}
+
+// VerifyMessageLocal verifies the signature locally with crypto/ed25519 and the cached public key
+// Accepts messages of any length, since local verification has no KMS limit
+//
+// VerifyMessageLocal 使用 crypto/ed25519 和缓存的公钥在本地校验签名
+// 本地校验没有 KMS 的长度限制，可以接受任意长度的消息
+func (s *AwsKmsEd25519Signer) VerifyMessageLocal(message []byte, signature []byte) (bool, error) {
+	return s.VerifyMessageLocalContext(context.Background(), message, signature)
+}
+
+// VerifyMessageLocalContext verifies the signature locally, fetching the public key with the given context
+//
+// VerifyMessageLocalContext 在本地校验签名，使用给定的上下文获取公钥
+func (s *AwsKmsEd25519Signer) VerifyMessageLocalContext(ctx context.Context, message []byte, signature []byte) (bool, error) {
+	publicKey, err := s.PublicKeyContext(ctx)
+	if err != nil {
+		return false, erero.Wro(err)
+	}
+	return ed25519.Verify(publicKey, message, signature), nil
+}
+
+// PublicKey returns the Ed25519 public key, fetched via GetPublicKey once and cached
+//
+// PublicKey 返回 Ed25519 公钥，通过 GetPublicKey 获取一次并缓存
+func (s *AwsKmsEd25519Signer) PublicKey() (ed25519.PublicKey, error) {
+	return s.PublicKeyContext(context.Background())
+}
+
+// PublicKeyContext returns the cached Ed25519 public key, parsing the SPKI output of GetPublicKey on first use
+//
+// PublicKeyContext 返回缓存的 Ed25519 公钥，首次使用时解析 GetPublicKey 输出的 SPKI
+func (s *AwsKmsEd25519Signer) PublicKeyContext(ctx context.Context) (ed25519.PublicKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.publicKey != nil {
+		return s.publicKey, nil
+	}
+
+	res, err := s.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: &s.signKeyID,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if !slices.Contains(res.SigningAlgorithms, SigningAlgorithmSpecEd25519Sha512) {
+		return nil, erero.Errorf("key spec %s does not support %s", res.KeySpec, SigningAlgorithmSpecEd25519Sha512)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	ed25519PublicKey, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, erero.Errorf("public key type %T is not ed25519.PublicKey", publicKey)
+	}
+	s.publicKey = ed25519PublicKey
+	return ed25519PublicKey, nil
+}
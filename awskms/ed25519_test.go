@@ -0,0 +1,73 @@
+package awskms_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKmsEd25519Signer_SignMessage tests 64-byte Ed25519 signatures verified by KMS and crypto/ed25519
+//
+// TestAwsKmsEd25519Signer_SignMessage 测试 64 字节 Ed25519 签名可由 KMS 和 crypto/ed25519 校验
+func TestAwsKmsEd25519Signer_SignMessage(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	signer := awskms.NewAwsKmsEd25519Signer(fake, fake.MustCreateKey(awskms.KeySpecEccNistEdwards25519, types.KeyUsageTypeSignVerify))
+
+	signature, err := signer.SignMessage([]byte("test message"))
+	require.NoError(t, err)
+	require.Len(t, signature, ed25519.SignatureSize)
+
+	publicKey, err := signer.PublicKey()
+	require.NoError(t, err)
+	require.Len(t, publicKey, ed25519.PublicKeySize)
+	require.True(t, ed25519.Verify(publicKey, []byte("test message"), signature))
+
+	valid, err := signer.VerifyMessageLocal([]byte("test message"), signature)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	valid, err = signer.VerifyMessage([]byte("test message"), signature)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	valid, err = signer.VerifyMessage([]byte("test message!"), signature)
+	require.NoError(t, err)
+	require.False(t, valid)
+
+	t.Run("TooLong", func(t *testing.T) {
+		_, err := signer.SignMessage(bytes.Repeat([]byte("x"), 4097))
+		require.Error(t, err)
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		other := awskms.NewAwsKmsEd25519Signer(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify))
+		_, err := other.PublicKey()
+		require.Error(t, err)
+	})
+}
+
+// TestAwsKmsCryptoSigner_Ed25519 tests the crypto.Signer follows the ed25519.PrivateKey conventions
+//
+// TestAwsKmsCryptoSigner_Ed25519 测试 crypto.Signer 遵循 ed25519.PrivateKey 的约定
+func TestAwsKmsCryptoSigner_Ed25519(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	signer, err := awskms.NewAwsKmsCryptoSigner(fake, fake.MustCreateKey(awskms.KeySpecEccNistEdwards25519, types.KeyUsageTypeSignVerify))
+	require.NoError(t, err)
+	publicKey := signer.Public().(ed25519.PublicKey)
+
+	signature, err := signer.Sign(rand.Reader, []byte("test message"), crypto.Hash(0))
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(publicKey, []byte("test message"), signature))
+
+	_, err = signer.Sign(rand.Reader, []byte("test message"), crypto.SHA512)
+	require.Error(t, err)
+	_, err = signer.Sign(rand.Reader, []byte("test message"), &ed25519.Options{Context: "ctx"})
+	require.Error(t, err)
+}
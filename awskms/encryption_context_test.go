@@ -0,0 +1,128 @@
+package awskms_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKms_EncryptWithEncryptionContext tests that direct KMS operations bind the encryption context
+//
+// TestAwsKms_EncryptWithEncryptionContext 测试直接 KMS 操作绑定加密上下文
+func TestAwsKms_EncryptWithEncryptionContext(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+	ctx := context.Background()
+	encryptionContext := map[string]string{"tenant": "a", "purpose": "test"}
+
+	ciphertext, err := awsKms.EncryptWithEncryptionContext(ctx, []byte("test message"), encryptionContext)
+	require.NoError(t, err)
+
+	plaintext, err := awsKms.DecryptWithEncryptionContext(ctx, ciphertext, map[string]string{"purpose": "test", "tenant": "a"})
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	var invalid *types.InvalidCiphertextException
+	_, err = awsKms.DecryptWithEncryptionContext(ctx, ciphertext, map[string]string{"tenant": "b", "purpose": "test"})
+	require.ErrorAs(t, err, &invalid)
+
+	_, err = awsKms.Decrypt(ciphertext)
+	require.ErrorAs(t, err, &invalid)
+
+	cipherText, err := awsKms.EncryptsWithEncryptionContext(ctx, "test message", encryptionContext)
+	require.NoError(t, err)
+
+	res, err := awsKms.DecryptsWithEncryptionContext(ctx, cipherText, encryptionContext)
+	require.NoError(t, err)
+	require.Equal(t, "test message", res)
+
+	_, err = awsKms.DecryptsWithEncryptionContext(ctx, cipherText, nil)
+	require.ErrorAs(t, err, &invalid)
+}
+
+// TestAwsKms_EncryptEnvelopeWithEncryptionContext tests envelope and stream encryption bound to the encryption context
+//
+// TestAwsKms_EncryptEnvelopeWithEncryptionContext 测试绑定加密上下文的信封加密和流式加密
+func TestAwsKms_EncryptEnvelopeWithEncryptionContext(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+	ctx := context.Background()
+	encryptionContext := map[string]string{"tenant": "a"}
+
+	t.Run("Envelope", func(t *testing.T) {
+		envelopeBlob, err := awsKms.EncryptEnvelopeWithEncryptionContext(ctx, []byte("test message"), encryptionContext)
+		require.NoError(t, err)
+
+		plaintext, err := awsKms.DecryptEnvelopeWithEncryptionContext(ctx, envelopeBlob, encryptionContext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+
+		_, err = awsKms.DecryptEnvelopeWithEncryptionContext(ctx, envelopeBlob, map[string]string{"tenant": "b"})
+		require.Error(t, err)
+
+		_, err = awsKms.DecryptEnvelope(envelopeBlob)
+		require.Error(t, err)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		msg := bytes.Repeat([]byte("test message "), 10000)
+		stream := encryptStream(t, func(w io.Writer) (io.WriteCloser, error) {
+			return awsKms.NewEncryptWriterWithEncryptionContext(ctx, w, encryptionContext)
+		}, msg)
+
+		reader, err := awsKms.NewDecryptReaderWithEncryptionContext(ctx, bytes.NewReader(stream), encryptionContext)
+		require.NoError(t, err)
+		plaintext, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, msg, plaintext)
+
+		_, err = awsKms.NewDecryptReaderWithEncryptionContext(ctx, bytes.NewReader(stream), map[string]string{"tenant": "b"})
+		require.Error(t, err)
+	})
+}
+
+// TestCachedAwsKms_EncryptEnvelopeWithEncryptionContext tests that cached data keys are separated per encryption context
+// A cached unwrapped key must not let a blob decrypt under a different context
+//
+// TestCachedAwsKms_EncryptEnvelopeWithEncryptionContext 测试缓存的数据密钥按加密上下文隔离
+// 已缓存的解包密钥不能让密文块在不同的上下文下被解密
+func TestCachedAwsKms_EncryptEnvelopeWithEncryptionContext(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+	cached := awskms.NewCachedAwsKms(awsKms, awskms.NewCacheOptions().WithMaxEncryptEntries(2))
+	ctx := context.Background()
+	contextA := map[string]string{"tenant": "a"}
+	contextB := map[string]string{"tenant": "b"}
+
+	blobA, err := cached.EncryptEnvelopeWithEncryptionContext(ctx, []byte("message a"), contextA)
+	require.NoError(t, err)
+	blobB, err := cached.EncryptEnvelopeWithEncryptionContext(ctx, []byte("message b"), contextB)
+	require.NoError(t, err)
+	_, err = cached.EncryptEnvelopeWithEncryptionContext(ctx, []byte("message a"), contextA)
+	require.NoError(t, err)
+
+	stats := cached.Stats()
+	require.Equal(t, int64(2), stats.EncryptMisses)
+	require.Equal(t, int64(1), stats.EncryptHits)
+
+	plaintext, err := cached.DecryptEnvelopeWithEncryptionContext(ctx, blobA, contextA)
+	require.NoError(t, err)
+	require.Equal(t, "message a", string(plaintext))
+
+	_, err = cached.DecryptEnvelopeWithEncryptionContext(ctx, blobA, contextB)
+	require.Error(t, err)
+
+	_, err = cached.DecryptEnvelope(blobA)
+	require.Error(t, err)
+
+	plaintext, err = awsKms.DecryptEnvelopeWithEncryptionContext(ctx, blobB, contextB)
+	require.NoError(t, err)
+	require.Equal(t, "message b", string(plaintext))
+
+	// a third context pushes out the oldest encryption data key // 第三个上下文会淘汰最早的加密数据密钥
+	_, err = cached.EncryptEnvelopeWithEncryptionContext(ctx, []byte("message c"), map[string]string{"tenant": "c"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cached.Stats().Evictions)
+}
@@ -3,7 +3,9 @@ package awskms
 import (
 	"context"
 	"os"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
@@ -24,6 +26,8 @@ type EnvOptions struct {
 	SecretAccessKey string // Environment variable name to specify AWS secret access code // AWS 密钥访问码的环境变量名
 	SessionToken    string // Environment variable name to specify AWS session token // AWS 会话令牌的环境变量名
 	EncryptKeyID    string // Environment variable name to specify AWS KMS encrypt ID // AWS KMS 加密 ID 的环境变量名
+	EndpointURL     string // Environment variable name to specify custom KMS endpoint URL // 自定义 KMS 端点 URL 的环境变量名
+	ReplicaRegions  string // Environment variable name to specify comma separated replica region IDs // 以逗号分隔的副本区域 ID 的环境变量名
 }
 
 // NewEnvOptions creates EnvOptions with default environment variable names
@@ -38,6 +42,8 @@ func NewEnvOptions() *EnvOptions {
 		SecretAccessKey: "AWS_KMS_SECRET_KEY",
 		SessionToken:    "AWS_KMS_SESSION_TOKEN",
 		EncryptKeyID:    "AWS_KMS_ENCRYPT_KEY_ID",
+		EndpointURL:     "AWS_KMS_ENDPOINT_URL",
+		ReplicaRegions:  "AWS_KMS_REPLICA_REGION_IDS",
 	}
 }
 
@@ -91,26 +97,105 @@ func (op *EnvOptions) WithEncryptKeyID(keyName string) *EnvOptions {
 	return op
 }
 
+// WithEndpointURL sets custom environment variable name to specify KMS endpoint URL
+// Returns self in method chaining
+//
+// WithEndpointURL 设置 KMS 端点 URL 的自定义环境变量名
+// 返回自身以支持链式调用
+func (op *EnvOptions) WithEndpointURL(keyName string) *EnvOptions {
+	op.EndpointURL = keyName
+	return op
+}
+
+// WithReplicaRegions sets custom environment variable name to specify replica region IDs
+// Returns self in method chaining
+//
+// WithReplicaRegions 设置副本区域 ID 的自定义环境变量名
+// 返回自身以支持链式调用
+func (op *EnvOptions) WithReplicaRegions(keyName string) *EnvOptions {
+	op.ReplicaRegions = keyName
+	return op
+}
+
 // NewAwsKmsFromEnv creates AwsKms instance from environment variables using provided options
 // Reads AWS credentials, region, and encryption ID from environment variables specified in options
 // Validates required environment variables using must.Nice and returns exception when missing encryption ID
 // Configures AWS SDK v2 client with static credentials and creates ready-to-use AwsKms instance
+// Points the client at the custom endpoint URL when set, e.g. a local KMS emulator
 //
 // NewAwsKmsFromEnv 使用提供的选项从环境变量创建 AwsKms 实例
 // 从选项中指定的环境变量读取 AWS 凭证、区域和加密 ID
 // 使用 must.Nice 验证必需环境变量，对缺失的加密 ID 返回异常
 // 使用静态凭证配置 AWS SDK v2 客户端并创建可用的 AwsKms 实例
+// 设置了自定义端点 URL 时客户端指向该地址，例如本地 KMS 模拟器
 func NewAwsKmsFromEnv(options *EnvOptions) (*AwsKms, error) {
+	return NewAwsKmsFromEnvContext(context.Background(), options)
+}
+
+// NewAwsKmsFromEnvContext creates AwsKms instance from environment variables with the given context
+// Same as NewAwsKmsFromEnv but passes ctx to config.LoadDefaultConfig when loading AWS configuration
+//
+// NewAwsKmsFromEnvContext 使用给定的上下文从环境变量创建 AwsKms 实例
+// 与 NewAwsKmsFromEnv 相同，但在加载 AWS 配置时将 ctx 传递给 config.LoadDefaultConfig
+func NewAwsKmsFromEnvContext(ctx context.Context, options *EnvOptions) (*AwsKms, error) {
 	region := must.Nice(os.Getenv(options.RegionID))
-	accessKey := must.Nice(os.Getenv(options.AccessKeyID))
-	secretKey := must.Nice(os.Getenv(options.SecretAccessKey))
-	sessionToken := os.Getenv(options.SessionToken) // allow empty session token // 允许空会话令牌
 	encryptKeyID := os.Getenv(options.EncryptKeyID)
 	if encryptKeyID == "" {
 		return nil, erero.New("encrypt key ID environment variable is none")
 	}
+	client, err := newKmsClientFromEnv(ctx, options, region)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return NewAwsKms(client, encryptKeyID), nil
+}
+
+// NewMultiRegionAwsKmsFromEnv creates MultiRegionAwsKms from environment variables using provided options
+// The region ID is the local region, and replica region IDs add one client per region sharing the credentials
+// The encryption ID must name a multi-Region key, as an mrk- key ID or a key ARN
+//
+// NewMultiRegionAwsKmsFromEnv 使用提供的选项从环境变量创建 MultiRegionAwsKms
+// 区域 ID 作为本地区域，副本区域 ID 为每个区域添加一个共享凭证的客户端
+// 加密 ID 必须指向多区域密钥，可以是 mrk- 开头的 key ID 或 key ARN
+func NewMultiRegionAwsKmsFromEnv(options *EnvOptions, multiRegionOptions *MultiRegionOptions) (*MultiRegionAwsKms, error) {
+	return NewMultiRegionAwsKmsFromEnvContext(context.Background(), options, multiRegionOptions)
+}
+
+// NewMultiRegionAwsKmsFromEnvContext creates MultiRegionAwsKms from environment variables with the given context
+//
+// NewMultiRegionAwsKmsFromEnvContext 使用给定的上下文从环境变量创建 MultiRegionAwsKms
+func NewMultiRegionAwsKmsFromEnvContext(ctx context.Context, options *EnvOptions, multiRegionOptions *MultiRegionOptions) (*MultiRegionAwsKms, error) {
+	localRegion := must.Nice(os.Getenv(options.RegionID))
+	encryptKeyID := os.Getenv(options.EncryptKeyID)
+	if encryptKeyID == "" {
+		return nil, erero.New("encrypt key ID environment variable is none")
+	}
+
+	clients := map[string]KmsAPI{}
+	regions := append([]string{localRegion}, strings.Split(os.Getenv(options.ReplicaRegions), ",")...)
+	for _, region := range regions {
+		region = strings.TrimSpace(region)
+		if _, exists := clients[region]; exists || region == "" {
+			continue
+		}
+		client, err := newKmsClientFromEnv(ctx, options, region)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		clients[region] = client
+	}
+	return NewMultiRegionAwsKms(encryptKeyID, localRegion, clients, multiRegionOptions)
+}
+
+// newKmsClientFromEnv creates the KMS client in the region with credentials and endpoint URL from environment variables
+//
+// newKmsClientFromEnv 使用环境变量中的凭证和端点 URL 创建该区域的 KMS 客户端
+func newKmsClientFromEnv(ctx context.Context, options *EnvOptions, region string) (*kms.Client, error) {
+	accessKey := must.Nice(os.Getenv(options.AccessKeyID))
+	secretKey := must.Nice(os.Getenv(options.SecretAccessKey))
+	sessionToken := os.Getenv(options.SessionToken) // allow empty session token // 允许空会话令牌
 
-	cfg, err := config.LoadDefaultConfig(context.Background(),
+	cfg, err := config.LoadDefaultConfig(ctx,
 		config.WithRegion(region),
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			accessKey,
@@ -122,5 +207,11 @@ func NewAwsKmsFromEnv(options *EnvOptions) (*AwsKms, error) {
 		return nil, erero.Wro(err)
 	}
 
-	return NewAwsKms(kms.NewFromConfig(cfg), encryptKeyID), nil
+	var optFns []func(*kms.Options)
+	if endpointURL := os.Getenv(options.EndpointURL); endpointURL != "" {
+		optFns = append(optFns, func(o *kms.Options) {
+			o.BaseEndpoint = aws.String(endpointURL)
+		})
+	}
+	return kms.NewFromConfig(cfg, optFns...), nil
 }
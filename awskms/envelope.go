@@ -0,0 +1,255 @@
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+)
+
+const (
+	envelopeMagic    = "AKMS"                 // Magic bytes at the start of envelope blobs // 信封密文块开头的魔数
+	envelopeVersion1 = 0x01                   // Envelope layout: magic | version | wrapped key | nonce | ciphertext // 信封格式版本
+	envelopePrefixV1 = envelopeMagic + "\x01" // Prefix of version 1 envelope blobs // 版本 1 信封密文块的前缀
+	gcmNonceSize     = 12                     // AES-GCM standard nonce size // AES-GCM 标准 nonce 长度
+)
+
+// DataKeyAPI defines the KMS operations used by envelope, header, stream, cache and keyring encryption
+//
+// DataKeyAPI 定义信封、版本头、流式、缓存和密钥环加密使用的 KMS 操作
+type DataKeyAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+}
+
+var _ DataKeyAPI = (*kms.Client)(nil)
+
+// EncryptEnvelope encrypts plaintext of any size using envelope encryption
+// Generates an AES-256 data key via KMS GenerateDataKey and encrypts locally with AES-256-GCM
+// Returns a self-describing blob holding the wrapped data key, nonce and ciphertext
+//
+// EncryptEnvelope 使用信封加密方式加密任意大小的明文
+// 通过 KMS GenerateDataKey 生成 AES-256 数据密钥，并在本地使用 AES-256-GCM 加密
+// 返回包含被包装的数据密钥、nonce 和密文的自描述密文块
+func (a *AwsKms) EncryptEnvelope(plaintext []byte) ([]byte, error) {
+	return a.EncryptEnvelopeContext(context.Background(), plaintext)
+}
+
+// EncryptEnvelopeContext encrypts plaintext using envelope encryption with the given context
+// Only one KMS call is made no matter the plaintext size, and the data key is zeroed after use
+//
+// EncryptEnvelopeContext 使用给定的上下文以信封加密方式加密明文
+// 无论明文大小只调用一次 KMS，数据密钥用完后会被清零
+func (a *AwsKms) EncryptEnvelopeContext(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return a.EncryptEnvelopeWithEncryptionContext(ctx, plaintext, nil)
+}
+
+// EncryptEnvelopeWithEncryptionContext encrypts plaintext using envelope encryption bound to the encryption context
+// The data key is generated with the context, so KMS only unwraps it when the same context is given
+//
+// EncryptEnvelopeWithEncryptionContext 以信封加密方式加密明文并绑定加密上下文
+// 数据密钥使用该上下文生成，只有传入相同上下文时 KMS 才会解包
+func (a *AwsKms) EncryptEnvelopeWithEncryptionContext(ctx context.Context, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	client, err := clientAs[DataKeyAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             &a.encryptKeyID,
+		KeySpec:           types.DataKeySpecAes256,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(res.Plaintext)
+
+	return sealEnvelope([]byte(envelopePrefixV1), res.Plaintext, res.CiphertextBlob, plaintext)
+}
+
+// DecryptEnvelope decrypts a blob produced by EncryptEnvelope
+// Unwraps the data key via KMS Decrypt and decrypts the payload locally with AES-256-GCM
+// Returns exception when the blob is malformed or has been tampered with
+//
+// DecryptEnvelope 解密由 EncryptEnvelope 生成的密文块
+// 通过 KMS Decrypt 解包数据密钥，并在本地使用 AES-256-GCM 解密载荷
+// 密文块格式错误或被篡改时返回异常
+func (a *AwsKms) DecryptEnvelope(envelopeBlob []byte) ([]byte, error) {
+	return a.DecryptEnvelopeContext(context.Background(), envelopeBlob)
+}
+
+// DecryptEnvelopeContext decrypts a blob produced by EncryptEnvelope with the given context
+// The unwrapped data key is zeroed after use
+//
+// DecryptEnvelopeContext 使用给定的上下文解密由 EncryptEnvelope 生成的密文块
+// 解包出的数据密钥用完后会被清零
+func (a *AwsKms) DecryptEnvelopeContext(ctx context.Context, envelopeBlob []byte) ([]byte, error) {
+	return a.DecryptEnvelopeWithEncryptionContext(ctx, envelopeBlob, nil)
+}
+
+// DecryptEnvelopeWithEncryptionContext decrypts an envelope blob expecting the given encryption context
+// KMS rejects unwrapping the data key when the context does not match the one used at encryption
+//
+// DecryptEnvelopeWithEncryptionContext 使用期望的加密上下文解密信封密文块
+// 上下文与加密时使用的不一致时，KMS 会拒绝解包数据密钥
+func (a *AwsKms) DecryptEnvelopeWithEncryptionContext(ctx context.Context, envelopeBlob []byte, encryptionContext map[string]string) ([]byte, error) {
+	envelope, err := parseEnvelope(envelopeBlob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := a.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    envelope.wrappedKey,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(res.Plaintext)
+
+	return envelope.open(res.Plaintext)
+}
+
+// envelopeBlob holds the parsed parts of an envelope blob
+//
+// envelopeBlob 保存解析后的信封密文块各部分
+type envelopeBlob struct {
+	header     *CiphertextHeader // Parsed header of the blob // 解析后的密文块头部
+	wrappedKey []byte            // Data key encrypted by KMS // 由 KMS 加密的数据密钥
+	nonce      []byte            // AES-GCM nonce // AES-GCM nonce
+	sealed     []byte            // AES-GCM ciphertext with tag // 带认证标签的 AES-GCM 密文
+}
+
+// sealEnvelope builds the envelope blob: prefix | uint16 len | wrapped key | nonce | sealed
+// The prefix is the version 1 magic and version, or a version 2 ciphertext header
+// Only magic, version and mode are AES-GCM additional data, the wrapped key is authenticated by KMS
+// so ReEncrypt can replace it without touching the payload
+//
+// sealEnvelope 构造信封密文块：前缀 | uint16 长度 | 被包装的密钥 | nonce | 密文
+// 前缀是版本 1 的魔数和版本号，或者版本 2 的密文头部
+// 只有魔数、版本和模式作为 AES-GCM 附加数据，被包装的密钥由 KMS 认证
+// 因此 ReEncrypt 可以替换被包装的密钥而无需改动载荷
+func sealEnvelope(prefix []byte, dataKey []byte, wrappedKey []byte, plaintext []byte) ([]byte, error) {
+	header, _, err := parseCiphertextHeader(prefix)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	gcm, err := utils.NewAesGcm(dataKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return buildEnvelope(prefix, wrappedKey, nonce, gcm.Seal(nil, nonce, plaintext, envelopeAdditionalData(header)))
+}
+
+// buildEnvelope concatenates prefix | uint16 len | wrapped key | nonce | sealed
+//
+// buildEnvelope 拼接 前缀 | uint16 长度 | 被包装的密钥 | nonce | 密文
+func buildEnvelope(prefix []byte, wrappedKey []byte, nonce []byte, sealed []byte) ([]byte, error) {
+	if len(wrappedKey) == 0 || len(wrappedKey) > 0xFFFF {
+		return nil, erero.Errorf("wrapped data key length %d is out of range", len(wrappedKey))
+	}
+	blob := make([]byte, 0, len(prefix)+2+len(wrappedKey)+len(nonce)+len(sealed))
+	blob = append(blob, prefix...)
+	blob = binary.BigEndian.AppendUint16(blob, uint16(len(wrappedKey)))
+	blob = append(blob, wrappedKey...)
+	blob = append(blob, nonce...)
+	return append(blob, sealed...), nil
+}
+
+// envelopeAdditionalData returns the AES-GCM additional data: magic | version, plus mode on version 2
+// The key reference and wrapped key are left out, they change when the blob is re-encrypted
+//
+// envelopeAdditionalData 返回 AES-GCM 附加数据：魔数 | 版本，版本 2 再加上模式
+// 密钥引用和被包装的密钥不包含在内，它们会在重新加密时改变
+func envelopeAdditionalData(header *CiphertextHeader) []byte {
+	additionalData := append([]byte(envelopeMagic), header.Version)
+	if header.Version == envelopeVersion2 {
+		additionalData = append(additionalData, byte(header.Mode))
+	}
+	return additionalData
+}
+
+// parseEnvelope splits an envelope blob into its parts without decrypting
+// Accepts version 1 envelope blobs and version 2 blobs in envelope mode
+//
+// parseEnvelope 将信封密文块拆分为各部分，不做解密
+// 接受版本 1 的信封密文块和信封模式的版本 2 密文块
+func parseEnvelope(blob []byte) (*envelopeBlob, error) {
+	if !isEnvelope(blob) {
+		return nil, erero.New("blob is not an envelope blob")
+	}
+	header, offset, err := parseCiphertextHeader(blob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if header.Mode != CiphertextModeEnvelope {
+		return nil, erero.Errorf("ciphertext mode %d is not envelope mode", header.Mode)
+	}
+	rest := blob[offset:]
+	if len(rest) < 2 {
+		return nil, erero.New("envelope blob is truncated")
+	}
+	size := int(binary.BigEndian.Uint16(rest[:2]))
+	rest = rest[2:]
+	if size == 0 || len(rest) < size+gcmNonceSize {
+		return nil, erero.New("envelope blob is truncated")
+	}
+	return &envelopeBlob{
+		header:     header,
+		wrappedKey: rest[:size],
+		nonce:      rest[size : size+gcmNonceSize],
+		sealed:     rest[size+gcmNonceSize:],
+	}, nil
+}
+
+// open decrypts the envelope payload with the unwrapped data key
+//
+// open 使用解包后的数据密钥解密信封载荷
+func (e *envelopeBlob) open(dataKey []byte) ([]byte, error) {
+	gcm, err := utils.NewAesGcm(dataKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	plaintext, err := gcm.Open(nil, e.nonce, e.sealed, envelopeAdditionalData(e.header))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return plaintext, nil
+}
+
+// isEnvelope reports whether the blob starts with the envelope magic bytes
+//
+// isEnvelope 判断密文块是否以信封魔数开头
+func isEnvelope(blob []byte) bool {
+	return bytes.HasPrefix(blob, []byte(envelopeMagic))
+}
+
+// encryptionContextKey encodes the encryption context into a canonical string usable as map key
+// Names are sorted and every name and value is length prefixed so distinct contexts never collide
+//
+// encryptionContextKey 将加密上下文编码为可用作 map 键的规范字符串
+// 名称排序且每个名称和值都带长度前缀，不同的上下文不会冲突
+func encryptionContextKey(encryptionContext map[string]string) string {
+	names := make([]string, 0, len(encryptionContext))
+	for name := range encryptionContext {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var data []byte
+	for _, name := range names {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(name)))
+		data = append(data, name...)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(encryptionContext[name])))
+		data = append(data, encryptionContext[name]...)
+	}
+	return string(data)
+}
@@ -0,0 +1,80 @@
+package awskms_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeAwsKms creates AwsKms backed by a fresh FakeKms with one symmetric key
+//
+// newFakeAwsKms 创建基于新 FakeKms 和一个对称密钥的 AwsKms
+func newFakeAwsKms(t *testing.T) (*awskms.AwsKms, *awskmstest.FakeKms) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	return awskms.NewAwsKms(fake, keyID), fake
+}
+
+// TestAwsKms_EncryptEnvelope tests envelope encryption of payloads above the 4 KB KMS limit
+//
+// TestAwsKms_EncryptEnvelope 测试超过 KMS 4 KB 限制的载荷的信封加密
+func TestAwsKms_EncryptEnvelope(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+
+	msg := make([]byte, 1<<20)
+	_, err := rand.Read(msg)
+	require.NoError(t, err)
+
+	_, err = awsKms.Encrypt(msg)
+	require.Error(t, err) // direct KMS encryption caps at 4 KB // 直接 KMS 加密上限为 4 KB
+
+	envelopeBlob, err := awsKms.EncryptEnvelope(msg)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(envelopeBlob, []byte("AKMS")))
+
+	plaintext, err := awsKms.DecryptEnvelope(envelopeBlob)
+	require.NoError(t, err)
+	require.Equal(t, msg, plaintext)
+}
+
+// TestAwsKms_DecryptEnvelope tests that malformed and tampered envelope blobs are rejected
+//
+// TestAwsKms_DecryptEnvelope 测试格式错误和被篡改的信封密文块会被拒绝
+func TestAwsKms_DecryptEnvelope(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+
+	envelopeBlob, err := awsKms.EncryptEnvelope([]byte("test message"))
+	require.NoError(t, err)
+
+	t.Run("Empty", func(t *testing.T) {
+		blob, err := awsKms.EncryptEnvelope(nil)
+		require.NoError(t, err)
+
+		res, err := awsKms.DecryptEnvelope(blob)
+		require.NoError(t, err)
+		require.Empty(t, res)
+	})
+
+	t.Run("NotEnvelope", func(t *testing.T) {
+		_, err := awsKms.DecryptEnvelope([]byte("not an envelope"))
+		require.Error(t, err)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := awsKms.DecryptEnvelope(envelopeBlob[:20])
+		require.Error(t, err)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := bytes.Clone(envelopeBlob)
+		tampered[len(tampered)-1] ^= 0x01
+
+		_, err := awsKms.DecryptEnvelope(tampered)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,232 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/yyle88/erero"
+)
+
+const envelopeVersion2 = 0x02 // Header layout: magic | version | mode | uint16 len | key reference // 头部格式版本
+
+// CiphertextMode tells how the payload after a version 2 header is encrypted
+//
+// CiphertextMode 表示版本 2 头部之后的载荷的加密方式
+type CiphertextMode byte
+
+const (
+	CiphertextModeDirect   CiphertextMode = 0x01 // Payload is a KMS ciphertext blob // 载荷是 KMS 密文块
+	CiphertextModeEnvelope CiphertextMode = 0x02 // Payload is a wrapped data key and AES-256-GCM ciphertext // 载荷是被包装的数据密钥和 AES-256-GCM 密文
+	CiphertextModeKeyring  CiphertextMode = 0x03 // Payload is the data key wrapped by each Keyring key and AES-256-GCM ciphertext // 载荷是由 Keyring 每个密钥包装的数据密钥和 AES-256-GCM 密文
+)
+
+// CiphertextHeader describes a self-describing ciphertext produced by the EncryptWithHeader methods
+// Version 1 envelope blobs are reported with Mode envelope and an empty KeyRef
+//
+// CiphertextHeader 描述由 EncryptWithHeader 系列方法生成的自描述密文
+// 版本 1 的信封密文块会被报告为信封模式，KeyRef 为空
+type CiphertextHeader struct {
+	Version byte           // Format version // 格式版本
+	Mode    CiphertextMode // Payload encryption mode // 载荷加密方式
+	KeyRef  string         // KMS key ARN used at encryption, informational // 加密时使用的 KMS 密钥 ARN，仅供参考
+}
+
+// ParseCiphertextHeader reads the header of a blob produced by EncryptWithHeader or EncryptEnvelope
+// Returns exception when the blob is a legacy header-less KMS ciphertext or is malformed
+//
+// ParseCiphertextHeader 读取由 EncryptWithHeader 或 EncryptEnvelope 生成的密文块的头部
+// 密文块是旧的无头部 KMS 密文或格式错误时返回异常
+func ParseCiphertextHeader(blob []byte) (*CiphertextHeader, error) {
+	header, _, err := parseCiphertextHeader(blob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return header, nil
+}
+
+// EncryptWithHeader encrypts plaintext bytes into a versioned self-describing blob
+// The blob starts with magic | version | mode | key reference, so the format can evolve
+// Decrypt and Decrypts recognize these blobs and still accept legacy header-less ciphertext
+//
+// EncryptWithHeader 将明文字节加密为带版本的自描述密文块
+// 密文块以 魔数 | 版本 | 模式 | 密钥引用 开头，便于格式演进
+// Decrypt 和 Decrypts 能识别这种密文块，同时仍接受旧的无头部密文
+func (a *AwsKms) EncryptWithHeader(plaintext []byte, mode CiphertextMode) ([]byte, error) {
+	return a.EncryptWithHeaderContext(context.Background(), plaintext, mode)
+}
+
+// EncryptWithHeaderContext encrypts plaintext bytes into a versioned blob with the given context
+//
+// EncryptWithHeaderContext 使用给定的上下文将明文字节加密为带版本的密文块
+func (a *AwsKms) EncryptWithHeaderContext(ctx context.Context, plaintext []byte, mode CiphertextMode) ([]byte, error) {
+	return a.EncryptWithHeaderEncryptionContext(ctx, plaintext, mode, nil)
+}
+
+// EncryptWithHeaderEncryptionContext encrypts plaintext bytes into a versioned blob bound to the encryption context
+// Direct mode calls KMS Encrypt and is limited to 4 KB, envelope mode accepts any size
+//
+// EncryptWithHeaderEncryptionContext 将明文字节加密为带版本的密文块并绑定加密上下文
+// 直接模式调用 KMS Encrypt，限制为 4 KB，信封模式接受任意大小
+func (a *AwsKms) EncryptWithHeaderEncryptionContext(ctx context.Context, plaintext []byte, mode CiphertextMode, encryptionContext map[string]string) ([]byte, error) {
+	switch mode {
+	case CiphertextModeDirect:
+		res, err := a.client.Encrypt(ctx, &kms.EncryptInput{
+			KeyId:             &a.encryptKeyID,
+			Plaintext:         plaintext,
+			EncryptionContext: encryptionContext,
+		})
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		prefix, err := appendCiphertextHeader(nil, mode, a.keyRef(res.KeyId))
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return append(prefix, res.CiphertextBlob...), nil
+	case CiphertextModeEnvelope:
+		client, err := clientAs[DataKeyAPI](a.client)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		res, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+			KeyId:             &a.encryptKeyID,
+			KeySpec:           types.DataKeySpecAes256,
+			EncryptionContext: encryptionContext,
+		})
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		defer clear(res.Plaintext)
+
+		prefix, err := appendCiphertextHeader(nil, mode, a.keyRef(res.KeyId))
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return sealEnvelope(prefix, res.Plaintext, res.CiphertextBlob, plaintext)
+	default:
+		return nil, erero.Errorf("ciphertext mode %d is not supported", mode)
+	}
+}
+
+// EncryptsWithHeader encrypts plaintext string into a base64 encoded versioned blob
+//
+// EncryptsWithHeader 将明文字符串加密为 base64 编码的带版本密文块
+func (a *AwsKms) EncryptsWithHeader(plaintext string, mode CiphertextMode) (string, error) {
+	return a.EncryptsWithHeaderContext(context.Background(), plaintext, mode)
+}
+
+// EncryptsWithHeaderContext encrypts plaintext string into a base64 versioned blob with the given context
+//
+// EncryptsWithHeaderContext 使用给定的上下文将明文字符串加密为 base64 带版本密文块
+func (a *AwsKms) EncryptsWithHeaderContext(ctx context.Context, plaintext string, mode CiphertextMode) (string, error) {
+	return a.EncryptsWithHeaderEncryptionContext(ctx, plaintext, mode, nil)
+}
+
+// EncryptsWithHeaderEncryptionContext encrypts plaintext string into a base64 versioned blob bound to the encryption context
+//
+// EncryptsWithHeaderEncryptionContext 将明文字符串加密为 base64 带版本密文块并绑定加密上下文
+func (a *AwsKms) EncryptsWithHeaderEncryptionContext(ctx context.Context, plaintext string, mode CiphertextMode, encryptionContext map[string]string) (string, error) {
+	blob, err := a.EncryptWithHeaderEncryptionContext(ctx, []byte(plaintext), mode, encryptionContext)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return base64.StdEncoding.EncodeToString(blob), nil
+}
+
+// decryptWithHeader decrypts a blob starting with the envelope magic bytes
+// Dispatches on the header mode, version 1 envelope blobs included
+//
+// decryptWithHeader 解密以信封魔数开头的密文块
+// 按头部模式分派处理，包括版本 1 的信封密文块
+func (a *AwsKms) decryptWithHeader(ctx context.Context, blob []byte, encryptionContext map[string]string) ([]byte, error) {
+	header, offset, err := parseCiphertextHeader(blob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	switch header.Mode {
+	case CiphertextModeDirect:
+		res, err := a.client.Decrypt(ctx, &kms.DecryptInput{
+			CiphertextBlob:    blob[offset:],
+			EncryptionContext: encryptionContext,
+		})
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return res.Plaintext, nil
+	case CiphertextModeEnvelope:
+		return a.DecryptEnvelopeWithEncryptionContext(ctx, blob, encryptionContext)
+	case CiphertextModeKeyring:
+		plaintext, _, err := NewKeyring(a).DecryptWithEncryptionContext(ctx, blob, encryptionContext)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return plaintext, nil
+	default:
+		return nil, erero.Errorf("ciphertext mode %d is not supported", header.Mode)
+	}
+}
+
+// keyRef returns the key ARN reported by KMS, falling back to the configured encryption ID
+//
+// keyRef 返回 KMS 报告的密钥 ARN，没有时回退到配置的加密 ID
+func (a *AwsKms) keyRef(keyID *string) string {
+	if keyRef := aws.ToString(keyID); keyRef != "" {
+		return keyRef
+	}
+	return a.encryptKeyID
+}
+
+// appendCiphertextHeader appends magic | version 2 | mode | uint16 len | key reference to blob
+//
+// appendCiphertextHeader 向 blob 追加 魔数 | 版本 2 | 模式 | uint16 长度 | 密钥引用
+func appendCiphertextHeader(blob []byte, mode CiphertextMode, keyRef string) ([]byte, error) {
+	if len(keyRef) > 0xFFFF {
+		return nil, erero.Errorf("key reference length %d is out of range", len(keyRef))
+	}
+	blob = append(blob, envelopeMagic...)
+	blob = append(blob, envelopeVersion2, byte(mode))
+	blob = binary.BigEndian.AppendUint16(blob, uint16(len(keyRef)))
+	return append(blob, keyRef...), nil
+}
+
+// parseCiphertextHeader parses the header and returns the offset where the payload starts
+// Version 1 blobs carry no mode or key reference, their payload starts right after the version byte
+//
+// parseCiphertextHeader 解析头部并返回载荷开始的偏移量
+// 版本 1 的密文块不包含模式和密钥引用，载荷紧跟在版本字节之后
+func parseCiphertextHeader(blob []byte) (*CiphertextHeader, int, error) {
+	if !isEnvelope(blob) {
+		return nil, 0, erero.New("blob has no ciphertext header")
+	}
+	rest := blob[len(envelopeMagic):]
+	if len(rest) < 1 {
+		return nil, 0, erero.New("ciphertext header is truncated")
+	}
+	switch rest[0] {
+	case envelopeVersion1:
+		return &CiphertextHeader{
+			Version: envelopeVersion1,
+			Mode:    CiphertextModeEnvelope,
+		}, len(envelopeMagic) + 1, nil
+	case envelopeVersion2:
+		if len(rest) < 4 {
+			return nil, 0, erero.New("ciphertext header is truncated")
+		}
+		mode := CiphertextMode(rest[1])
+		size := int(binary.BigEndian.Uint16(rest[2:4]))
+		if len(rest) < 4+size {
+			return nil, 0, erero.New("ciphertext header is truncated")
+		}
+		return &CiphertextHeader{
+			Version: envelopeVersion2,
+			Mode:    mode,
+			KeyRef:  string(rest[4 : 4+size]),
+		}, len(envelopeMagic) + 4 + size, nil
+	default:
+		return nil, 0, erero.Errorf("ciphertext header version %d is not supported", rest[0])
+	}
+}
@@ -0,0 +1,128 @@
+package awskms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKms_EncryptWithHeader tests versioned blobs in both modes decrypting through plain Decrypt
+//
+// TestAwsKms_EncryptWithHeader 测试两种模式的带版本密文块都能通过普通 Decrypt 解密
+func TestAwsKms_EncryptWithHeader(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+
+	for _, mode := range []awskms.CiphertextMode{awskms.CiphertextModeDirect, awskms.CiphertextModeEnvelope} {
+		blob, err := awsKms.EncryptWithHeader([]byte("test message"), mode)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(blob, []byte("AKMS")))
+
+		header, err := awskms.ParseCiphertextHeader(blob)
+		require.NoError(t, err)
+		require.Equal(t, byte(2), header.Version)
+		require.Equal(t, mode, header.Mode)
+		require.True(t, strings.HasPrefix(header.KeyRef, "arn:aws:kms:"))
+
+		plaintext, err := awsKms.Decrypt(blob)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	}
+
+	t.Run("EnvelopeLargePayload", func(t *testing.T) {
+		msg := bytes.Repeat([]byte("x"), 1<<20)
+
+		_, err := awsKms.EncryptWithHeader(msg, awskms.CiphertextModeDirect)
+		require.Error(t, err)
+
+		blob, err := awsKms.EncryptWithHeader(msg, awskms.CiphertextModeEnvelope)
+		require.NoError(t, err)
+
+		plaintext, err := awsKms.DecryptEnvelope(blob)
+		require.NoError(t, err)
+		require.Equal(t, msg, plaintext)
+	})
+
+	t.Run("UnknownMode", func(t *testing.T) {
+		_, err := awsKms.EncryptWithHeader([]byte("test message"), awskms.CiphertextMode(9))
+		require.Error(t, err)
+	})
+
+	t.Run("InformationalKeyRef", func(t *testing.T) {
+		blob, err := awsKms.EncryptWithHeader([]byte("test message"), awskms.CiphertextModeEnvelope)
+		require.NoError(t, err)
+
+		edited := bytes.Clone(blob)
+		edited[10] ^= 0x01 // inside the key reference, not part of the AES-GCM additional data // 位于密钥引用内，不属于 AES-GCM 附加数据
+		plaintext, err := awsKms.Decrypt(edited)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	})
+
+	t.Run("TamperedVersion", func(t *testing.T) {
+		blob, err := awsKms.EncryptWithHeader([]byte("test message"), awskms.CiphertextModeEnvelope)
+		require.NoError(t, err)
+
+		header, err := awskms.ParseCiphertextHeader(blob)
+		require.NoError(t, err)
+		wrappedKeyStart := 8 + len(header.KeyRef)
+
+		tampered := append([]byte("AKMS\x01"), blob[wrappedKeyStart:]...) // payload moved behind a version 1 prefix // 载荷移到版本 1 前缀之后
+		_, err = awsKms.Decrypt(tampered)
+		require.Error(t, err)
+	})
+}
+
+// TestAwsKms_Decrypts_Legacy tests that Decrypts handles legacy, versioned and version 1 envelope blobs
+//
+// TestAwsKms_Decrypts_Legacy 测试 Decrypts 能处理旧格式、带版本和版本 1 信封的密文块
+func TestAwsKms_Decrypts_Legacy(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+	ctx := context.Background()
+
+	legacy, err := awsKms.Encrypts("test message")
+	require.NoError(t, err)
+
+	_, err = awskms.ParseCiphertextHeader(must64(t, legacy))
+	require.Error(t, err)
+
+	direct, err := awsKms.EncryptsWithHeader("test message", awskms.CiphertextModeDirect)
+	require.NoError(t, err)
+
+	envelope, err := awsKms.EncryptsWithHeaderEncryptionContext(ctx, "test message", awskms.CiphertextModeEnvelope, map[string]string{"tenant": "a"})
+	require.NoError(t, err)
+
+	envelopeV1, err := awsKms.EncryptEnvelope([]byte("test message"))
+	require.NoError(t, err)
+
+	for _, cipherText := range []string{legacy, direct, base64.StdEncoding.EncodeToString(envelopeV1)} {
+		res, err := awsKms.Decrypts(cipherText)
+		require.NoError(t, err)
+		require.Equal(t, "test message", res)
+	}
+
+	res, err := awsKms.DecryptsWithEncryptionContext(ctx, envelope, map[string]string{"tenant": "a"})
+	require.NoError(t, err)
+	require.Equal(t, "test message", res)
+
+	_, err = awsKms.Decrypts(envelope)
+	require.Error(t, err)
+
+	header, err := awskms.ParseCiphertextHeader(envelopeV1)
+	require.NoError(t, err)
+	require.Equal(t, byte(1), header.Version)
+	require.Equal(t, awskms.CiphertextModeEnvelope, header.Mode)
+}
+
+// must64 decodes base64 text in tests
+//
+// must64 在测试中解码 base64 文本
+func must64(t *testing.T, text string) []byte {
+	data, err := base64.StdEncoding.DecodeString(text)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,378 @@
+package awskms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// Keyring encrypts data under multiple AwsKms keys so that any one of them can decrypt it
+// Envelope encryption wraps a single data key under every key in the ring
+// Keys may live in different accounts or regions, keeping data decryptable when one becomes unavailable
+//
+// Keyring 使用多个 AwsKms 密钥加密数据，其中任意一个都能解密
+// 信封加密使用环中的每个密钥包装同一个数据密钥
+// 密钥可以位于不同的账号或区域，某个密钥不可用时数据仍可解密
+type Keyring struct {
+	members []*AwsKms // Keys in preference order, the first one generates the data key // 按优先顺序排列的密钥，第一个生成数据密钥
+}
+
+// NewKeyring creates a Keyring over the given AwsKms instances in preference order
+// The first member generates the data key and every other member wraps it
+//
+// NewKeyring 按优先顺序使用给定的 AwsKms 实例创建 Keyring
+// 第一个成员生成数据密钥，其它每个成员包装该数据密钥
+func NewKeyring(members ...*AwsKms) *Keyring {
+	must.True(len(members) > 0)
+	for _, member := range members {
+		must.Nice(member)
+	}
+	return &Keyring{members: members}
+}
+
+// KeyIDs returns the configured encryption IDs of the members in preference order
+//
+// KeyIDs 按优先顺序返回各成员配置的加密 ID
+func (k *Keyring) KeyIDs() []string {
+	keyIDs := make([]string, 0, len(k.members))
+	for _, member := range k.members {
+		keyIDs = append(keyIDs, member.encryptKeyID)
+	}
+	return keyIDs
+}
+
+// Encrypt encrypts plaintext of any size, wrapping the data key under every key in the ring
+// Fails when any key cannot wrap the data key, so each blob is decryptable by all of them
+//
+// Encrypt 加密任意大小的明文，使用环中的每个密钥包装数据密钥
+// 任一密钥无法包装数据密钥时失败，确保每个密文块都能被所有密钥解密
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	return k.EncryptContext(context.Background(), plaintext)
+}
+
+// EncryptContext encrypts plaintext under every key in the ring with the given context
+//
+// EncryptContext 使用给定的上下文在环中的每个密钥下加密明文
+func (k *Keyring) EncryptContext(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return k.EncryptWithEncryptionContext(ctx, plaintext, nil)
+}
+
+// EncryptWithEncryptionContext encrypts plaintext under every key in the ring bound to the encryption context
+// Makes one GenerateDataKey call with the first key and one Encrypt call with each other key
+//
+// EncryptWithEncryptionContext 在环中的每个密钥下加密明文并绑定加密上下文
+// 使用第一个密钥调用一次 GenerateDataKey，其它每个密钥各调用一次 Encrypt
+func (k *Keyring) EncryptWithEncryptionContext(ctx context.Context, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	generator := k.members[0]
+	client, err := clientAs[DataKeyAPI](generator.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             &generator.encryptKeyID,
+		KeySpec:           types.DataKeySpecAes256,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wrapf(err, "generate data key with %s", generator.encryptKeyID)
+	}
+	defer clear(res.Plaintext)
+
+	wrappings := make([]keyringWrapping, 0, len(k.members))
+	wrappings = append(wrappings, keyringWrapping{
+		keyRef:     generator.keyRef(res.KeyId),
+		wrappedKey: res.CiphertextBlob,
+	})
+	for _, member := range k.members[1:] {
+		wrapped, err := member.client.Encrypt(ctx, &kms.EncryptInput{
+			KeyId:             &member.encryptKeyID,
+			Plaintext:         res.Plaintext,
+			EncryptionContext: encryptionContext,
+		})
+		if err != nil {
+			return nil, erero.Wrapf(err, "wrap data key with %s", member.encryptKeyID)
+		}
+		wrappings = append(wrappings, keyringWrapping{
+			keyRef:     member.keyRef(wrapped.KeyId),
+			wrappedKey: wrapped.CiphertextBlob,
+		})
+	}
+	return sealKeyring(wrappings, res.Plaintext, plaintext)
+}
+
+// Decrypt decrypts a blob produced by Encrypt, returning the plaintext and the ARN of the key that unwrapped it
+// Members are tried in preference order, and a member failing to unwrap falls through to the next one
+//
+// Decrypt 解密由 Encrypt 生成的密文块，返回明文和解包所用密钥的 ARN
+// 按优先顺序尝试各成员，某个成员无法解包时转到下一个成员
+func (k *Keyring) Decrypt(keyringBlob []byte) ([]byte, string, error) {
+	return k.DecryptContext(context.Background(), keyringBlob)
+}
+
+// DecryptContext decrypts a blob produced by Encrypt with the given context
+//
+// DecryptContext 使用给定的上下文解密由 Encrypt 生成的密文块
+func (k *Keyring) DecryptContext(ctx context.Context, keyringBlob []byte) ([]byte, string, error) {
+	return k.DecryptWithEncryptionContext(ctx, keyringBlob, nil)
+}
+
+// DecryptWithEncryptionContext decrypts a keyring blob expecting the given encryption context
+// Each member first tries the wrapping recorded under its own key, then the others
+// Returns the errors of all members joined when none of them can unwrap the data key
+//
+// DecryptWithEncryptionContext 使用期望的加密上下文解密密钥环密文块
+// 每个成员先尝试以自身密钥记录的包装，再尝试其它包装
+// 所有成员都无法解包数据密钥时返回合并后的各成员错误
+func (k *Keyring) DecryptWithEncryptionContext(ctx context.Context, keyringBlob []byte, encryptionContext map[string]string) ([]byte, string, error) {
+	blob, err := parseKeyring(keyringBlob)
+	if err != nil {
+		return nil, "", erero.Wro(err)
+	}
+	var errs []error
+	for _, member := range k.members {
+		dataKey, keyID, err := member.unwrapKeyring(ctx, blob.wrappings, encryptionContext)
+		if err != nil {
+			errs = append(errs, erero.Wrapf(err, "unwrap data key with %s", member.encryptKeyID))
+			continue
+		}
+		plaintext, err := blob.open(dataKey)
+		clear(dataKey)
+		if err != nil {
+			return nil, "", erero.Wro(err)
+		}
+		return plaintext, keyID, nil
+	}
+	return nil, "", erero.Wro(errors.Join(errs...))
+}
+
+// Encrypts encrypts plaintext string into a base64 encoded keyring blob
+//
+// Encrypts 将明文字符串加密为 base64 编码的密钥环密文块
+func (k *Keyring) Encrypts(plaintext string) (string, error) {
+	return k.EncryptsContext(context.Background(), plaintext)
+}
+
+// EncryptsContext encrypts plaintext string into a base64 keyring blob with the given context
+//
+// EncryptsContext 使用给定的上下文将明文字符串加密为 base64 密钥环密文块
+func (k *Keyring) EncryptsContext(ctx context.Context, plaintext string) (string, error) {
+	blob, err := k.EncryptContext(ctx, []byte(plaintext))
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return base64.StdEncoding.EncodeToString(blob), nil
+}
+
+// Decrypts decrypts a base64 encoded keyring blob, returning the plaintext string and the ARN of the key used
+//
+// Decrypts 解密 base64 编码的密钥环密文块，返回明文字符串和所用密钥的 ARN
+func (k *Keyring) Decrypts(cipherText string) (string, string, error) {
+	return k.DecryptsContext(context.Background(), cipherText)
+}
+
+// DecryptsContext decrypts a base64 encoded keyring blob with the given context
+//
+// DecryptsContext 使用给定的上下文解密 base64 编码的密钥环密文块
+func (k *Keyring) DecryptsContext(ctx context.Context, cipherText string) (string, string, error) {
+	blob, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", "", erero.Wro(err)
+	}
+	plaintext, keyID, err := k.DecryptContext(ctx, blob)
+	if err != nil {
+		return "", "", erero.Wro(err)
+	}
+	return string(plaintext), keyID, nil
+}
+
+// unwrapKeyring tries the wrappings with this key, the ones recorded under it first
+// IncorrectKeyException and InvalidCiphertextException move on to the next wrapping, other errors stop at once
+//
+// unwrapKeyring 使用该密钥尝试各个包装，优先尝试以该密钥记录的包装
+// IncorrectKeyException 和 InvalidCiphertextException 时转到下一个包装，其它错误立即停止
+func (a *AwsKms) unwrapKeyring(ctx context.Context, wrappings []keyringWrapping, encryptionContext map[string]string) ([]byte, string, error) {
+	ordered := make([]keyringWrapping, 0, len(wrappings))
+	for _, wrapping := range wrappings {
+		if a.matchesKeyRef(wrapping.keyRef) {
+			ordered = append(ordered, wrapping)
+		}
+	}
+	for _, wrapping := range wrappings {
+		if !a.matchesKeyRef(wrapping.keyRef) {
+			ordered = append(ordered, wrapping)
+		}
+	}
+
+	var lastErr error
+	for _, wrapping := range ordered {
+		res, err := a.client.Decrypt(ctx, &kms.DecryptInput{
+			KeyId:             &a.encryptKeyID,
+			CiphertextBlob:    wrapping.wrappedKey,
+			EncryptionContext: encryptionContext,
+		})
+		if err != nil {
+			var incorrectKey *types.IncorrectKeyException
+			var invalidCiphertext *types.InvalidCiphertextException
+			if errors.As(err, &incorrectKey) || errors.As(err, &invalidCiphertext) {
+				lastErr = err
+				continue
+			}
+			return nil, "", erero.Wro(err)
+		}
+		return res.Plaintext, a.keyRef(res.KeyId), nil
+	}
+	return nil, "", erero.Wro(lastErr)
+}
+
+// matchesKeyRef reports whether the recorded key reference names the configured encryption ID
+// Matches the ARN itself, or a key ID or alias at the end of the ARN
+//
+// matchesKeyRef 判断记录的密钥引用是否指向配置的加密 ID
+// 匹配 ARN 本身，或者位于 ARN 末尾的密钥 ID 或别名
+func (a *AwsKms) matchesKeyRef(keyRef string) bool {
+	return keyRef == a.encryptKeyID || strings.HasSuffix(keyRef, "/"+a.encryptKeyID)
+}
+
+// keyringWrapping is the data key wrapped by one key of the ring
+//
+// keyringWrapping 是由环中某个密钥包装的数据密钥
+type keyringWrapping struct {
+	keyRef     string // ARN of the wrapping key, informational // 包装密钥的 ARN，仅供参考
+	wrappedKey []byte // Data key encrypted by KMS // 由 KMS 加密的数据密钥
+}
+
+// keyringBlob holds the parsed parts of a keyring blob
+//
+// keyringBlob 保存解析后的密钥环密文块各部分
+type keyringBlob struct {
+	header    []byte            // Authenticated header: ciphertext header | wrappings // 参与认证的头部
+	wrappings []keyringWrapping // Data key wrapped by each key // 由每个密钥包装的数据密钥
+	nonce     []byte            // AES-GCM nonce // AES-GCM nonce
+	sealed    []byte            // AES-GCM ciphertext with tag // 带认证标签的 AES-GCM 密文
+}
+
+// sealKeyring builds the keyring blob: ciphertext header | uint16 count | wrappings | nonce | sealed
+// Each wrapping is uint16 len | key reference | uint16 len | wrapped key
+// The header references the first key and is used with the wrappings as AES-GCM additional data
+//
+// sealKeyring 构造密钥环密文块：密文头部 | uint16 数量 | 各包装 | nonce | 密文
+// 每个包装为 uint16 长度 | 密钥引用 | uint16 长度 | 被包装的密钥
+// 头部引用第一个密钥，并与各包装一起作为 AES-GCM 附加数据
+func sealKeyring(wrappings []keyringWrapping, dataKey []byte, plaintext []byte) ([]byte, error) {
+	blob, err := appendCiphertextHeader(nil, CiphertextModeKeyring, wrappings[0].keyRef)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	blob = binary.BigEndian.AppendUint16(blob, uint16(len(wrappings)))
+	for _, wrapping := range wrappings {
+		if len(wrapping.keyRef) > 0xFFFF {
+			return nil, erero.Errorf("key reference length %d is out of range", len(wrapping.keyRef))
+		}
+		if len(wrapping.wrappedKey) == 0 || len(wrapping.wrappedKey) > 0xFFFF {
+			return nil, erero.Errorf("wrapped data key length %d is out of range", len(wrapping.wrappedKey))
+		}
+		blob = binary.BigEndian.AppendUint16(blob, uint16(len(wrapping.keyRef)))
+		blob = append(blob, wrapping.keyRef...)
+		blob = binary.BigEndian.AppendUint16(blob, uint16(len(wrapping.wrappedKey)))
+		blob = append(blob, wrapping.wrappedKey...)
+	}
+
+	gcm, err := utils.NewAesGcm(dataKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, erero.Wro(err)
+	}
+	sealed := gcm.Seal(nil, nonce, plaintext, blob) // sealed apart, AEAD dst must not overlap the additional data // 单独加密，AEAD 的 dst 不能与附加数据重叠
+	blob = append(blob, nonce...)
+	return append(blob, sealed...), nil
+}
+
+// parseKeyring splits a keyring blob into its parts without decrypting
+//
+// parseKeyring 将密钥环密文块拆分为各部分，不做解密
+func parseKeyring(blob []byte) (*keyringBlob, error) {
+	header, offset, err := parseCiphertextHeader(blob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if header.Mode != CiphertextModeKeyring {
+		return nil, erero.Errorf("ciphertext mode %d is not keyring mode", header.Mode)
+	}
+	rest := blob[offset:]
+	if len(rest) < 2 {
+		return nil, erero.New("keyring blob is truncated")
+	}
+	count := int(binary.BigEndian.Uint16(rest[:2]))
+	rest = rest[2:]
+	if count == 0 {
+		return nil, erero.New("keyring blob has no wrapped data key")
+	}
+
+	wrappings := make([]keyringWrapping, 0, count)
+	for range count {
+		keyRef, next, ok := cutLengthPrefixed(rest)
+		if !ok {
+			return nil, erero.New("keyring blob is truncated")
+		}
+		wrappedKey, next, ok := cutLengthPrefixed(next)
+		if !ok || len(wrappedKey) == 0 {
+			return nil, erero.New("keyring blob is truncated")
+		}
+		wrappings = append(wrappings, keyringWrapping{
+			keyRef:     string(keyRef),
+			wrappedKey: wrappedKey,
+		})
+		rest = next
+	}
+	if len(rest) < gcmNonceSize {
+		return nil, erero.New("keyring blob is truncated")
+	}
+	headerSize := len(blob) - len(rest)
+	return &keyringBlob{
+		header:    blob[:headerSize],
+		wrappings: wrappings,
+		nonce:     rest[:gcmNonceSize],
+		sealed:    rest[gcmNonceSize:],
+	}, nil
+}
+
+// open decrypts the keyring payload with the unwrapped data key
+//
+// open 使用解包后的数据密钥解密密钥环载荷
+func (b *keyringBlob) open(dataKey []byte) ([]byte, error) {
+	gcm, err := utils.NewAesGcm(dataKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	plaintext, err := gcm.Open(nil, b.nonce, b.sealed, b.header)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return plaintext, nil
+}
+
+// cutLengthPrefixed splits a uint16 length prefixed field from the front of data
+//
+// cutLengthPrefixed 从 data 开头切出一个 uint16 长度前缀的字段
+func cutLengthPrefixed(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 2 {
+		return nil, nil, false
+	}
+	size := int(binary.BigEndian.Uint16(data[:2]))
+	if len(data) < 2+size {
+		return nil, nil, false
+	}
+	return data[2 : 2+size], data[2+size:], true
+}
@@ -0,0 +1,171 @@
+package awskms_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeKeyring creates a Keyring over one key in each of two separate FakeKms regions
+//
+// newFakeKeyring 创建由两个独立 FakeKms 区域中各一个密钥组成的 Keyring
+func newFakeKeyring(t *testing.T) (*awskms.Keyring, []*awskmstest.FakeKms, []string) {
+	t.Helper()
+	fakes := []*awskmstest.FakeKms{
+		awskmstest.NewFakeKmsWithRegion("us-east-1"),
+		awskmstest.NewFakeKmsWithRegion("eu-west-1"),
+	}
+	keyIDs := make([]string, 0, len(fakes))
+	members := make([]*awskms.AwsKms, 0, len(fakes))
+	for _, fake := range fakes {
+		keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+		keyIDs = append(keyIDs, keyID)
+		members = append(members, awskms.NewAwsKms(fake, keyID))
+	}
+	return awskms.NewKeyring(members...), fakes, keyIDs
+}
+
+// TestKeyring_Encrypt tests every key in the ring can decrypt on its own and the key used is reported
+//
+// TestKeyring_Encrypt 测试环中的每个密钥都能单独解密，并报告所用的密钥
+func TestKeyring_Encrypt(t *testing.T) {
+	keyring, fakes, keyIDs := newFakeKeyring(t)
+	require.Equal(t, keyIDs, keyring.KeyIDs())
+
+	plaintext := bytes.Repeat([]byte("large message "), 1000)
+	blob, err := keyring.Encrypt(plaintext)
+	require.NoError(t, err)
+
+	header, err := awskms.ParseCiphertextHeader(blob)
+	require.NoError(t, err)
+	require.Equal(t, awskms.CiphertextModeKeyring, header.Mode)
+	require.Contains(t, header.KeyRef, "us-east-1")
+
+	res, keyID, err := keyring.Decrypt(blob)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, res)
+	require.Contains(t, keyID, "us-east-1")
+
+	for idx, fake := range fakes {
+		awsKms := awskms.NewAwsKms(fake, keyIDs[idx])
+		res, keyID, err := awskms.NewKeyring(awsKms).Decrypt(blob)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, res)
+		require.Contains(t, keyID, keyIDs[idx])
+
+		// AwsKms.Decrypt recognizes keyring blobs // AwsKms.Decrypt 能识别密钥环密文块
+		res, err = awsKms.Decrypt(blob)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, res)
+	}
+}
+
+// TestKeyring_Decrypt tests decryption falls through to the next key when the preferred key is unavailable
+//
+// TestKeyring_Decrypt 测试首选密钥不可用时解密转到下一个密钥
+func TestKeyring_Decrypt(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Disabled", func(t *testing.T) {
+		keyring, fakes, keyIDs := newFakeKeyring(t)
+		blob, err := keyring.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		_, err = fakes[0].DisableKey(ctx, &kms.DisableKeyInput{KeyId: &keyIDs[0]})
+		require.NoError(t, err)
+
+		res, keyID, err := keyring.Decrypt(blob)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(res))
+		require.Contains(t, keyID, "eu-west-1")
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		keyring, fakes, _ := newFakeKeyring(t)
+		cipherText, err := keyring.Encrypts("test message")
+		require.NoError(t, err)
+
+		fakes[0].FailNext(1, &types.KMSInternalException{})
+		res, keyID, err := keyring.Decrypts(cipherText)
+		require.NoError(t, err)
+		require.Equal(t, "test message", res)
+		require.Contains(t, keyID, "eu-west-1")
+	})
+
+	t.Run("AllUnavailable", func(t *testing.T) {
+		keyring, fakes, _ := newFakeKeyring(t)
+		blob, err := keyring.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		for _, fake := range fakes {
+			fake.FailNext(1, &types.KMSInternalException{})
+		}
+		_, _, err = keyring.Decrypt(blob)
+		require.Error(t, err)
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		keyring, fakes, _ := newFakeKeyring(t)
+		blob, err := keyring.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		other := awskms.NewAwsKms(fakes[0], fakes[0].MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt))
+		_, _, err = awskms.NewKeyring(other).Decrypt(blob)
+		require.Error(t, err)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		keyring, _, _ := newFakeKeyring(t)
+		blob, err := keyring.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		tampered := bytes.Clone(blob)
+		tampered[len(tampered)-1] ^= 0xff
+		_, _, err = keyring.Decrypt(tampered)
+		require.Error(t, err)
+
+		_, _, err = keyring.Decrypt(blob[:len(blob)/2])
+		require.Error(t, err)
+	})
+}
+
+// TestKeyring_EncryptWithEncryptionContext tests every wrapping is bound to the encryption context
+//
+// TestKeyring_EncryptWithEncryptionContext 测试每个包装都绑定加密上下文
+func TestKeyring_EncryptWithEncryptionContext(t *testing.T) {
+	ctx := context.Background()
+	keyring, fakes, keyIDs := newFakeKeyring(t)
+	encryptionContext := map[string]string{"tenant": "acme"}
+
+	blob, err := keyring.EncryptWithEncryptionContext(ctx, []byte("test message"), encryptionContext)
+	require.NoError(t, err)
+
+	res, _, err := keyring.DecryptWithEncryptionContext(ctx, blob, encryptionContext)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(res))
+
+	_, _, err = keyring.Decrypt(blob)
+	require.Error(t, err)
+
+	_, err = fakes[0].DisableKey(ctx, &kms.DisableKeyInput{KeyId: &keyIDs[0]})
+	require.NoError(t, err)
+	_, _, err = keyring.DecryptWithEncryptionContext(ctx, blob, map[string]string{"tenant": "other"})
+	require.Error(t, err)
+	res, keyID, err := keyring.DecryptWithEncryptionContext(ctx, blob, encryptionContext)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(res))
+	require.Contains(t, keyID, keyIDs[1])
+
+	t.Run("WrapFailure", func(t *testing.T) {
+		keyring, fakes, _ := newFakeKeyring(t)
+		fakes[1].FailNext(1, &types.KMSInternalException{})
+		_, err := keyring.EncryptWithEncryptionContext(ctx, []byte("test message"), encryptionContext)
+		require.Error(t, err)
+	})
+}
@@ -12,12 +12,32 @@ package awskms
 import (
 	"context"
 	"encoding/base64"
+	"reflect"
 
 	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
 	"github.com/yyle88/erero"
 	"github.com/yyle88/must"
 )
 
+// KmsAPI defines the AWS KMS operations every AwsKms needs: Encrypt and Decrypt
+// Satisfied by *kms.Client, and also by fakes, wrappers and decorators in tests and middleware
+// Method signatures match the AWS SDK v2 client so implementations can delegate directly
+// AwsKms features using further operations require narrower interfaces like DataKeyAPI and ReEncryptAPI
+// and return exception when the injected client does not implement them, so KmsAPI itself stays stable
+//
+// KmsAPI 定义每个 AwsKms 都需要的 AWS KMS 操作：Encrypt 和 Decrypt
+// *kms.Client 满足该接口，测试和中间件中的假实现、包装器和装饰器也可以满足
+// 方法签名与 AWS SDK v2 客户端一致，便于实现直接委托
+// 使用更多操作的 AwsKms 功能需要 DataKeyAPI 和 ReEncryptAPI 等更窄的接口
+// 注入的客户端未实现时返回异常，因此 KmsAPI 本身保持稳定
+type KmsAPI interface {
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+var _ KmsAPI = (*kms.Client)(nil)
+
 // AwsKms provides encryption and decryption operations using AWS KMS
 // Wraps AWS KMS client to enable convenient encrypt/decrypt operations
 // Maintains encryption ID and client instance in seamless cryptographic operations
@@ -26,24 +46,33 @@ import (
 // 封装 AWS KMS 客户端以提供便捷的加解密操作
 // 维护加密 ID 和客户端实例以实现无缝加密操作
 type AwsKms struct {
-	client       *kms.Client // AWS KMS client to handle API operations // AWS KMS 客户端用于处理 API 操作
-	encryptKeyID string      // KMS ID used in encryption // 用于加密的 KMS ID
+	client       KmsAPI // AWS KMS client to handle API operations // AWS KMS 客户端用于处理 API 操作
+	encryptKeyID string // KMS ID used in encryption // 用于加密的 KMS ID
 }
 
 // NewAwsKms creates a new AwsKms instance with given KMS client and encryption ID
-// Validates client address using must.Full and ID using must.Nice to ensure input safe
+// Accepts any KmsAPI implementation, including *kms.Client and test fakes
+// Rejects nil clients, typed nil pointers included, and validates ID using must.Nice
 // Returns configured AwsKms instance suited in encryption and decryption operations
 //
 // NewAwsKms 使用给定的 KMS 客户端和加密 ID 创建新的 AwsKms 实例
-// 使用 must.Full 验证客户端地址和 must.Nice 验证 ID 以确保输入安全
+// 接受任意 KmsAPI 实现，包括 *kms.Client 和测试用的假实现
+// 拒绝 nil 客户端（包括带类型的 nil 指针），并使用 must.Nice 验证 ID
 // 返回配置好的 AwsKms 实例，适用于加密和解密操作
-func NewAwsKms(client *kms.Client, encryptKeyID string) *AwsKms {
+func NewAwsKms(client KmsAPI, encryptKeyID string) *AwsKms {
 	return &AwsKms{
-		client:       must.Full(client),
+		client:       utils.MustClient(client),
 		encryptKeyID: must.Nice(encryptKeyID),
 	}
 }
 
+// KeyID returns the configured encryption ID
+//
+// KeyID 返回配置的加密 ID
+func (a *AwsKms) KeyID() string {
+	return a.encryptKeyID
+}
+
 // Encrypt encrypts plaintext bytes using AWS KMS with configured encryption ID
 // Calls AWS KMS Encrypt API and wraps exception with erero in enhanced context
 // Returns encrypted ciphertext blob suitable in storage and transmission
@@ -52,9 +81,32 @@ func NewAwsKms(client *kms.Client, encryptKeyID string) *AwsKms {
 // 调用 AWS KMS Encrypt API 并使用 erero 包装异常以增强上下文
 // 返回适合存储和传输的加密密文块
 func (a *AwsKms) Encrypt(plaintext []byte) ([]byte, error) {
-	res, err := a.client.Encrypt(context.Background(), &kms.EncryptInput{
-		KeyId:     &a.encryptKeyID,
-		Plaintext: plaintext,
+	return a.EncryptContext(context.Background(), plaintext)
+}
+
+// EncryptContext encrypts plaintext bytes using AWS KMS with the given context
+// Passes ctx through to the KMS Encrypt API so callers can cancel and set deadlines
+// Returns encrypted ciphertext blob and wraps exception with erero in enhanced context
+//
+// EncryptContext 使用给定的上下文通过 AWS KMS 加密明文字节
+// 将 ctx 传递给 KMS Encrypt API，调用方可以取消请求和设置超时
+// 返回加密的密文块并使用 erero 包装异常以增强上下文
+func (a *AwsKms) EncryptContext(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return a.EncryptWithEncryptionContext(ctx, plaintext, nil)
+}
+
+// EncryptWithEncryptionContext encrypts plaintext bytes bound to the given encryption context
+// KMS binds the context to the ciphertext as additional authenticated data
+// The same context must be passed to DecryptWithEncryptionContext, otherwise KMS rejects the ciphertext
+//
+// EncryptWithEncryptionContext 加密明文字节并绑定给定的加密上下文
+// KMS 将加密上下文作为附加认证数据绑定到密文
+// 解密时必须向 DecryptWithEncryptionContext 传入相同的上下文，否则 KMS 会拒绝该密文
+func (a *AwsKms) EncryptWithEncryptionContext(ctx context.Context, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	res, err := a.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             &a.encryptKeyID,
+		Plaintext:         plaintext,
+		EncryptionContext: encryptionContext,
 	})
 	if err != nil {
 		return nil, erero.Wro(err)
@@ -70,8 +122,36 @@ func (a *AwsKms) Encrypt(plaintext []byte) ([]byte, error) {
 // KMS 从密文元数据中自动检测用于解密的加密 ID
 // 返回解密的明文字节并使用 erero 包装异常以增强上下文
 func (a *AwsKms) Decrypt(ciphertextBlob []byte) ([]byte, error) {
-	res, err := a.client.Decrypt(context.Background(), &kms.DecryptInput{
-		CiphertextBlob: ciphertextBlob,
+	return a.DecryptContext(context.Background(), ciphertextBlob)
+}
+
+// DecryptContext decrypts ciphertext blob using AWS KMS with the given context
+// Passes ctx through to the KMS Decrypt API so callers can cancel and set deadlines
+// Returns decrypted plaintext bytes and wraps exception with erero in enhanced context
+//
+// DecryptContext 使用给定的上下文通过 AWS KMS 解密密文块
+// 将 ctx 传递给 KMS Decrypt API，调用方可以取消请求和设置超时
+// 返回解密的明文字节并使用 erero 包装异常以增强上下文
+func (a *AwsKms) DecryptContext(ctx context.Context, ciphertextBlob []byte) ([]byte, error) {
+	return a.DecryptWithEncryptionContext(ctx, ciphertextBlob, nil)
+}
+
+// DecryptWithEncryptionContext decrypts ciphertext blob expecting the given encryption context
+// KMS does not return the context, it verifies it against the ciphertext and rejects any mismatch
+// Returns InvalidCiphertextException (wrapped) when the blob was bound to another context
+// Blobs with a ciphertext header are detected and decoded, legacy header-less blobs go to KMS as is
+//
+// DecryptWithEncryptionContext 使用期望的加密上下文解密密文块
+// KMS 不会返回加密上下文，而是将其与密文进行校验并拒绝任何不匹配
+// 密文块绑定的是其它上下文时返回（被包装的）InvalidCiphertextException
+// 带密文头部的密文块会被识别并解码，旧的无头部密文块原样发送给 KMS
+func (a *AwsKms) DecryptWithEncryptionContext(ctx context.Context, ciphertextBlob []byte, encryptionContext map[string]string) ([]byte, error) {
+	if isEnvelope(ciphertextBlob) {
+		return a.decryptWithHeader(ctx, ciphertextBlob, encryptionContext)
+	}
+	res, err := a.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    ciphertextBlob,
+		EncryptionContext: encryptionContext,
 	})
 	if err != nil {
 		return nil, erero.Wro(err)
@@ -87,7 +167,25 @@ func (a *AwsKms) Decrypt(ciphertextBlob []byte) ([]byte, error) {
 // 将字符串转换为字节，使用 KMS 加密，并将结果编码为 base64 格式
 // 返回 base64 编码的密文字符串，适用于基于文本的存储和传输
 func (a *AwsKms) Encrypts(plaintext string) (string, error) {
-	ciphertextBlob, err := a.Encrypt([]byte(plaintext))
+	return a.EncryptsContext(context.Background(), plaintext)
+}
+
+// EncryptsContext encrypts plaintext string with the given context and returns base64 outcome
+// Same as Encrypts but threads ctx through to the KMS Encrypt API
+//
+// EncryptsContext 使用给定的上下文加密明文字符串并返回 base64 结果
+// 与 Encrypts 相同，但会将 ctx 传递给 KMS Encrypt API
+func (a *AwsKms) EncryptsContext(ctx context.Context, plaintext string) (string, error) {
+	return a.EncryptsWithEncryptionContext(ctx, plaintext, nil)
+}
+
+// EncryptsWithEncryptionContext encrypts plaintext string bound to the given encryption context
+// Returns base64 encoded ciphertext, to be decrypted with DecryptsWithEncryptionContext
+//
+// EncryptsWithEncryptionContext 加密明文字符串并绑定给定的加密上下文
+// 返回 base64 编码的密文，需要使用 DecryptsWithEncryptionContext 解密
+func (a *AwsKms) EncryptsWithEncryptionContext(ctx context.Context, plaintext string, encryptionContext map[string]string) (string, error) {
+	ciphertextBlob, err := a.EncryptWithEncryptionContext(ctx, []byte(plaintext), encryptionContext)
 	if err != nil {
 		return "", erero.Wro(err)
 	}
@@ -102,13 +200,42 @@ func (a *AwsKms) Encrypts(plaintext string) (string, error) {
 // 将 base64 字符串解码为字节，使用 KMS 解密，并将结果转换为字符串
 // 返回解密的明文字符串并使用 erero 包装异常以增强上下文
 func (a *AwsKms) Decrypts(cipherText string) (string, error) {
+	return a.DecryptsContext(context.Background(), cipherText)
+}
+
+// DecryptsContext decrypts base64 encoded ciphertext string with the given context
+// Same as Decrypts but threads ctx through to the KMS Decrypt API
+//
+// DecryptsContext 使用给定的上下文解密 base64 编码的密文字符串
+// 与 Decrypts 相同，但会将 ctx 传递给 KMS Decrypt API
+func (a *AwsKms) DecryptsContext(ctx context.Context, cipherText string) (string, error) {
+	return a.DecryptsWithEncryptionContext(ctx, cipherText, nil)
+}
+
+// DecryptsWithEncryptionContext decrypts base64 encoded ciphertext string expecting the given encryption context
+//
+// DecryptsWithEncryptionContext 使用期望的加密上下文解密 base64 编码的密文字符串
+func (a *AwsKms) DecryptsWithEncryptionContext(ctx context.Context, cipherText string, encryptionContext map[string]string) (string, error) {
 	ciphertextBlob, err := base64.StdEncoding.DecodeString(cipherText)
 	if err != nil {
 		return "", erero.Wro(err)
 	}
-	plaintext, err := a.Decrypt(ciphertextBlob)
+	plaintext, err := a.DecryptWithEncryptionContext(ctx, ciphertextBlob, encryptionContext)
 	if err != nil {
 		return "", erero.Wro(err)
 	}
 	return string(plaintext), nil
 }
+
+// clientAs returns the client as the narrower interface T required by an AwsKms feature
+// Returns exception when the injected KmsAPI implementation does not provide the operations
+//
+// clientAs 将客户端转换为 AwsKms 某个功能所需的更窄接口 T
+// 注入的 KmsAPI 实现未提供这些操作时返回异常
+func clientAs[T any](client KmsAPI) (T, error) {
+	res, ok := client.(T)
+	if !ok {
+		return res, erero.Errorf("client %T does not implement %s", client, reflect.TypeFor[T]().Name())
+	}
+	return res, nil
+}
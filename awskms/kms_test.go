@@ -1,14 +1,22 @@
 package awskms_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
 	"github.com/go-xlan/go-aws-kms/awskms"
 	"github.com/stretchr/testify/require"
 	"github.com/yyle88/must"
@@ -18,14 +26,16 @@ import (
 
 var envOptions *awskms.EnvOptions
 
+var liveEnvReady bool // whether AWS credentials are configured // 是否配置了 AWS 凭证
+
 // TestMain sets up test environment and validates AWS credentials access
 // Configures environment variable options with custom session token name
-// Skips each test when AWS credentials are not configured in CI environments
+// Marks live tests as skipped when AWS credentials are not configured in CI environments
 // Prints environment options in debugging when credentials are accessible
 //
 // TestMain 设置测试环境并验证 AWS 凭证访问
 // 配置环境变量选项，带有自定义会话令牌名称
-// 在 CI 环境中当 AWS 凭证未配置时跳过每个测试
+// 在 CI 环境中当 AWS 凭证未配置时标记在线测试为跳过
 // 当凭证可访问时打印环境选项以供调试
 func TestMain(m *testing.M) {
 	envOptions = awskms.NewEnvOptions()
@@ -33,14 +43,23 @@ func TestMain(m *testing.M) {
 
 	// Check if AWS credentials are configured // 检查 AWS 凭证是否配置
 	if os.Getenv(envOptions.RegionID) == "" {
-		println("Skipping tests: AWS KMS credentials not configured")
+		println("Skipping live tests: AWS KMS credentials not configured")
 		println("Required environment variables:")
 		println(neatjsons.S(envOptions))
-		os.Exit(0) // Exit with success to skip tests // 成功退出，跳过测试
+	} else {
+		liveEnvReady = true
+		println(neatjsons.S(envOptions)) // print the environment options // 打印环境选项
 	}
+	os.Exit(m.Run())
+}
 
-	println(neatjsons.S(envOptions)) // print the environment options // 打印环境选项
-	m.Run()
+// skipWithoutLiveEnv skips the test when AWS credentials are not configured
+//
+// skipWithoutLiveEnv 在未配置 AWS 凭证时跳过测试
+func skipWithoutLiveEnv(t *testing.T) {
+	if !liveEnvReady {
+		t.Skip("AWS KMS credentials not configured")
+	}
 }
 
 // TestAwsKms_Encrypt tests bytes encryption and decryption operations
@@ -53,6 +72,8 @@ func TestMain(m *testing.M) {
 // 验证加密/解密过程保持字节消息的数据完整
 // 使用 must.Nice 验证环境变量和 require 进行测试断言
 func TestAwsKms_Encrypt(t *testing.T) {
+	skipWithoutLiveEnv(t)
+
 	region := must.Nice(os.Getenv(envOptions.RegionID))
 
 	cfg, err := config.LoadDefaultConfig(context.Background(),
@@ -97,6 +118,8 @@ func TestAwsKms_Encrypt(t *testing.T) {
 // 验证带 base64 编码的 Encrypts/Decrypts 过程保持字符串数据完整
 // 演示使用 uber/zap 结构化日志记录的替代实现
 func TestAwsKms_Encrypts(t *testing.T) {
+	skipWithoutLiveEnv(t)
+
 	region := must.Nice(os.Getenv(envOptions.RegionID))
 	accessKey := must.Nice(os.Getenv(envOptions.AccessKeyID))
 	secretKey := must.Nice(os.Getenv(envOptions.SecretAccessKey))
@@ -143,6 +166,8 @@ func TestAwsKms_Encrypts(t *testing.T) {
 // 使用便捷的环境配置验证完整的加密工作流程
 // 演示生产环境设置的推荐模式
 func TestNewAwsKmsFromEnv(t *testing.T) {
+	skipWithoutLiveEnv(t)
+
 	awsKms := rese.P1(awskms.NewAwsKmsFromEnv(envOptions))
 
 	t.Run("TestNewAwsKmsFromEnv", func(t *testing.T) {
@@ -159,3 +184,165 @@ func TestNewAwsKmsFromEnv(t *testing.T) {
 		require.Equal(t, msg, plaintext)
 	})
 }
+
+// newBlockingAwsKms creates AwsKms pointing at a local server that never responds
+// Each request blocks until the client side gives up, which lets tests observe ctx propagation
+//
+// newBlockingAwsKms 创建指向永不响应的本地服务的 AwsKms
+// 每个请求都会阻塞直到客户端放弃，便于测试观察 ctx 的传递
+func newBlockingAwsKms(t *testing.T) (*awskms.AwsKms, <-chan struct{}) {
+	started := make(chan struct{}, 16)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	kmsClient := kms.New(kms.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		BaseEndpoint: aws.String(server.URL),
+	})
+	return awskms.NewAwsKms(kmsClient, "alias/test"), started
+}
+
+// TestAwsKms_EncryptContext_Cancel tests that canceling ctx aborts in-flight KMS calls
+//
+// TestAwsKms_EncryptContext_Cancel 测试取消 ctx 会中止进行中的 KMS 调用
+func TestAwsKms_EncryptContext_Cancel(t *testing.T) {
+	awsKms, started := newBlockingAwsKms(t)
+
+	t.Run("EncryptContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		_, err := awsKms.EncryptContext(ctx, []byte("test message"))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("DecryptsContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		_, err := awsKms.DecryptsContext(ctx, "AQIDBA==")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// TestAwsKms_DecryptContext_Deadline tests that ctx deadlines reach the KMS calls
+//
+// TestAwsKms_DecryptContext_Deadline 测试 ctx 的超时会传递给 KMS 调用
+func TestAwsKms_DecryptContext_Deadline(t *testing.T) {
+	awsKms, _ := newBlockingAwsKms(t)
+
+	t.Run("DecryptContext", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := awsKms.DecryptContext(ctx, []byte{1, 2, 3, 4})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("EncryptsContext", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := awsKms.EncryptsContext(ctx, "test message")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+// stubKmsAPI is a minimal KmsAPI implementation used to test AwsKms without AWS access
+// Ciphertext is the key ID joined with the plaintext, which is enough to check the wiring
+// Implements only Encrypt and Decrypt, so features needing further operations return exception
+//
+// stubKmsAPI 是最小化的 KmsAPI 实现，用于在无 AWS 访问时测试 AwsKms
+// 密文为 key ID 与明文的拼接，足以检查调用链路
+// 只实现 Encrypt 和 Decrypt，需要更多操作的功能会返回异常
+type stubKmsAPI struct {
+	calls int
+}
+
+func (s *stubKmsAPI) Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	s.calls++
+	return &kms.EncryptOutput{
+		KeyId:          params.KeyId,
+		CiphertextBlob: append([]byte(aws.ToString(params.KeyId)+":"), params.Plaintext...),
+	}, nil
+}
+
+func (s *stubKmsAPI) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	s.calls++
+	keyID, plaintext, ok := bytes.Cut(params.CiphertextBlob, []byte(":"))
+	if !ok {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return &kms.DecryptOutput{
+		KeyId:     aws.String(string(keyID)),
+		Plaintext: plaintext,
+	}, nil
+}
+
+// TestNewAwsKms_KmsAPI tests that AwsKms works with an injected KmsAPI implementation
+//
+// TestNewAwsKms_KmsAPI 测试 AwsKms 可以使用注入的 KmsAPI 实现
+func TestNewAwsKms_KmsAPI(t *testing.T) {
+	stub := &stubKmsAPI{}
+	awsKms := awskms.NewAwsKms(stub, "alias/test")
+
+	t.Run("Encrypts", func(t *testing.T) {
+		ciphertext, err := awsKms.Encrypts("test message")
+		require.NoError(t, err)
+
+		blob, err := base64.StdEncoding.DecodeString(ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, "alias/test:test message", string(blob))
+
+		plaintext, err := awsKms.Decrypts(ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", plaintext)
+	})
+
+	t.Run("DecryptError", func(t *testing.T) {
+		_, err := awsKms.Decrypt([]byte("no-separator"))
+		require.Error(t, err)
+	})
+
+	t.Run("UnsupportedOperation", func(t *testing.T) {
+		_, err := awsKms.EncryptEnvelope([]byte("test message"))
+		require.ErrorContains(t, err, "DataKeyAPI")
+
+		_, err = awsKms.ReEncrypt([]byte("alias/test:test message"), "")
+		require.ErrorContains(t, err, "ReEncryptAPI")
+	})
+
+	require.Equal(t, 3, stub.calls)
+}
+
+// TestNewAwsKms_NilClient tests nil clients are rejected at construction, typed nil pointers included
+//
+// TestNewAwsKms_NilClient 测试构造时拒绝 nil 客户端，包括带类型的 nil 指针
+func TestNewAwsKms_NilClient(t *testing.T) {
+	require.Panics(t, func() {
+		awskms.NewAwsKms(nil, "alias/test")
+	})
+	require.Panics(t, func() {
+		awskms.NewAwsKms((*kms.Client)(nil), "alias/test")
+	})
+	require.Panics(t, func() {
+		awskms.NewAwsKmsMac((*kms.Client)(nil), "alias/test", types.MacAlgorithmSpecHmacSha256)
+	})
+	require.Panics(t, func() {
+		awskms.NewAwsKmsEd25519Signer((*kms.Client)(nil), "alias/test")
+	})
+}
@@ -0,0 +1,128 @@
+package awskms_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// contextCheckingFakeKms wraps FakeKms and fails MAC calls whose context is done, like the SDK client does
+//
+// contextCheckingFakeKms 包装 FakeKms，与 SDK 客户端一样在上下文结束时让 MAC 调用失败
+type contextCheckingFakeKms struct {
+	*awskmstest.FakeKms
+}
+
+func (c *contextCheckingFakeKms) GenerateMac(ctx context.Context, params *kms.GenerateMacInput, optFns ...func(*kms.Options)) (*kms.GenerateMacOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.FakeKms.GenerateMac(ctx, params, optFns...)
+}
+
+func (c *contextCheckingFakeKms) VerifyMac(ctx context.Context, params *kms.VerifyMacInput, optFns ...func(*kms.Options)) (*kms.VerifyMacOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.FakeKms.VerifyMac(ctx, params, optFns...)
+}
+
+// TestAwsKmsMac_GenerateMac tests HMAC generation and verification across key specs
+//
+// TestAwsKmsMac_GenerateMac 测试各密钥规格的 HMAC 生成和校验
+func TestAwsKmsMac_GenerateMac(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+
+	for keySpec, algorithm := range map[types.KeySpec]types.MacAlgorithmSpec{
+		types.KeySpecHmac224: types.MacAlgorithmSpecHmacSha224,
+		types.KeySpecHmac256: types.MacAlgorithmSpecHmacSha256,
+		types.KeySpecHmac384: types.MacAlgorithmSpecHmacSha384,
+		types.KeySpecHmac512: types.MacAlgorithmSpecHmacSha512,
+	} {
+		awsKmsMac := awskms.NewAwsKmsMac(fake, fake.MustCreateKey(keySpec, types.KeyUsageTypeGenerateVerifyMac), algorithm)
+
+		mac, err := awsKmsMac.GenerateMac([]byte("test message"))
+		require.NoError(t, err)
+
+		valid, err := awsKmsMac.VerifyMac([]byte("test message"), mac)
+		require.NoError(t, err)
+		require.True(t, valid)
+
+		valid, err = awsKmsMac.VerifyMac([]byte("test message!"), mac)
+		require.NoError(t, err)
+		require.False(t, valid)
+	}
+}
+
+// TestAwsKmsMac_VerifyMac tests base64 and hex helpers and failures that are not MAC mismatches
+//
+// TestAwsKmsMac_VerifyMac 测试 base64 和十六进制辅助函数，以及不属于 MAC 不匹配的失败
+func TestAwsKmsMac_VerifyMac(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecHmac256, types.KeyUsageTypeGenerateVerifyMac)
+	awsKmsMac := awskms.NewAwsKmsMac(fake, keyID, types.MacAlgorithmSpecHmacSha256)
+	payload := []byte(`{"event":"paid"}`)
+
+	macBase64, err := awsKmsMac.GenerateMacBase64(payload)
+	require.NoError(t, err)
+	valid, err := awsKmsMac.VerifyMacBase64(payload, macBase64)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	macHex, err := awsKmsMac.GenerateMacHex(payload)
+	require.NoError(t, err)
+	require.Len(t, macHex, 64)
+	valid, err = awsKmsMac.VerifyMacHex(payload, macHex)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	t.Run("BadEncoding", func(t *testing.T) {
+		_, err := awsKmsMac.VerifyMacHex(payload, "zz")
+		require.Error(t, err)
+
+		_, err = awsKmsMac.VerifyMacBase64(payload, "!!")
+		require.Error(t, err)
+	})
+
+	t.Run("WrongAlgorithm", func(t *testing.T) {
+		wrong := awskms.NewAwsKmsMac(fake, keyID, types.MacAlgorithmSpecHmacSha512)
+		_, err := wrong.VerifyMacHex(payload, macHex)
+		require.Error(t, err)
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		_, err := awsKmsMac.GenerateMac(bytes.Repeat([]byte("x"), 4097))
+		require.Error(t, err)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		ctxMac := awskms.NewAwsKmsMac(&contextCheckingFakeKms{FakeKms: fake}, keyID, types.MacAlgorithmSpecHmacSha256)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ctxMac.GenerateMacBase64Context(ctx, payload)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = ctxMac.GenerateMacHexContext(ctx, payload)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = ctxMac.VerifyMacBase64Context(ctx, payload, macBase64)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = ctxMac.VerifyMacHexContext(ctx, payload, macHex)
+		require.ErrorIs(t, err, context.Canceled)
+
+		valid, err := ctxMac.VerifyMacHexContext(context.Background(), payload, macHex)
+		require.NoError(t, err)
+		require.True(t, valid)
+	})
+
+	t.Run("ServiceFault", func(t *testing.T) {
+		fake.FailNext(1, &types.KMSInternalException{})
+		_, err := awsKmsMac.VerifyMacHex(payload, macHex)
+		require.Error(t, err)
+	})
+}
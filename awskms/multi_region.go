@@ -0,0 +1,423 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// MultiRegionOptions defines the health tracking of regions in MultiRegionAwsKms
+// Supports chain configuration pattern like EnvOptions
+//
+// MultiRegionOptions 定义 MultiRegionAwsKms 中区域的健康跟踪
+// 与 EnvOptions 一样支持链式配置模式
+type MultiRegionOptions struct {
+	FailureThreshold int           // Consecutive failures that mark a region unhealthy // 将区域标记为不健康的连续失败次数
+	Cooldown         time.Duration // Time an unhealthy region is tried last // 不健康区域被放到最后尝试的时长
+}
+
+// NewMultiRegionOptions creates MultiRegionOptions with defaults: 3 consecutive failures, 30 seconds cooldown
+//
+// NewMultiRegionOptions 创建使用默认值的 MultiRegionOptions：连续失败 3 次，冷却 30 秒
+func NewMultiRegionOptions() *MultiRegionOptions {
+	return &MultiRegionOptions{
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+// WithFailureThreshold sets the consecutive failures that mark a region unhealthy
+// Returns self in method chaining
+//
+// WithFailureThreshold 设置将区域标记为不健康的连续失败次数
+// 返回自身以支持链式调用
+func (op *MultiRegionOptions) WithFailureThreshold(failureThreshold int) *MultiRegionOptions {
+	op.FailureThreshold = failureThreshold
+	return op
+}
+
+// WithCooldown sets the time an unhealthy region is tried last
+// Returns self in method chaining
+//
+// WithCooldown 设置不健康区域被放到最后尝试的时长
+// 返回自身以支持链式调用
+func (op *MultiRegionOptions) WithCooldown(cooldown time.Duration) *MultiRegionOptions {
+	op.Cooldown = cooldown
+	return op
+}
+
+// RegionHealth is a snapshot of the health of one region in MultiRegionAwsKms
+//
+// RegionHealth 是 MultiRegionAwsKms 中单个区域健康状况的快照
+type RegionHealth struct {
+	Region              string    // Region ID // 区域 ID
+	KeyID               string    // Replica key used in the region // 该区域使用的副本密钥
+	Healthy             bool      // False while the region cools down // 区域冷却期间为 false
+	ConsecutiveFailures int       // Regional failures since the last success // 自上次成功以来的区域性失败次数
+	Successes           int64     // Calls that succeeded in the region // 该区域成功的调用次数
+	Failures            int64     // Calls that failed over from the region // 从该区域故障转移的调用次数
+	LastError           error     // Most recent regional failure // 最近一次区域性失败
+	UnhealthyUntil      time.Time // End of the cooldown, zero when healthy // 冷却结束时间，健康时为零值
+}
+
+// MultiRegionAwsKms runs AwsKms operations with a multi-Region key across regional clients
+// Encryption happens in the local region, and decryption fails over to replicas in other regions
+// Replicas of a multi-Region key share key material, so ciphertext from any region decrypts in all of them
+// Only throttling, server errors, unavailable replicas and network errors fail over
+// Errors about the ciphertext itself, e.g. InvalidCiphertextException, are returned at once
+//
+// MultiRegionAwsKms 使用多区域密钥在各区域客户端上执行 AwsKms 操作
+// 加密在本地区域完成，解密时可以故障转移到其它区域的副本
+// 多区域密钥的各副本共享密钥材料，任一区域的密文都能在所有区域解密
+// 只有限流、服务端错误、副本不可用和网络错误会触发故障转移
+// 与密文本身相关的错误，例如 InvalidCiphertextException，会立即返回
+type MultiRegionAwsKms struct {
+	localRegion string                   // Region used in encryption and tried first in decryption // 用于加密且解密时首先尝试的区域
+	regions     []string                 // Local region first, then the others sorted // 本地区域在前，其它区域按序排列
+	members     map[string]*AwsKms       // AwsKms bound to the replica key by region // 按区域索引的绑定副本密钥的 AwsKms
+	options     *MultiRegionOptions      // Health tracking settings // 健康跟踪设置
+	mutex       sync.Mutex               // Guards health // 保护 health
+	health      map[string]*RegionHealth // Health of each region // 各区域的健康状况
+}
+
+// NewMultiRegionAwsKms creates MultiRegionAwsKms over regional clients with a multi-Region key
+// The key is an mrk- key ID or the key ARN of any replica, mapped to the replica ARN in each region
+// Clients map region IDs to KmsAPI clients configured with those regions, the local region included
+//
+// NewMultiRegionAwsKms 使用多区域密钥基于各区域客户端创建 MultiRegionAwsKms
+// 密钥是 mrk- 开头的 key ID 或任一副本的 key ARN，会映射为各区域的副本 ARN
+// clients 将区域 ID 映射到配置了对应区域的 KmsAPI 客户端，需要包含本地区域
+func NewMultiRegionAwsKms(keyID string, localRegion string, clients map[string]KmsAPI, options *MultiRegionOptions) (*MultiRegionAwsKms, error) {
+	must.Nice(keyID)
+	must.Nice(localRegion)
+	must.Full(options)
+	must.True(options.FailureThreshold > 0)
+	must.True(options.Cooldown > 0)
+
+	if !isMultiRegionKeyID(keyID) {
+		return nil, erero.Errorf("key %s is not a multi-Region key", keyID)
+	}
+	if _, exists := clients[localRegion]; !exists {
+		return nil, erero.Errorf("local region %s has no client", localRegion)
+	}
+
+	regions := make([]string, 0, len(clients))
+	for region := range clients {
+		if region != localRegion {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+	regions = append([]string{localRegion}, regions...)
+
+	members := make(map[string]*AwsKms, len(regions))
+	health := make(map[string]*RegionHealth, len(regions))
+	for _, region := range regions {
+		replicaKeyID, err := replicaKeyID(keyID, region)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		members[region] = NewAwsKms(clients[region], replicaKeyID)
+		health[region] = &RegionHealth{Region: region, KeyID: replicaKeyID, Healthy: true}
+	}
+	return &MultiRegionAwsKms{
+		localRegion: localRegion,
+		regions:     regions,
+		members:     members,
+		options:     options,
+		health:      health,
+	}, nil
+}
+
+// LocalRegion returns the region used in encryption
+//
+// LocalRegion 返回用于加密的区域
+func (m *MultiRegionAwsKms) LocalRegion() string {
+	return m.localRegion
+}
+
+// Regions returns the configured regions, local region first
+//
+// Regions 返回配置的区域，本地区域在前
+func (m *MultiRegionAwsKms) Regions() []string {
+	return append([]string(nil), m.regions...)
+}
+
+// Regional returns the AwsKms bound to the replica key in the region, nil when the region is not configured
+// Suits operations without failover, e.g. signing with a multi-Region asymmetric key
+//
+// Regional 返回该区域绑定副本密钥的 AwsKms，区域未配置时返回 nil
+// 适用于不需要故障转移的操作，例如使用多区域非对称密钥签名
+func (m *MultiRegionAwsKms) Regional(region string) *AwsKms {
+	return m.members[region]
+}
+
+// Encrypt encrypts plaintext bytes with the replica key in the local region
+//
+// Encrypt 使用本地区域的副本密钥加密明文字节
+func (m *MultiRegionAwsKms) Encrypt(plaintext []byte) ([]byte, error) {
+	return m.EncryptContext(context.Background(), plaintext)
+}
+
+// EncryptContext encrypts plaintext bytes in the local region with the given context
+//
+// EncryptContext 使用给定的上下文在本地区域加密明文字节
+func (m *MultiRegionAwsKms) EncryptContext(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return m.EncryptWithEncryptionContext(ctx, plaintext, nil)
+}
+
+// EncryptWithEncryptionContext encrypts plaintext bytes in the local region bound to the encryption context
+// The outcome is recorded in the local region health
+//
+// EncryptWithEncryptionContext 在本地区域加密明文字节并绑定加密上下文
+// 结果会记录到本地区域的健康状况中
+func (m *MultiRegionAwsKms) EncryptWithEncryptionContext(ctx context.Context, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	ciphertextBlob, err := m.members[m.localRegion].EncryptWithEncryptionContext(ctx, plaintext, encryptionContext)
+	if err != nil {
+		m.record(ctx, m.localRegion, err)
+		return nil, erero.Wro(err)
+	}
+	m.record(ctx, m.localRegion, nil)
+	return ciphertextBlob, nil
+}
+
+// EncryptEnvelope encrypts plaintext of any size using envelope encryption in the local region
+//
+// EncryptEnvelope 在本地区域使用信封加密方式加密任意大小的明文
+func (m *MultiRegionAwsKms) EncryptEnvelope(plaintext []byte) ([]byte, error) {
+	return m.EncryptEnvelopeContext(context.Background(), plaintext)
+}
+
+// EncryptEnvelopeContext encrypts plaintext using envelope encryption in the local region with the given context
+//
+// EncryptEnvelopeContext 使用给定的上下文在本地区域以信封加密方式加密明文
+func (m *MultiRegionAwsKms) EncryptEnvelopeContext(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return m.EncryptEnvelopeWithEncryptionContext(ctx, plaintext, nil)
+}
+
+// EncryptEnvelopeWithEncryptionContext encrypts plaintext using envelope encryption in the local region bound to the encryption context
+// The blob decrypts through Decrypt with failover, as the data key is wrapped by the multi-Region key
+//
+// EncryptEnvelopeWithEncryptionContext 在本地区域以信封加密方式加密明文并绑定加密上下文
+// 数据密钥由多区域密钥包装，因此密文块可以通过带故障转移的 Decrypt 解密
+func (m *MultiRegionAwsKms) EncryptEnvelopeWithEncryptionContext(ctx context.Context, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	envelopeBlob, err := m.members[m.localRegion].EncryptEnvelopeWithEncryptionContext(ctx, plaintext, encryptionContext)
+	if err != nil {
+		m.record(ctx, m.localRegion, err)
+		return nil, erero.Wro(err)
+	}
+	m.record(ctx, m.localRegion, nil)
+	return envelopeBlob, nil
+}
+
+// Decrypt decrypts ciphertext, failing over to replicas in other regions on throttling and outages
+// Accepts the same blobs as AwsKms.Decrypt, envelope and header blobs included
+//
+// Decrypt 解密密文，遇到限流和故障时转移到其它区域的副本
+// 接受与 AwsKms.Decrypt 相同的密文块，包括信封密文块和带头部的密文块
+func (m *MultiRegionAwsKms) Decrypt(ciphertextBlob []byte) ([]byte, error) {
+	return m.DecryptContext(context.Background(), ciphertextBlob)
+}
+
+// DecryptContext decrypts ciphertext with failover and the given context
+//
+// DecryptContext 使用给定的上下文带故障转移地解密密文
+func (m *MultiRegionAwsKms) DecryptContext(ctx context.Context, ciphertextBlob []byte) ([]byte, error) {
+	return m.DecryptWithEncryptionContext(ctx, ciphertextBlob, nil)
+}
+
+// DecryptWithEncryptionContext decrypts ciphertext with failover, expecting the given encryption context
+// Healthy regions are tried first in preference order, regions cooling down are tried last
+// Returns the errors of all regions joined when every region fails
+//
+// DecryptWithEncryptionContext 带故障转移地解密密文，使用期望的加密上下文
+// 首先按优先顺序尝试健康的区域，冷却中的区域放到最后尝试
+// 所有区域都失败时返回合并后的各区域错误
+func (m *MultiRegionAwsKms) DecryptWithEncryptionContext(ctx context.Context, ciphertextBlob []byte, encryptionContext map[string]string) ([]byte, error) {
+	var errs []error
+	for _, region := range m.decryptOrder() {
+		plaintext, err := m.members[region].DecryptWithEncryptionContext(ctx, ciphertextBlob, encryptionContext)
+		if err == nil {
+			m.record(ctx, region, nil)
+			return plaintext, nil
+		}
+		if ctx.Err() != nil || !isRegionalFailure(err) {
+			return nil, erero.Wro(err)
+		}
+		m.record(ctx, region, err)
+		errs = append(errs, erero.Wrapf(err, "decrypt in %s", region))
+	}
+	return nil, erero.Wro(errors.Join(errs...))
+}
+
+// Encrypts encrypts plaintext string in the local region and returns base64 encoded outcome
+//
+// Encrypts 在本地区域加密明文字符串并返回 base64 编码结果
+func (m *MultiRegionAwsKms) Encrypts(plaintext string) (string, error) {
+	return m.EncryptsContext(context.Background(), plaintext)
+}
+
+// EncryptsContext encrypts plaintext string in the local region with the given context
+//
+// EncryptsContext 使用给定的上下文在本地区域加密明文字符串
+func (m *MultiRegionAwsKms) EncryptsContext(ctx context.Context, plaintext string) (string, error) {
+	ciphertextBlob, err := m.EncryptContext(ctx, []byte(plaintext))
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertextBlob), nil
+}
+
+// Decrypts decrypts base64 encoded ciphertext string with failover
+//
+// Decrypts 带故障转移地解密 base64 编码的密文字符串
+func (m *MultiRegionAwsKms) Decrypts(cipherText string) (string, error) {
+	return m.DecryptsContext(context.Background(), cipherText)
+}
+
+// DecryptsContext decrypts base64 encoded ciphertext string with failover and the given context
+//
+// DecryptsContext 使用给定的上下文带故障转移地解密 base64 编码的密文字符串
+func (m *MultiRegionAwsKms) DecryptsContext(ctx context.Context, cipherText string) (string, error) {
+	ciphertextBlob, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	plaintext, err := m.DecryptContext(ctx, ciphertextBlob)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return string(plaintext), nil
+}
+
+// Health returns a snapshot of the health of each region, local region first
+//
+// Health 返回各区域健康状况的快照，本地区域在前
+func (m *MultiRegionAwsKms) Health() []RegionHealth {
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	res := make([]RegionHealth, 0, len(m.regions))
+	for _, region := range m.regions {
+		health := *m.health[region]
+		health.Healthy = !now.Before(health.UnhealthyUntil)
+		if health.Healthy {
+			health.UnhealthyUntil = time.Time{}
+		}
+		res = append(res, health)
+	}
+	return res
+}
+
+// decryptOrder returns healthy regions in preference order followed by the regions cooling down
+//
+// decryptOrder 返回按优先顺序排列的健康区域，随后是冷却中的区域
+func (m *MultiRegionAwsKms) decryptOrder() []string {
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	healthy := make([]string, 0, len(m.regions))
+	var coolingDown []string
+	for _, region := range m.regions {
+		if now.Before(m.health[region].UnhealthyUntil) {
+			coolingDown = append(coolingDown, region)
+		} else {
+			healthy = append(healthy, region)
+		}
+	}
+	return append(healthy, coolingDown...)
+}
+
+// record updates the region health with the outcome of a call
+// Failures caused by the caller cancelling ctx or by the request itself are not counted
+//
+// record 使用调用结果更新区域的健康状况
+// 调用方取消 ctx 或请求本身导致的失败不计入
+func (m *MultiRegionAwsKms) record(ctx context.Context, region string, err error) {
+	if err != nil && (ctx.Err() != nil || !isRegionalFailure(err)) {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	health := m.health[region]
+	if err == nil {
+		health.Successes++
+		health.ConsecutiveFailures = 0
+		health.UnhealthyUntil = time.Time{}
+		return
+	}
+	health.Failures++
+	health.ConsecutiveFailures++
+	health.LastError = err
+	if health.ConsecutiveFailures >= m.options.FailureThreshold {
+		health.UnhealthyUntil = time.Now().Add(m.options.Cooldown)
+	}
+}
+
+// isRegionalFailure reports whether the error is specific to one region, so another region may succeed
+// Covers network errors, exhausted retries, throttling, server faults and replicas that are disabled, pending or missing
+// Anything else, e.g. a tampered blob or a wrong encryption context, fails the same way in every region
+//
+// isRegionalFailure 判断错误是否只与单个区域相关，因而其它区域可能成功
+// 包括网络错误、重试次数耗尽、限流、服务端错误，以及被禁用、处于待定状态或缺失的副本
+// 其它错误在每个区域都会同样失败，例如被篡改的密文块或错误的加密上下文
+func isRegionalFailure(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var maxAttemptsErr *retry.MaxAttemptsError
+	if errors.As(err, &maxAttemptsErr) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "ThrottlingException", "DisabledException", "KMSInvalidStateException", "NotFoundException", "KeyUnavailableException":
+		return true
+	}
+	return apiErr.ErrorFault() == smithy.FaultServer
+}
+
+// isMultiRegionKeyID reports whether the key ID or key ARN names a multi-Region key
+//
+// isMultiRegionKeyID 判断 key ID 或 key ARN 是否指向多区域密钥
+func isMultiRegionKeyID(keyID string) bool {
+	if strings.HasPrefix(keyID, "arn:") {
+		parts := strings.SplitN(keyID, ":", 6)
+		return len(parts) == 6 && strings.HasPrefix(parts[5], "key/mrk-")
+	}
+	return strings.HasPrefix(keyID, "mrk-")
+}
+
+// replicaKeyID maps the multi-Region key to its replica in the region
+// Key ARNs get the region replaced, bare mrk- key IDs are the same in every region
+//
+// replicaKeyID 将多区域密钥映射为该区域中的副本
+// key ARN 会替换其中的区域，单独的 mrk- key ID 在各区域中相同
+func replicaKeyID(keyID string, region string) (string, error) {
+	if !strings.HasPrefix(keyID, "arn:") {
+		return keyID, nil
+	}
+	parts := strings.SplitN(keyID, ":", 6)
+	if len(parts) != 6 {
+		return "", erero.Errorf("key ARN %s is malformed", keyID)
+	}
+	parts[3] = region
+	return strings.Join(parts, ":"), nil
+}
@@ -0,0 +1,282 @@
+package awskms_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeMultiRegionAwsKms creates MultiRegionAwsKms over a multi-Region key replicated across three FakeKms regions
+//
+// newFakeMultiRegionAwsKms 创建基于复制到三个 FakeKms 区域的多区域密钥的 MultiRegionAwsKms
+func newFakeMultiRegionAwsKms(t *testing.T, options *awskms.MultiRegionOptions) (*awskms.MultiRegionAwsKms, map[string]*awskmstest.FakeKms, string) {
+	t.Helper()
+	fakes := map[string]*awskmstest.FakeKms{
+		"us-east-1": awskmstest.NewFakeKmsWithRegion("us-east-1"),
+		"eu-west-1": awskmstest.NewFakeKmsWithRegion("eu-west-1"),
+		"ap-east-1": awskmstest.NewFakeKmsWithRegion("ap-east-1"),
+	}
+	keyID := fakes["us-east-1"].MustCreateMultiRegionKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	clients := map[string]awskms.KmsAPI{"us-east-1": fakes["us-east-1"]}
+	for _, region := range []string{"eu-west-1", "ap-east-1"} {
+		fakes["us-east-1"].MustReplicateKey(keyID, fakes[region])
+		clients[region] = fakes[region]
+	}
+
+	multiRegionKms, err := awskms.NewMultiRegionAwsKms(keyID, "us-east-1", clients, options)
+	require.NoError(t, err)
+	return multiRegionKms, fakes, keyID
+}
+
+// TestMultiRegionAwsKms_Encrypt tests encryption in the local region and decryption in every replica region
+//
+// TestMultiRegionAwsKms_Encrypt 测试在本地区域加密并在每个副本区域解密
+func TestMultiRegionAwsKms_Encrypt(t *testing.T) {
+	multiRegionKms, _, keyID := newFakeMultiRegionAwsKms(t, awskms.NewMultiRegionOptions())
+	require.Equal(t, "us-east-1", multiRegionKms.LocalRegion())
+	require.Equal(t, []string{"us-east-1", "ap-east-1", "eu-west-1"}, multiRegionKms.Regions())
+	require.Nil(t, multiRegionKms.Regional("sa-east-1"))
+
+	ciphertext, err := multiRegionKms.Encrypt([]byte("test message"))
+	require.NoError(t, err)
+	for _, region := range multiRegionKms.Regions() {
+		regional := multiRegionKms.Regional(region)
+		require.Equal(t, keyID, regional.KeyID())
+
+		plaintext, err := regional.Decrypt(ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	}
+
+	cipherText, err := multiRegionKms.Encrypts("test message")
+	require.NoError(t, err)
+	res, err := multiRegionKms.Decrypts(cipherText)
+	require.NoError(t, err)
+	require.Equal(t, "test message", res)
+
+	health := multiRegionKms.Health()
+	require.Equal(t, "us-east-1", health[0].Region)
+	require.Equal(t, int64(3), health[0].Successes)
+}
+
+// TestMultiRegionAwsKms_Decrypt tests decryption fails over on throttling and outages but not on invalid ciphertext
+//
+// TestMultiRegionAwsKms_Decrypt 测试解密在限流和故障时故障转移，而在密文无效时不转移
+func TestMultiRegionAwsKms_Decrypt(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Throttling", func(t *testing.T) {
+		multiRegionKms, fakes, _ := newFakeMultiRegionAwsKms(t, awskms.NewMultiRegionOptions())
+		envelopeBlob, err := multiRegionKms.EncryptEnvelope(bytes.Repeat([]byte("x"), 10000))
+		require.NoError(t, err)
+
+		fakes["us-east-1"].FailNext(1, &smithy.GenericAPIError{Code: "ThrottlingException", Fault: smithy.FaultClient})
+		plaintext, err := multiRegionKms.Decrypt(envelopeBlob)
+		require.NoError(t, err)
+		require.Len(t, plaintext, 10000)
+
+		health := multiRegionKms.Health()
+		require.Equal(t, int64(1), health[0].Failures)
+		require.Equal(t, 1, health[0].ConsecutiveFailures)
+		require.True(t, health[0].Healthy)
+		require.Equal(t, "ap-east-1", health[1].Region)
+		require.Equal(t, int64(1), health[1].Successes)
+	})
+
+	t.Run("Transport", func(t *testing.T) {
+		multiRegionKms, fakes, _ := newFakeMultiRegionAwsKms(t, awskms.NewMultiRegionOptions())
+		ciphertext, err := multiRegionKms.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		fakes["us-east-1"].FailNext(1, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+		fakes["ap-east-1"].FailNext(1, &retry.MaxAttemptsError{Attempt: 3, Err: errors.New("request send failed")})
+		plaintext, err := multiRegionKms.Decrypt(ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+
+		health := multiRegionKms.Health()
+		require.Equal(t, int64(1), health[0].Failures)
+		require.Equal(t, int64(1), health[1].Failures)
+		require.Equal(t, int64(1), health[2].Successes)
+	})
+
+	t.Run("DisabledReplica", func(t *testing.T) {
+		multiRegionKms, fakes, keyID := newFakeMultiRegionAwsKms(t, awskms.NewMultiRegionOptions())
+		ciphertext, err := multiRegionKms.EncryptWithEncryptionContext(ctx, []byte("test message"), map[string]string{"tenant": "acme"})
+		require.NoError(t, err)
+
+		for _, region := range []string{"us-east-1", "ap-east-1"} {
+			_, err := fakes[region].DisableKey(ctx, &kms.DisableKeyInput{KeyId: aws.String(keyID)})
+			require.NoError(t, err)
+		}
+		plaintext, err := multiRegionKms.DecryptWithEncryptionContext(ctx, ciphertext, map[string]string{"tenant": "acme"})
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+		require.Equal(t, int64(1), multiRegionKms.Health()[2].Successes)
+	})
+
+	t.Run("AllRegionsDown", func(t *testing.T) {
+		multiRegionKms, fakes, _ := newFakeMultiRegionAwsKms(t, awskms.NewMultiRegionOptions())
+		ciphertext, err := multiRegionKms.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		for _, fake := range fakes {
+			fake.FailNext(1, &types.KMSInternalException{})
+		}
+		_, err = multiRegionKms.Decrypt(ciphertext)
+		require.Error(t, err)
+		for _, health := range multiRegionKms.Health() {
+			require.Equal(t, int64(1), health.Failures)
+			require.Error(t, health.LastError)
+		}
+	})
+
+	t.Run("InvalidCiphertext", func(t *testing.T) {
+		multiRegionKms, _, _ := newFakeMultiRegionAwsKms(t, awskms.NewMultiRegionOptions())
+		ciphertext, err := multiRegionKms.EncryptWithEncryptionContext(ctx, []byte("test message"), map[string]string{"tenant": "acme"})
+		require.NoError(t, err)
+
+		_, err = multiRegionKms.Decrypt(ciphertext)
+		require.Error(t, err)
+		for _, health := range multiRegionKms.Health() {
+			require.Zero(t, health.Failures)
+		}
+		require.Zero(t, multiRegionKms.Health()[1].Successes)
+	})
+}
+
+// decryptCountingFakeKms wraps FakeKms and counts Decrypt calls
+//
+// decryptCountingFakeKms 包装 FakeKms 并统计 Decrypt 调用次数
+type decryptCountingFakeKms struct {
+	*awskmstest.FakeKms
+	decryptCalls atomic.Int64
+}
+
+func (c *decryptCountingFakeKms) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	c.decryptCalls.Add(1)
+	return c.FakeKms.Decrypt(ctx, params, optFns...)
+}
+
+// TestMultiRegionAwsKms_Decrypt_Tampered tests a tampered envelope blob fails in the first region without touching region health
+//
+// TestMultiRegionAwsKms_Decrypt_Tampered 测试被篡改的信封密文块在第一个区域就失败，且不影响区域健康状况
+func TestMultiRegionAwsKms_Decrypt_Tampered(t *testing.T) {
+	primary := awskmstest.NewFakeKmsWithRegion("us-east-1")
+	keyID := primary.MustCreateMultiRegionKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	fakes := map[string]*decryptCountingFakeKms{"us-east-1": {FakeKms: primary}}
+	clients := map[string]awskms.KmsAPI{"us-east-1": fakes["us-east-1"]}
+	for _, region := range []string{"eu-west-1", "ap-east-1"} {
+		replica := awskmstest.NewFakeKmsWithRegion(region)
+		primary.MustReplicateKey(keyID, replica)
+		fakes[region] = &decryptCountingFakeKms{FakeKms: replica}
+		clients[region] = fakes[region]
+	}
+	multiRegionKms, err := awskms.NewMultiRegionAwsKms(keyID, "us-east-1", clients, awskms.NewMultiRegionOptions())
+	require.NoError(t, err)
+
+	envelopeBlob, err := multiRegionKms.EncryptEnvelope(bytes.Repeat([]byte("x"), 10000))
+	require.NoError(t, err)
+	tampered := bytes.Clone(envelopeBlob)
+	tampered[len(tampered)-1] ^= 0xff
+
+	health := multiRegionKms.Health()
+	for range 3 {
+		_, err := multiRegionKms.Decrypt(tampered)
+		require.Error(t, err)
+	}
+	require.Equal(t, health, multiRegionKms.Health())
+	require.EqualValues(t, 3, fakes["us-east-1"].decryptCalls.Load())
+	require.Zero(t, fakes["ap-east-1"].decryptCalls.Load())
+	require.Zero(t, fakes["eu-west-1"].decryptCalls.Load())
+
+	plaintext, err := multiRegionKms.Decrypt(envelopeBlob)
+	require.NoError(t, err)
+	require.Len(t, plaintext, 10000)
+}
+
+// TestMultiRegionAwsKms_Health tests a region is tried last while cooling down and trusted again afterwards
+//
+// TestMultiRegionAwsKms_Health 测试区域冷却期间被放到最后尝试，冷却后再次被信任
+func TestMultiRegionAwsKms_Health(t *testing.T) {
+	options := awskms.NewMultiRegionOptions().WithFailureThreshold(2).WithCooldown(100 * time.Millisecond)
+	multiRegionKms, fakes, _ := newFakeMultiRegionAwsKms(t, options)
+	ciphertext, err := multiRegionKms.Encrypt([]byte("test message"))
+	require.NoError(t, err)
+
+	fakes["us-east-1"].FailNext(2, &types.KMSInternalException{})
+	for range 2 {
+		_, err := multiRegionKms.Decrypt(ciphertext)
+		require.NoError(t, err)
+	}
+	health := multiRegionKms.Health()[0]
+	require.False(t, health.Healthy)
+	require.Equal(t, 2, health.ConsecutiveFailures)
+	require.False(t, health.UnhealthyUntil.IsZero())
+
+	// the local region is skipped while cooling down // 本地区域在冷却期间被跳过
+	_, err = multiRegionKms.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), multiRegionKms.Health()[0].Successes)
+	require.Equal(t, int64(3), multiRegionKms.Health()[1].Successes)
+
+	require.Eventually(t, func() bool {
+		return multiRegionKms.Health()[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+	_, err = multiRegionKms.Decrypt(ciphertext)
+	require.NoError(t, err)
+	health = multiRegionKms.Health()[0]
+	require.Equal(t, int64(2), health.Successes)
+	require.Zero(t, health.ConsecutiveFailures)
+}
+
+// TestNewMultiRegionAwsKms tests replica key mapping from key ARNs and rejection of single-Region keys
+//
+// TestNewMultiRegionAwsKms 测试从 key ARN 映射副本密钥以及拒绝单区域密钥
+func TestNewMultiRegionAwsKms(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	clients := map[string]awskms.KmsAPI{"us-east-1": fake, "eu-west-1": fake}
+	options := awskms.NewMultiRegionOptions()
+
+	multiRegionKms, err := awskms.NewMultiRegionAwsKms("arn:aws:kms:us-east-1:111122223333:key/mrk-1234abcd", "eu-west-1", clients, options)
+	require.NoError(t, err)
+	require.Equal(t, "arn:aws:kms:eu-west-1:111122223333:key/mrk-1234abcd", multiRegionKms.Regional("eu-west-1").KeyID())
+	require.Equal(t, "arn:aws:kms:us-east-1:111122223333:key/mrk-1234abcd", multiRegionKms.Regional("us-east-1").KeyID())
+
+	_, err = awskms.NewMultiRegionAwsKms(fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt), "us-east-1", clients, options)
+	require.Error(t, err)
+
+	_, err = awskms.NewMultiRegionAwsKms("alias/test", "us-east-1", clients, options)
+	require.Error(t, err)
+
+	_, err = awskms.NewMultiRegionAwsKms("mrk-1234abcd", "sa-east-1", clients, options)
+	require.Error(t, err)
+}
+
+// TestNewMultiRegionAwsKmsFromEnv tests one client is created per region from the replica region IDs variable
+//
+// TestNewMultiRegionAwsKmsFromEnv 测试根据副本区域 ID 环境变量为每个区域创建一个客户端
+func TestNewMultiRegionAwsKmsFromEnv(t *testing.T) {
+	t.Setenv("AWS_KMS_REGION_ID", "us-east-1")
+	t.Setenv("AWS_KMS_ACCESS_KEY", "test-access-key")
+	t.Setenv("AWS_KMS_SECRET_KEY", "test-secret-key")
+	t.Setenv("AWS_KMS_ENCRYPT_KEY_ID", "mrk-1234abcd")
+	t.Setenv("AWS_KMS_REPLICA_REGION_IDS", "eu-west-1, ap-east-1,us-east-1")
+
+	multiRegionKms, err := awskms.NewMultiRegionAwsKmsFromEnv(awskms.NewEnvOptions(), awskms.NewMultiRegionOptions())
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east-1", "ap-east-1", "eu-west-1"}, multiRegionKms.Regions())
+}
@@ -0,0 +1,182 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/yyle88/erero"
+)
+
+// ReEncryptAPI defines the KMS operation used by ReEncrypt
+//
+// ReEncryptAPI 定义 ReEncrypt 使用的 KMS 操作
+type ReEncryptAPI interface {
+	ReEncrypt(ctx context.Context, params *kms.ReEncryptInput, optFns ...func(*kms.Options)) (*kms.ReEncryptOutput, error)
+}
+
+var _ ReEncryptAPI = (*kms.Client)(nil)
+
+// ReEncrypt moves a ciphertext blob to the destination key inside KMS
+// KMS ciphertext is re-encrypted inside KMS, so rotation and migration need no local Decrypt and Encrypt
+// Envelope blobs only get their wrapped data key re-encrypted, the payload is copied unchanged
+// Blobs from EncryptWithHeader get a new header naming the destination key, keyring blobs are rejected
+// An empty destinationKeyID means the encryption ID configured on this AwsKms
+//
+// ReEncrypt 在 KMS 内部将密文块转移到目标密钥
+// KMS 密文在 KMS 内部重新加密，轮换和迁移无需在本地解密再加密
+// 信封密文块只重新加密其被包装的数据密钥，载荷原样复制
+// EncryptWithHeader 生成的密文块会写入指向目标密钥的新头部，密钥环密文块会被拒绝
+// destinationKeyID 为空时使用该 AwsKms 配置的加密 ID
+func (a *AwsKms) ReEncrypt(ciphertextBlob []byte, destinationKeyID string) ([]byte, error) {
+	return a.ReEncryptContext(context.Background(), ciphertextBlob, destinationKeyID)
+}
+
+// ReEncryptContext moves a ciphertext blob to the destination key with the given context
+// Passes ctx through to the KMS ReEncrypt API so callers can cancel and set deadlines
+//
+// ReEncryptContext 使用给定的上下文将密文块转移到目标密钥
+// 将 ctx 传递给 KMS ReEncrypt API，调用方可以取消请求和设置超时
+func (a *AwsKms) ReEncryptContext(ctx context.Context, ciphertextBlob []byte, destinationKeyID string) ([]byte, error) {
+	return a.ReEncryptWithEncryptionContext(ctx, ciphertextBlob, destinationKeyID, nil, nil)
+}
+
+// ReEncryptWithEncryptionContext moves a ciphertext blob to a new key and/or a new encryption context
+// KMS checks sourceEncryptionContext against the blob and binds destinationEncryptionContext to the result
+// Pass an empty destinationKeyID to keep the configured key and only change the context
+//
+// ReEncryptWithEncryptionContext 将密文块转移到新的密钥和/或新的加密上下文
+// KMS 使用 sourceEncryptionContext 校验密文块，并将 destinationEncryptionContext 绑定到结果
+// destinationKeyID 传空时保留配置的密钥，只更换加密上下文
+func (a *AwsKms) ReEncryptWithEncryptionContext(ctx context.Context, ciphertextBlob []byte, destinationKeyID string, sourceEncryptionContext map[string]string, destinationEncryptionContext map[string]string) ([]byte, error) {
+	if destinationKeyID == "" {
+		destinationKeyID = a.encryptKeyID
+	}
+	client, err := clientAs[ReEncryptAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if isEnvelope(ciphertextBlob) {
+		return a.reEncryptWithHeader(ctx, client, ciphertextBlob, destinationKeyID, sourceEncryptionContext, destinationEncryptionContext)
+	}
+	res, err := client.ReEncrypt(ctx, &kms.ReEncryptInput{
+		CiphertextBlob:               ciphertextBlob,
+		DestinationKeyId:             &destinationKeyID,
+		SourceEncryptionContext:      sourceEncryptionContext,
+		DestinationEncryptionContext: destinationEncryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res.CiphertextBlob, nil
+}
+
+// ReEncrypts moves a base64 ciphertext produced by Encrypts to the destination key
+// Returns base64 encoded ciphertext, decryptable with Decrypts
+//
+// ReEncrypts 将 Encrypts 生成的 base64 密文转移到目标密钥
+// 返回 base64 编码的密文，可以使用 Decrypts 解密
+func (a *AwsKms) ReEncrypts(cipherText string, destinationKeyID string) (string, error) {
+	return a.ReEncryptsContext(context.Background(), cipherText, destinationKeyID)
+}
+
+// ReEncryptsContext moves a base64 ciphertext to the destination key with the given context
+//
+// ReEncryptsContext 使用给定的上下文将 base64 密文转移到目标密钥
+func (a *AwsKms) ReEncryptsContext(ctx context.Context, cipherText string, destinationKeyID string) (string, error) {
+	return a.ReEncryptsWithEncryptionContext(ctx, cipherText, destinationKeyID, nil, nil)
+}
+
+// ReEncryptsWithEncryptionContext moves a base64 ciphertext to a new key and/or a new encryption context
+//
+// ReEncryptsWithEncryptionContext 将 base64 密文转移到新的密钥和/或新的加密上下文
+func (a *AwsKms) ReEncryptsWithEncryptionContext(ctx context.Context, cipherText string, destinationKeyID string, sourceEncryptionContext map[string]string, destinationEncryptionContext map[string]string) (string, error) {
+	ciphertextBlob, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	res, err := a.ReEncryptWithEncryptionContext(ctx, ciphertextBlob, destinationKeyID, sourceEncryptionContext, destinationEncryptionContext)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return base64.StdEncoding.EncodeToString(res), nil
+}
+
+// reEncryptWithHeader moves a blob starting with the envelope magic bytes to the destination key
+// Direct mode re-encrypts the KMS payload, envelope mode re-encrypts the wrapped data key
+// Keyring blobs hold the data key wrapped by several keys and cannot be moved to one key
+//
+// reEncryptWithHeader 将以信封魔数开头的密文块转移到目标密钥
+// 直接模式重新加密 KMS 载荷，信封模式重新加密被包装的数据密钥
+// 密钥环密文块包含由多个密钥包装的数据密钥，无法转移到单个密钥
+func (a *AwsKms) reEncryptWithHeader(ctx context.Context, client ReEncryptAPI, blob []byte, destinationKeyID string, sourceEncryptionContext map[string]string, destinationEncryptionContext map[string]string) ([]byte, error) {
+	header, offset, err := parseCiphertextHeader(blob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	switch header.Mode {
+	case CiphertextModeDirect:
+		res, err := client.ReEncrypt(ctx, &kms.ReEncryptInput{
+			CiphertextBlob:               blob[offset:],
+			DestinationKeyId:             &destinationKeyID,
+			SourceEncryptionContext:      sourceEncryptionContext,
+			DestinationEncryptionContext: destinationEncryptionContext,
+		})
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		prefix, err := appendCiphertextHeader(nil, CiphertextModeDirect, destinationKeyRef(res.KeyId, destinationKeyID))
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return append(prefix, res.CiphertextBlob...), nil
+	case CiphertextModeEnvelope:
+		return a.reEncryptEnvelope(ctx, client, blob, destinationKeyID, sourceEncryptionContext, destinationEncryptionContext)
+	default:
+		return nil, erero.Errorf("ciphertext mode %d cannot be re-encrypted", header.Mode)
+	}
+}
+
+// reEncryptEnvelope moves an envelope blob to the destination key by re-encrypting its wrapped data key
+// Version 2 blobs get a new header naming the destination key, version 1 blobs keep the version 1 prefix
+// The wrapped key is not part of the AES-GCM additional data, so nonce and payload are copied as is
+// Neither the data key nor the plaintext reaches this process, only kms:ReEncrypt* is needed
+//
+// reEncryptEnvelope 通过重新加密被包装的数据密钥，将信封密文块转移到目标密钥
+// 版本 2 的密文块写入指向目标密钥的新头部，版本 1 的密文块保留版本 1 前缀
+// 被包装的密钥不属于 AES-GCM 附加数据，因此 nonce 和载荷原样复制
+// 数据密钥和明文都不会进入本进程，只需要 kms:ReEncrypt* 权限
+func (a *AwsKms) reEncryptEnvelope(ctx context.Context, client ReEncryptAPI, envelopeBlob []byte, destinationKeyID string, sourceEncryptionContext map[string]string, destinationEncryptionContext map[string]string) ([]byte, error) {
+	envelope, err := parseEnvelope(envelopeBlob)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.ReEncrypt(ctx, &kms.ReEncryptInput{
+		CiphertextBlob:               envelope.wrappedKey,
+		DestinationKeyId:             &destinationKeyID,
+		SourceEncryptionContext:      sourceEncryptionContext,
+		DestinationEncryptionContext: destinationEncryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	prefix := []byte(envelopePrefixV1)
+	if envelope.header.Version == envelopeVersion2 {
+		prefix, err = appendCiphertextHeader(nil, CiphertextModeEnvelope, destinationKeyRef(res.KeyId, destinationKeyID))
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	return buildEnvelope(prefix, res.CiphertextBlob, envelope.nonce, envelope.sealed)
+}
+
+// destinationKeyRef returns the destination key ARN reported by KMS, falling back to the requested key ID
+//
+// destinationKeyRef 返回 KMS 报告的目标密钥 ARN，没有时回退到请求的密钥 ID
+func destinationKeyRef(keyID *string, destinationKeyID string) string {
+	if keyRef := aws.ToString(keyID); keyRef != "" {
+		return keyRef
+	}
+	return destinationKeyID
+}
@@ -0,0 +1,242 @@
+package awskms_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKms_ReEncrypt tests moving ciphertext to a new key without local plaintext
+//
+// TestAwsKms_ReEncrypt 测试在本地不接触明文的情况下将密文转移到新密钥
+func TestAwsKms_ReEncrypt(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	oldKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	newKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	oldKms := awskms.NewAwsKms(fake, oldKeyID)
+	newKms := awskms.NewAwsKms(fake, newKeyID)
+
+	ciphertext, err := oldKms.Encrypt([]byte("test message"))
+	require.NoError(t, err)
+
+	moved, err := oldKms.ReEncrypt(ciphertext, newKeyID)
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, moved)
+
+	plaintext, err := newKms.Decrypt(moved)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	// the old key can be disabled once all ciphertexts are moved // 所有密文转移后可以禁用旧密钥
+	_, err = fake.DisableKey(context.Background(), &kms.DisableKeyInput{KeyId: &oldKeyID})
+	require.NoError(t, err)
+	plaintext, err = newKms.Decrypt(moved)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+}
+
+// TestAwsKms_ReEncryptEnvelope tests moving envelope blobs by re-encrypting the wrapped data key
+//
+// TestAwsKms_ReEncryptEnvelope 测试通过重新加密被包装的数据密钥来转移信封密文块
+func TestAwsKms_ReEncryptEnvelope(t *testing.T) {
+	ctx := context.Background()
+	fake := awskmstest.NewFakeKms()
+	oldKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	newKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	oldKms := awskms.NewAwsKms(fake, oldKeyID)
+	newKms := awskms.NewAwsKms(fake, newKeyID)
+
+	payload := bytes.Repeat([]byte("large message "), 1000)
+	envelopeBlob, err := oldKms.EncryptEnvelope(payload)
+	require.NoError(t, err)
+
+	moved, err := oldKms.ReEncrypt(envelopeBlob, newKeyID)
+	require.NoError(t, err)
+	require.NotEqual(t, envelopeBlob, moved)
+	header, err := awskms.ParseCiphertextHeader(moved)
+	require.NoError(t, err)
+	require.Equal(t, byte(1), header.Version)
+
+	_, err = fake.DisableKey(ctx, &kms.DisableKeyInput{KeyId: &oldKeyID})
+	require.NoError(t, err)
+	plaintext, err := newKms.DecryptEnvelope(moved)
+	require.NoError(t, err)
+	require.Equal(t, payload, plaintext)
+
+	t.Run("EncryptionContext", func(t *testing.T) {
+		sourceContext := map[string]string{"tenant": "a"}
+		destinationContext := map[string]string{"tenant": "b"}
+
+		envelopeBlob, err := newKms.EncryptEnvelopeWithEncryptionContext(ctx, payload, sourceContext)
+		require.NoError(t, err)
+
+		_, err = newKms.ReEncryptWithEncryptionContext(ctx, envelopeBlob, "", nil, destinationContext)
+		require.Error(t, err)
+
+		moved, err := newKms.ReEncryptWithEncryptionContext(ctx, envelopeBlob, "", sourceContext, destinationContext)
+		require.NoError(t, err)
+		plaintext, err := newKms.DecryptEnvelopeWithEncryptionContext(ctx, moved, destinationContext)
+		require.NoError(t, err)
+		require.Equal(t, payload, plaintext)
+
+		_, err = newKms.DecryptEnvelopeWithEncryptionContext(ctx, moved, sourceContext)
+		require.Error(t, err)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		envelopeBlob, err := newKms.EncryptEnvelope(payload)
+		require.NoError(t, err)
+
+		tampered := bytes.Clone(envelopeBlob)
+		tampered[len(tampered)-1] ^= 0xff
+		moved, err := newKms.ReEncrypt(tampered, "")
+		require.NoError(t, err) // the payload is copied without being opened // 载荷不经解密直接复制
+		_, err = newKms.DecryptEnvelope(moved)
+		require.Error(t, err)
+
+		tampered = bytes.Clone(envelopeBlob)
+		tampered[8] ^= 0xff // inside the wrapped data key // 位于被包装的数据密钥内
+		_, err = newKms.ReEncrypt(tampered, "")
+		require.Error(t, err)
+	})
+
+	t.Run("NoDecrypt", func(t *testing.T) {
+		envelopeBlob, err := newKms.EncryptEnvelope(payload)
+		require.NoError(t, err)
+
+		reEncryptOnly := awskms.NewAwsKms(&reEncryptOnlyKms{fake: fake}, newKeyID)
+		moved, err := reEncryptOnly.ReEncrypt(envelopeBlob, "")
+		require.NoError(t, err)
+		require.NotEqual(t, envelopeBlob, moved)
+		plaintext, err := newKms.DecryptEnvelope(moved)
+		require.NoError(t, err)
+		require.Equal(t, payload, plaintext)
+	})
+}
+
+// TestAwsKms_ReEncryptWithHeader tests moving versioned blobs in both modes, with the header naming the destination key
+//
+// TestAwsKms_ReEncryptWithHeader 测试转移两种模式的带版本密文块，头部指向目标密钥
+func TestAwsKms_ReEncryptWithHeader(t *testing.T) {
+	ctx := context.Background()
+	fake := awskmstest.NewFakeKms()
+	oldKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	newKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	oldKms := awskms.NewAwsKms(fake, oldKeyID)
+	newKms := awskms.NewAwsKms(fake, newKeyID)
+	encryptionContext := map[string]string{"tenant": "acme"}
+
+	for _, mode := range []awskms.CiphertextMode{awskms.CiphertextModeDirect, awskms.CiphertextModeEnvelope} {
+		blob, err := oldKms.EncryptWithHeaderEncryptionContext(ctx, []byte("test message"), mode, encryptionContext)
+		require.NoError(t, err)
+
+		moved, err := oldKms.ReEncryptWithEncryptionContext(ctx, blob, newKeyID, encryptionContext, encryptionContext)
+		require.NoError(t, err)
+
+		header, err := awskms.ParseCiphertextHeader(moved)
+		require.NoError(t, err)
+		require.Equal(t, byte(2), header.Version)
+		require.Equal(t, mode, header.Mode)
+		require.True(t, strings.HasSuffix(header.KeyRef, newKeyID))
+
+		plaintext, err := newKms.DecryptWithEncryptionContext(ctx, moved, encryptionContext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+
+		// a round trip back to the old key restores the original key reference // 转回旧密钥后恢复原来的密钥引用
+		back, err := newKms.ReEncryptWithEncryptionContext(ctx, moved, oldKeyID, encryptionContext, encryptionContext)
+		require.NoError(t, err)
+		header, err = awskms.ParseCiphertextHeader(back)
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(header.KeyRef, oldKeyID))
+		plaintext, err = oldKms.DecryptWithEncryptionContext(ctx, back, encryptionContext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	}
+
+	t.Run("Keyring", func(t *testing.T) {
+		blob, err := awskms.NewKeyring(oldKms, newKms).Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		_, err = oldKms.ReEncrypt(blob, newKeyID)
+		require.ErrorContains(t, err, "cannot be re-encrypted")
+	})
+}
+
+// TestAwsKms_ReEncrypts tests moving base64 ciphertext to a new key and a new encryption context
+//
+// TestAwsKms_ReEncrypts 测试将 base64 密文转移到新密钥和新加密上下文
+func TestAwsKms_ReEncrypts(t *testing.T) {
+	awsKms, fake := newFakeAwsKms(t)
+	newKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	ctx := context.Background()
+
+	cipherText, err := awsKms.Encrypts("test message")
+	require.NoError(t, err)
+
+	moved, err := awsKms.ReEncrypts(cipherText, newKeyID)
+	require.NoError(t, err)
+
+	res, err := awsKms.Decrypts(moved)
+	require.NoError(t, err)
+	require.Equal(t, "test message", res)
+
+	t.Run("EncryptionContextOnly", func(t *testing.T) {
+		sourceContext := map[string]string{"tenant": "a"}
+		destinationContext := map[string]string{"tenant": "b"}
+
+		cipherText, err := awsKms.EncryptsWithEncryptionContext(ctx, "test message", sourceContext)
+		require.NoError(t, err)
+
+		moved, err := awsKms.ReEncryptsWithEncryptionContext(ctx, cipherText, "", sourceContext, destinationContext)
+		require.NoError(t, err)
+
+		res, err := awsKms.DecryptsWithEncryptionContext(ctx, moved, destinationContext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", res)
+
+		_, err = awsKms.DecryptsWithEncryptionContext(ctx, moved, sourceContext)
+		require.Error(t, err)
+	})
+
+	t.Run("WrongSourceContext", func(t *testing.T) {
+		cipherText, err := awsKms.EncryptsWithEncryptionContext(ctx, "test message", map[string]string{"tenant": "a"})
+		require.NoError(t, err)
+
+		var invalid *types.InvalidCiphertextException
+		_, err = awsKms.ReEncryptsWithEncryptionContext(ctx, cipherText, newKeyID, nil, nil)
+		require.ErrorAs(t, err, &invalid)
+	})
+
+	t.Run("NotBase64", func(t *testing.T) {
+		_, err := awsKms.ReEncrypts("not base64 !!", newKeyID)
+		require.Error(t, err)
+	})
+}
+
+// reEncryptOnlyKms exposes KMS ReEncrypt and fails Decrypt, like a caller lacking kms:Decrypt
+//
+// reEncryptOnlyKms 提供 KMS ReEncrypt 且 Decrypt 总是失败，模拟缺少 kms:Decrypt 权限的调用方
+type reEncryptOnlyKms struct {
+	fake *awskmstest.FakeKms
+}
+
+func (r *reEncryptOnlyKms) Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	return r.fake.Encrypt(ctx, params, optFns...)
+}
+
+func (r *reEncryptOnlyKms) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	return nil, errors.New("access denied to kms:Decrypt")
+}
+
+func (r *reEncryptOnlyKms) ReEncrypt(ctx context.Context, params *kms.ReEncryptInput, optFns ...func(*kms.Options)) (*kms.ReEncryptOutput, error) {
+	return r.fake.ReEncrypt(ctx, params, optFns...)
+}
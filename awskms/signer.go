@@ -0,0 +1,312 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 signing hash // SHA-256 签名哈希
+	_ "crypto/sha512" // SHA-384 and SHA-512 signing hashes // SHA-384 和 SHA-512 签名哈希
+	"crypto/x509"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// SignerAPI defines the KMS operations used by AwsKmsSigner, AwsKmsCryptoSigner and AwsKmsEd25519Signer
+//
+// SignerAPI 定义 AwsKmsSigner、AwsKmsCryptoSigner 和 AwsKmsEd25519Signer 使用的 KMS 操作
+type SignerAPI interface {
+	PublicKeyAPI
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+	Verify(ctx context.Context, params *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error)
+}
+
+var _ SignerAPI = (*kms.Client)(nil)
+
+const maxRawMessageSize = 4096 // KMS limit on RAW messages, larger ones are signed as digest // KMS 对 RAW 消息的长度限制，更长的消息以摘要方式签名
+
+// AwsKmsSigner signs and verifies payloads with an asymmetric SIGN_VERIFY KMS key
+// Supports RSASSA-PSS, RSASSA-PKCS1-v1_5 and ECDSA algorithms, the private key never leaves KMS
+// Verification runs through KMS Verify or locally with the public key fetched once via GetPublicKey
+//
+// AwsKmsSigner 使用非对称 SIGN_VERIFY KMS 密钥对载荷签名和验签
+// 支持 RSASSA-PSS、RSASSA-PKCS1-v1_5 和 ECDSA 算法，私钥不会离开 KMS
+// 验签可以通过 KMS Verify 进行，也可以使用通过 GetPublicKey 获取一次的公钥在本地进行
+type AwsKmsSigner struct {
+	client    SignerAPI                  // AWS KMS client to handle API operations // AWS KMS 客户端用于处理 API 操作
+	signKeyID string                     // KMS ID used in signing // 用于签名的 KMS ID
+	algorithm types.SigningAlgorithmSpec // Signing algorithm in use // 使用的签名算法
+	hash      crypto.Hash                // Hash of the signing algorithm // 签名算法对应的哈希
+	mutex     sync.Mutex                 // Guards publicKey // 保护 publicKey
+	publicKey crypto.PublicKey           // Cached public key, nil until fetched // 缓存的公钥，获取前为 nil
+}
+
+// NewAwsKmsSigner creates AwsKmsSigner with given KMS client, signing key ID and algorithm
+// Validates client, ID and algorithm using must to ensure input safe
+//
+// NewAwsKmsSigner 使用给定的 KMS 客户端、签名密钥 ID 和算法创建 AwsKmsSigner
+// 使用 must 验证客户端、ID 和算法以确保输入安全
+func NewAwsKmsSigner(client SignerAPI, signKeyID string, algorithm types.SigningAlgorithmSpec) *AwsKmsSigner {
+	hash := signingHash(algorithm)
+	must.True(hash != 0)
+	return &AwsKmsSigner{
+		client:    utils.MustClient(client),
+		signKeyID: must.Nice(signKeyID),
+		algorithm: algorithm,
+		hash:      hash,
+	}
+}
+
+// Algorithm returns the signing algorithm in use
+//
+// Algorithm 返回使用的签名算法
+func (s *AwsKmsSigner) Algorithm() types.SigningAlgorithmSpec {
+	return s.algorithm
+}
+
+// SignMessage signs a message of any size through KMS
+// Messages up to 4 KB are sent as RAW, larger ones are hashed locally and sent as DIGEST
+// Both produce the same signature, so verifiers need not know which was used
+//
+// SignMessage 通过 KMS 对任意大小的消息签名
+// 不超过 4 KB 的消息以 RAW 发送，更长的消息在本地哈希后以 DIGEST 发送
+// 两种方式得到的签名相同，验签方无需知道使用的是哪种
+func (s *AwsKmsSigner) SignMessage(message []byte) ([]byte, error) {
+	return s.SignMessageContext(context.Background(), message)
+}
+
+// SignMessageContext signs a message of any size through KMS with the given context
+//
+// SignMessageContext 使用给定的上下文通过 KMS 对任意大小的消息签名
+func (s *AwsKmsSigner) SignMessageContext(ctx context.Context, message []byte) ([]byte, error) {
+	messageType, payload := s.messagePayload(message)
+	return s.sign(ctx, messageType, payload)
+}
+
+// SignDigest signs a precomputed digest through KMS, the digest size must match the algorithm hash
+//
+// SignDigest 通过 KMS 对预先计算的摘要签名，摘要长度必须与算法的哈希一致
+func (s *AwsKmsSigner) SignDigest(digest []byte) ([]byte, error) {
+	return s.SignDigestContext(context.Background(), digest)
+}
+
+// SignDigestContext signs a precomputed digest through KMS with the given context
+//
+// SignDigestContext 使用给定的上下文通过 KMS 对预先计算的摘要签名
+func (s *AwsKmsSigner) SignDigestContext(ctx context.Context, digest []byte) ([]byte, error) {
+	if len(digest) != s.hash.Size() {
+		return nil, erero.Errorf("digest length %d does not match %s", len(digest), s.algorithm)
+	}
+	return s.sign(ctx, types.MessageTypeDigest, digest)
+}
+
+// VerifyMessage verifies a message signature through KMS Verify
+// Returns false without exception when the signature does not match
+//
+// VerifyMessage 通过 KMS Verify 校验消息签名
+// 签名不匹配时返回 false 且不返回异常
+func (s *AwsKmsSigner) VerifyMessage(message []byte, signature []byte) (bool, error) {
+	return s.VerifyMessageContext(context.Background(), message, signature)
+}
+
+// VerifyMessageContext verifies a message signature through KMS Verify with the given context
+//
+// VerifyMessageContext 使用给定的上下文通过 KMS Verify 校验消息签名
+func (s *AwsKmsSigner) VerifyMessageContext(ctx context.Context, message []byte, signature []byte) (bool, error) {
+	messageType, payload := s.messagePayload(message)
+	return s.verify(ctx, messageType, payload, signature)
+}
+
+// VerifyDigest verifies a digest signature through KMS Verify
+//
+// VerifyDigest 通过 KMS Verify 校验摘要签名
+func (s *AwsKmsSigner) VerifyDigest(digest []byte, signature []byte) (bool, error) {
+	return s.VerifyDigestContext(context.Background(), digest, signature)
+}
+
+// VerifyDigestContext verifies a digest signature through KMS Verify with the given context
+//
+// VerifyDigestContext 使用给定的上下文通过 KMS Verify 校验摘要签名
+func (s *AwsKmsSigner) VerifyDigestContext(ctx context.Context, digest []byte, signature []byte) (bool, error) {
+	if len(digest) != s.hash.Size() {
+		return false, erero.Errorf("digest length %d does not match %s", len(digest), s.algorithm)
+	}
+	return s.verify(ctx, types.MessageTypeDigest, digest, signature)
+}
+
+// VerifyMessageLocal verifies a message signature locally with the cached public key
+// Only the first call reaches KMS to fetch the public key
+//
+// VerifyMessageLocal 使用缓存的公钥在本地校验消息签名
+// 只有第一次调用会访问 KMS 获取公钥
+func (s *AwsKmsSigner) VerifyMessageLocal(message []byte, signature []byte) (bool, error) {
+	return s.VerifyMessageLocalContext(context.Background(), message, signature)
+}
+
+// VerifyMessageLocalContext verifies a message signature locally, fetching the public key with the given context
+//
+// VerifyMessageLocalContext 在本地校验消息签名，使用给定的上下文获取公钥
+func (s *AwsKmsSigner) VerifyMessageLocalContext(ctx context.Context, message []byte, signature []byte) (bool, error) {
+	return s.VerifyDigestLocalContext(ctx, s.digest(message), signature)
+}
+
+// VerifyDigestLocal verifies a digest signature locally with the cached public key
+//
+// VerifyDigestLocal 使用缓存的公钥在本地校验摘要签名
+func (s *AwsKmsSigner) VerifyDigestLocal(digest []byte, signature []byte) (bool, error) {
+	return s.VerifyDigestLocalContext(context.Background(), digest, signature)
+}
+
+// VerifyDigestLocalContext verifies a digest signature locally, fetching the public key with the given context
+//
+// VerifyDigestLocalContext 在本地校验摘要签名，使用给定的上下文获取公钥
+func (s *AwsKmsSigner) VerifyDigestLocalContext(ctx context.Context, digest []byte, signature []byte) (bool, error) {
+	if len(digest) != s.hash.Size() {
+		return false, erero.Errorf("digest length %d does not match %s", len(digest), s.algorithm)
+	}
+	publicKey, err := s.PublicKeyContext(ctx)
+	if err != nil {
+		return false, erero.Wro(err)
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		if isPssAlgorithm(s.algorithm) {
+			return rsa.VerifyPSS(publicKey, s.hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil, nil
+		}
+		return rsa.VerifyPKCS1v15(publicKey, s.hash, digest, signature) == nil, nil
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(publicKey, digest, signature), nil
+	default:
+		return false, erero.Errorf("public key type %T is not supported", publicKey)
+	}
+}
+
+// PublicKey returns the public key of the signing key, fetched via GetPublicKey once and cached
+//
+// PublicKey 返回签名密钥的公钥，通过 GetPublicKey 获取一次并缓存
+func (s *AwsKmsSigner) PublicKey() (crypto.PublicKey, error) {
+	return s.PublicKeyContext(context.Background())
+}
+
+// PublicKeyContext returns the cached public key, fetching it with the given context on first use
+// Checks the key is a SIGN_VERIFY key which supports the algorithm
+//
+// PublicKeyContext 返回缓存的公钥，首次使用时使用给定的上下文获取
+// 检查密钥是支持该算法的 SIGN_VERIFY 用途密钥
+func (s *AwsKmsSigner) PublicKeyContext(ctx context.Context) (crypto.PublicKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.publicKey != nil {
+		return s.publicKey, nil
+	}
+
+	res, err := s.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: &s.signKeyID,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if res.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, erero.Errorf("key usage %s is not SIGN_VERIFY", res.KeyUsage)
+	}
+	if !slices.Contains(res.SigningAlgorithms, s.algorithm) {
+		return nil, erero.Errorf("key does not support signing algorithm %s", s.algorithm)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	s.publicKey = publicKey
+	return publicKey, nil
+}
+
+// sign calls KMS Sign with the prepared message type and payload
+//
+// sign 使用准备好的消息类型和载荷调用 KMS Sign
+func (s *AwsKmsSigner) sign(ctx context.Context, messageType types.MessageType, payload []byte) ([]byte, error) {
+	res, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            &s.signKeyID,
+		Message:          payload,
+		MessageType:      messageType,
+		SigningAlgorithm: s.algorithm,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res.Signature, nil
+}
+
+// verify calls KMS Verify, mapping KMSInvalidSignatureException to false
+//
+// verify 调用 KMS Verify，将 KMSInvalidSignatureException 映射为 false
+func (s *AwsKmsSigner) verify(ctx context.Context, messageType types.MessageType, payload []byte, signature []byte) (bool, error) {
+	res, err := s.client.Verify(ctx, &kms.VerifyInput{
+		KeyId:            &s.signKeyID,
+		Message:          payload,
+		MessageType:      messageType,
+		Signature:        signature,
+		SigningAlgorithm: s.algorithm,
+	})
+	if err != nil {
+		var invalidSignature *types.KMSInvalidSignatureException
+		if errors.As(err, &invalidSignature) {
+			return false, nil
+		}
+		return false, erero.Wro(err)
+	}
+	return res.SignatureValid, nil
+}
+
+// messagePayload returns RAW with the message when within the KMS limit, otherwise DIGEST with its hash
+//
+// messagePayload 消息在 KMS 限制内时返回 RAW 和消息本身，否则返回 DIGEST 和消息的哈希
+func (s *AwsKmsSigner) messagePayload(message []byte) (types.MessageType, []byte) {
+	if len(message) > 0 && len(message) <= maxRawMessageSize {
+		return types.MessageTypeRaw, message
+	}
+	return types.MessageTypeDigest, s.digest(message)
+}
+
+// digest hashes the message with the algorithm hash
+//
+// digest 使用算法对应的哈希计算消息摘要
+func (s *AwsKmsSigner) digest(message []byte) []byte {
+	hash := s.hash.New()
+	hash.Write(message)
+	return hash.Sum(nil)
+}
+
+// signingHash returns the hash of the signing algorithm, 0 when the algorithm is not supported
+//
+// signingHash 返回签名算法对应的哈希，算法不支持时返回 0
+func signingHash(algorithm types.SigningAlgorithmSpec) crypto.Hash {
+	switch algorithm {
+	case types.SigningAlgorithmSpecRsassaPssSha256, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256, types.SigningAlgorithmSpecEcdsaSha256:
+		return crypto.SHA256
+	case types.SigningAlgorithmSpecRsassaPssSha384, types.SigningAlgorithmSpecRsassaPkcs1V15Sha384, types.SigningAlgorithmSpecEcdsaSha384:
+		return crypto.SHA384
+	case types.SigningAlgorithmSpecRsassaPssSha512, types.SigningAlgorithmSpecRsassaPkcs1V15Sha512, types.SigningAlgorithmSpecEcdsaSha512:
+		return crypto.SHA512
+	default:
+		return 0
+	}
+}
+
+// isPssAlgorithm reports whether the signing algorithm is one of the RSASSA-PSS algorithms
+//
+// isPssAlgorithm 判断签名算法是否为 RSASSA-PSS 算法之一
+func isPssAlgorithm(algorithm types.SigningAlgorithmSpec) bool {
+	switch algorithm {
+	case types.SigningAlgorithmSpecRsassaPssSha256, types.SigningAlgorithmSpecRsassaPssSha384, types.SigningAlgorithmSpecRsassaPssSha512:
+		return true
+	default:
+		return false
+	}
+}
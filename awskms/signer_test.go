@@ -0,0 +1,113 @@
+package awskms_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAwsKmsSigner_SignMessage tests signing and verifying via KMS and locally across RSA and ECDSA algorithms
+//
+// TestAwsKmsSigner_SignMessage 测试 RSA 和 ECDSA 算法通过 KMS 和本地的签名与验签
+func TestAwsKmsSigner_SignMessage(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	rsaKeyID := fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify)
+	ecKeyID := fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify)
+
+	for keyID, algorithms := range map[string][]types.SigningAlgorithmSpec{
+		rsaKeyID: {
+			types.SigningAlgorithmSpecRsassaPssSha256,
+			types.SigningAlgorithmSpecRsassaPssSha512,
+			types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+			types.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+		},
+		ecKeyID: {
+			types.SigningAlgorithmSpecEcdsaSha256,
+		},
+	} {
+		for _, algorithm := range algorithms {
+			t.Run(string(algorithm), func(t *testing.T) {
+				signer := awskms.NewAwsKmsSigner(fake, keyID, algorithm)
+
+				for _, message := range [][]byte{[]byte("test message"), bytes.Repeat([]byte("x"), 64<<10)} {
+					signature, err := signer.SignMessage(message)
+					require.NoError(t, err)
+
+					valid, err := signer.VerifyMessage(message, signature)
+					require.NoError(t, err)
+					require.True(t, valid)
+
+					valid, err = signer.VerifyMessageLocal(message, signature)
+					require.NoError(t, err)
+					require.True(t, valid)
+
+					tampered := append(bytes.Clone(message), '!')
+					valid, err = signer.VerifyMessage(tampered, signature)
+					require.NoError(t, err)
+					require.False(t, valid)
+
+					valid, err = signer.VerifyMessageLocal(tampered, signature)
+					require.NoError(t, err)
+					require.False(t, valid)
+				}
+			})
+		}
+	}
+}
+
+// TestAwsKmsSigner_SignDigest tests digest signing and that large messages are signed as their digest
+//
+// TestAwsKmsSigner_SignDigest 测试摘要签名，以及长消息以其摘要签名
+func TestAwsKmsSigner_SignDigest(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify)
+	signer := awskms.NewAwsKmsSigner(fake, keyID, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256)
+
+	message := bytes.Repeat([]byte("x"), 8<<10)
+	digest := sha256.Sum256(message)
+
+	signature, err := signer.SignDigest(digest[:])
+	require.NoError(t, err)
+
+	// PKCS1 v1.5 signatures are deterministic, so RAW above 4 KB falls back to the same digest // PKCS1 v1.5 签名是确定性的，超过 4 KB 的消息回退为同一摘要
+	sameSignature, err := signer.SignMessage(message)
+	require.NoError(t, err)
+	require.Equal(t, signature, sameSignature)
+
+	valid, err := signer.VerifyDigest(digest[:], signature)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	valid, err = signer.VerifyDigestLocal(digest[:], signature)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	t.Run("WrongDigestSize", func(t *testing.T) {
+		_, err := signer.SignDigest(digest[:16])
+		require.Error(t, err)
+	})
+
+	t.Run("WrongKeyUsage", func(t *testing.T) {
+		encryptKeyID := fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt)
+		signer := awskms.NewAwsKmsSigner(fake, encryptKeyID, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256)
+
+		_, err := signer.SignMessage([]byte("test message"))
+		require.Error(t, err)
+
+		_, err = signer.PublicKey()
+		require.Error(t, err)
+	})
+
+	t.Run("UnsupportedAlgorithm", func(t *testing.T) {
+		ecKeyID := fake.MustCreateKey(types.KeySpecEccNistP384, types.KeyUsageTypeSignVerify)
+		signer := awskms.NewAwsKmsSigner(fake, ecKeyID, types.SigningAlgorithmSpecEcdsaSha256)
+
+		_, err := signer.SignMessage([]byte("test message"))
+		require.Error(t, err)
+	})
+}
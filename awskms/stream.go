@@ -0,0 +1,341 @@
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+const (
+	streamMagic     = "AKSM"     // Magic bytes at the start of encrypted streams // 加密流开头的魔数
+	streamVersion1  = 0x01       // Stream layout version // 流格式版本
+	streamChunkSize = 64 << 10   // Plaintext bytes in each chunk // 每个分块的明文字节数
+	streamChunkMax  = 16 << 20   // Largest chunk size accepted when decrypting // 解密时接受的最大分块长度
+	streamPrefixLen = 4          // Random nonce prefix, the other 8 bytes are the sequence number // 随机 nonce 前缀，其余 8 字节为序号
+	chunkFlagMore   = byte(0x00) // Chunk followed by more chunks // 后面还有分块
+	chunkFlagFinal  = byte(0x01) // Last chunk of the stream // 流的最后一个分块
+)
+
+// NewEncryptWriter returns a writer encrypting everything written to it into w
+// Uses a KMS-wrapped AES-256 data key and chunked AES-256-GCM framing in constant memory
+// Callers must Close the writer to emit the final chunk, otherwise decryption reports truncation
+//
+// NewEncryptWriter 返回将写入内容加密后输出到 w 的写入器
+// 使用 KMS 包装的 AES-256 数据密钥和分块 AES-256-GCM 格式，内存占用恒定
+// 调用方必须 Close 写入器以输出最后一个分块，否则解密时会报告截断
+func (a *AwsKms) NewEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	return a.NewEncryptWriterContext(context.Background(), w)
+}
+
+// NewEncryptWriterContext returns an encrypting writer, passing ctx to KMS GenerateDataKey
+// The stream header with the wrapped data key is written to w before returning
+//
+// NewEncryptWriterContext 返回加密写入器，并将 ctx 传给 KMS GenerateDataKey
+// 返回前会先将包含被包装数据密钥的流头部写入 w
+func (a *AwsKms) NewEncryptWriterContext(ctx context.Context, w io.Writer) (io.WriteCloser, error) {
+	return a.NewEncryptWriterWithEncryptionContext(ctx, w, nil)
+}
+
+// NewEncryptWriterWithEncryptionContext returns an encrypting writer whose data key is bound to the encryption context
+//
+// NewEncryptWriterWithEncryptionContext 返回加密写入器，其数据密钥绑定给定的加密上下文
+func (a *AwsKms) NewEncryptWriterWithEncryptionContext(ctx context.Context, w io.Writer, encryptionContext map[string]string) (io.WriteCloser, error) {
+	must.Nice(w)
+	client, err := clientAs[DataKeyAPI](a.client)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	res, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             &a.encryptKeyID,
+		KeySpec:           types.DataKeySpecAes256,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(res.Plaintext)
+
+	if len(res.CiphertextBlob) == 0 || len(res.CiphertextBlob) > 0xFFFF {
+		return nil, erero.Errorf("wrapped data key length %d is out of range", len(res.CiphertextBlob))
+	}
+	gcm, err := utils.NewAesGcm(res.Plaintext)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	noncePrefix := make([]byte, streamPrefixLen)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return nil, erero.Wro(err)
+	}
+
+	header := make([]byte, 0, len(streamMagic)+7+len(res.CiphertextBlob)+streamPrefixLen)
+	header = append(header, streamMagic...)
+	header = append(header, streamVersion1)
+	header = binary.BigEndian.AppendUint32(header, streamChunkSize)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(res.CiphertextBlob)))
+	header = append(header, res.CiphertextBlob...)
+	header = append(header, noncePrefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, erero.Wro(err)
+	}
+
+	return &encryptWriter{
+		w:      w,
+		framer: newStreamFramer(gcm, header, noncePrefix),
+		buffer: make([]byte, 0, streamChunkSize),
+	}, nil
+}
+
+// NewDecryptReader returns a reader decrypting a stream produced by NewEncryptWriter
+// Reads the stream header and unwraps the data key via KMS Decrypt before returning
+// Reports exception on tampered, reordered or truncated chunks and on trailing data
+//
+// NewDecryptReader 返回解密由 NewEncryptWriter 生成的流的读取器
+// 返回前读取流头部并通过 KMS Decrypt 解包数据密钥
+// 分块被篡改、重排或截断以及存在多余数据时报告异常
+func (a *AwsKms) NewDecryptReader(r io.Reader) (io.Reader, error) {
+	return a.NewDecryptReaderContext(context.Background(), r)
+}
+
+// NewDecryptReaderContext returns a decrypting reader, passing ctx to KMS Decrypt
+//
+// NewDecryptReaderContext 返回解密读取器，并将 ctx 传给 KMS Decrypt
+func (a *AwsKms) NewDecryptReaderContext(ctx context.Context, r io.Reader) (io.Reader, error) {
+	return a.NewDecryptReaderWithEncryptionContext(ctx, r, nil)
+}
+
+// NewDecryptReaderWithEncryptionContext returns a decrypting reader expecting the given encryption context
+// KMS rejects unwrapping the data key when the context does not match
+//
+// NewDecryptReaderWithEncryptionContext 返回使用期望加密上下文的解密读取器
+// 上下文不匹配时 KMS 会拒绝解包数据密钥
+func (a *AwsKms) NewDecryptReaderWithEncryptionContext(ctx context.Context, r io.Reader, encryptionContext map[string]string) (io.Reader, error) {
+	must.Nice(r)
+	fixed := make([]byte, len(streamMagic)+7)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, erero.Wro(err)
+	}
+	if !bytes.Equal(fixed[:len(streamMagic)], []byte(streamMagic)) {
+		return nil, erero.New("stream is not an encrypted stream")
+	}
+	if fixed[len(streamMagic)] != streamVersion1 {
+		return nil, erero.New("stream version is not supported")
+	}
+	chunkSize := binary.BigEndian.Uint32(fixed[len(streamMagic)+1:])
+	if chunkSize == 0 || chunkSize > streamChunkMax {
+		return nil, erero.Errorf("stream chunk size %d is out of range", chunkSize)
+	}
+	wrappedKeyLen := int(binary.BigEndian.Uint16(fixed[len(streamMagic)+5:]))
+	if wrappedKeyLen == 0 {
+		return nil, erero.New("stream wrapped data key is empty")
+	}
+	rest := make([]byte, wrappedKeyLen+streamPrefixLen)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, erero.Wro(err)
+	}
+	header := append(fixed, rest...)
+
+	res, err := a.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    rest[:wrappedKeyLen],
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(res.Plaintext)
+
+	gcm, err := utils.NewAesGcm(res.Plaintext)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &decryptReader{
+		r:         r,
+		framer:    newStreamFramer(gcm, header, rest[wrappedKeyLen:]),
+		chunkSize: int(chunkSize),
+	}, nil
+}
+
+// streamFramer seals and opens chunks with sequence-bound nonces and additional data
+// Nonce is prefix | uint64 sequence, and AAD is header | uint64 sequence | flag
+//
+// streamFramer 使用绑定序号的 nonce 和附加数据加解密分块
+// nonce 为前缀 | uint64 序号，AAD 为头部 | uint64 序号 | 标志
+type streamFramer struct {
+	gcm         cipher.AEAD // AES-GCM with the stream data key // 使用流数据密钥的 AES-GCM
+	header      []byte      // Stream header bound into each chunk // 绑定到每个分块的流头部
+	noncePrefix []byte      // Random nonce prefix of the stream // 流的随机 nonce 前缀
+	sequence    uint64      // Sequence number of the next chunk // 下一个分块的序号
+}
+
+func newStreamFramer(gcm cipher.AEAD, header []byte, noncePrefix []byte) *streamFramer {
+	return &streamFramer{
+		gcm:         gcm,
+		header:      header,
+		noncePrefix: noncePrefix,
+	}
+}
+
+// next returns the nonce and additional data of the next chunk and advances the sequence
+//
+// next 返回下一个分块的 nonce 和附加数据并推进序号
+func (f *streamFramer) next(flag byte) (nonce []byte, aad []byte) {
+	nonce = binary.BigEndian.AppendUint64(bytes.Clone(f.noncePrefix), f.sequence)
+	aad = binary.BigEndian.AppendUint64(bytes.Clone(f.header), f.sequence)
+	aad = append(aad, flag)
+	f.sequence++
+	return nonce, aad
+}
+
+// encryptWriter buffers plaintext into chunks and writes frames: flag | uint32 len | sealed
+//
+// encryptWriter 将明文缓冲为分块并写出帧：标志 | uint32 长度 | 密文
+type encryptWriter struct {
+	w      io.Writer     // Destination of encrypted frames // 加密帧的输出目标
+	framer *streamFramer // Chunk sealing state // 分块加密状态
+	buffer []byte        // Pending plaintext of the current chunk // 当前分块待加密的明文
+	closed bool          // Whether the final chunk is written // 是否已写出最后一个分块
+	err    error         // Sticky write exception // 持续生效的写入异常
+}
+
+// Write buffers p and emits full chunks as they fill up
+//
+// Write 缓冲 p，并在分块填满时输出
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.closed {
+		return 0, erero.New("write to closed encrypt writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		if len(e.buffer) == streamChunkSize {
+			if err := e.flush(chunkFlagMore); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buffer[len(e.buffer):streamChunkSize], p)
+		e.buffer = e.buffer[:len(e.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close emits the final chunk holding the remaining plaintext, possibly empty
+// Does not close the underlying writer
+//
+// Close 输出包含剩余明文（可能为空）的最后一个分块
+// 不会关闭底层写入器
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return nil
+	}
+	if err := e.flush(chunkFlagFinal); err != nil {
+		return err
+	}
+	e.closed = true
+	clear(e.buffer)
+	return nil
+}
+
+func (e *encryptWriter) flush(flag byte) error {
+	nonce, aad := e.framer.next(flag)
+	frame := make([]byte, 5, 5+len(e.buffer)+e.framer.gcm.Overhead())
+	frame[0] = flag
+	frame = e.framer.gcm.Seal(frame, nonce, e.buffer, aad)
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(frame)-5))
+	clear(e.buffer)
+	e.buffer = e.buffer[:0]
+
+	if _, err := e.w.Write(frame); err != nil {
+		e.err = erero.Wro(err)
+		return e.err
+	}
+	return nil
+}
+
+// decryptReader reads and opens frames one chunk at a time
+//
+// decryptReader 逐个分块读取并解密帧
+type decryptReader struct {
+	r         io.Reader     // Source of encrypted frames // 加密帧的来源
+	framer    *streamFramer // Chunk opening state // 分块解密状态
+	chunkSize int           // Plaintext chunk size from the header // 头部中的明文分块长度
+	plaintext []byte        // Decrypted bytes not yet returned // 尚未返回的已解密字节
+	done      bool          // Whether the final chunk has been read // 是否已读取最后一个分块
+	err       error         // Sticky read exception // 持续生效的读取异常
+}
+
+// Read returns decrypted bytes, and io.EOF only after the authenticated final chunk
+//
+// Read 返回解密后的字节，只有在读取到经过认证的最后一个分块后才返回 io.EOF
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plaintext) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readChunk(); err != nil {
+			d.err = err
+			return 0, err
+		}
+	}
+	n := copy(p, d.plaintext)
+	d.plaintext = d.plaintext[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readChunk() error {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(d.r, prefix); err != nil {
+		if err == io.EOF {
+			return erero.Wro(io.ErrUnexpectedEOF) // stream ends without the final chunk // 流在最后一个分块之前结束
+		}
+		return erero.Wro(err)
+	}
+	flag := prefix[0]
+	if flag != chunkFlagMore && flag != chunkFlagFinal {
+		return erero.Errorf("stream chunk flag %d is not valid", flag)
+	}
+	size := int(binary.BigEndian.Uint32(prefix[1:5]))
+	if size < d.framer.gcm.Overhead() || size > d.chunkSize+d.framer.gcm.Overhead() {
+		return erero.Errorf("stream chunk length %d is out of range", size)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return erero.Wro(err)
+	}
+
+	nonce, aad := d.framer.next(flag)
+	plaintext, err := d.framer.gcm.Open(sealed[:0], nonce, sealed, aad)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	if flag == chunkFlagFinal {
+		var extra [1]byte
+		n, err := io.ReadFull(d.r, extra[:])
+		if n != 0 {
+			return erero.New("stream has trailing data after the final chunk")
+		}
+		if err != io.EOF {
+			return erero.Wro(err) // a failing source is not a clean end of stream // 读取失败不能视为流正常结束
+		}
+		d.done = true
+	}
+	d.plaintext = plaintext // only handed out once the final chunk is known to end the stream // 确认最后一个分块结束了流之后才交出明文
+	return nil
+}
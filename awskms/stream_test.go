@@ -0,0 +1,137 @@
+package awskms_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encryptStream encrypts msg through NewEncryptWriter in odd-sized writes
+//
+// encryptStream 以不规则大小的写入方式通过 NewEncryptWriter 加密 msg
+func encryptStream(t *testing.T, write func(w io.Writer) (io.WriteCloser, error), msg []byte) []byte {
+	var buffer bytes.Buffer
+	writer, err := write(&buffer)
+	require.NoError(t, err)
+	for rest := msg; len(rest) > 0; {
+		n := min(len(rest), 10007)
+		_, err := writer.Write(rest[:n])
+		require.NoError(t, err)
+		rest = rest[n:]
+	}
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+// TestAwsKms_NewEncryptWriter tests streaming round trips across chunk boundaries
+//
+// TestAwsKms_NewEncryptWriter 测试跨分块边界的流式加解密往返
+func TestAwsKms_NewEncryptWriter(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+
+	for _, size := range []int{0, 1, 64 << 10, 3<<20 + 123} {
+		msg := make([]byte, size)
+		_, err := rand.Read(msg)
+		require.NoError(t, err)
+
+		stream := encryptStream(t, awsKms.NewEncryptWriter, msg)
+
+		reader, err := awsKms.NewDecryptReader(bytes.NewReader(stream))
+		require.NoError(t, err)
+		plaintext, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, msg, plaintext)
+	}
+}
+
+// TestAwsKms_NewDecryptReader tests detection of truncated, reordered, tampered and extended streams
+// Frames are flag | uint32 length | sealed, with 64 KiB plaintext in each non-final chunk
+//
+// TestAwsKms_NewDecryptReader 测试对截断、重排、篡改和追加数据的流的检测
+// 帧格式为 标志 | uint32 长度 | 密文，每个非最后分块包含 64 KiB 明文
+func TestAwsKms_NewDecryptReader(t *testing.T) {
+	awsKms, _ := newFakeAwsKms(t)
+
+	msg := make([]byte, 3<<16+100)
+	_, err := rand.Read(msg)
+	require.NoError(t, err)
+	stream := encryptStream(t, awsKms.NewEncryptWriter, msg)
+
+	const frameSize = 5 + 64<<10 + 16
+	const finalSize = 5 + 100 + 16
+	headerSize := len(stream) - 3*frameSize - finalSize
+
+	decrypt := func(data []byte) error {
+		reader, err := awsKms.NewDecryptReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(reader)
+		return err
+	}
+	require.NoError(t, decrypt(stream))
+
+	t.Run("DropFinalChunk", func(t *testing.T) {
+		require.ErrorIs(t, decrypt(stream[:len(stream)-finalSize]), io.ErrUnexpectedEOF)
+	})
+
+	t.Run("CutInsideChunk", func(t *testing.T) {
+		require.Error(t, decrypt(stream[:len(stream)-10]))
+	})
+
+	t.Run("ReorderChunks", func(t *testing.T) {
+		first := stream[headerSize : headerSize+frameSize]
+		second := stream[headerSize+frameSize : headerSize+2*frameSize]
+
+		reordered := bytes.Clone(stream[:headerSize])
+		reordered = append(reordered, second...)
+		reordered = append(reordered, first...)
+		reordered = append(reordered, stream[headerSize+2*frameSize:]...)
+		require.Error(t, decrypt(reordered))
+	})
+
+	t.Run("MarkChunkFinal", func(t *testing.T) {
+		tampered := bytes.Clone(stream[:headerSize+frameSize])
+		tampered[headerSize] = 0x01
+		require.Error(t, decrypt(tampered))
+	})
+
+	t.Run("FlipCiphertextBit", func(t *testing.T) {
+		tampered := bytes.Clone(stream)
+		tampered[headerSize+100] ^= 0x01
+		require.Error(t, decrypt(tampered))
+	})
+
+	t.Run("TrailingData", func(t *testing.T) {
+		require.Error(t, decrypt(append(bytes.Clone(stream), 0x00)))
+
+		// the final chunk stays withheld on every later Read // 之后的每次 Read 都不会交出最后一个分块
+		reader, err := awsKms.NewDecryptReader(bytes.NewReader(append(bytes.Clone(stream), 0x00)))
+		require.NoError(t, err)
+		_, err = io.ReadAll(reader)
+		require.Error(t, err)
+		n, err := reader.Read(make([]byte, 1024))
+		require.Error(t, err)
+		require.Zero(t, n)
+	})
+
+	t.Run("ReadErrorAfterFinal", func(t *testing.T) {
+		errRead := errors.New("connection reset")
+		reader, err := awsKms.NewDecryptReader(io.MultiReader(bytes.NewReader(stream), iotest.ErrReader(errRead)))
+		require.NoError(t, err)
+		_, err = io.ReadAll(reader)
+		require.ErrorIs(t, err, errRead)
+		n, err := reader.Read(make([]byte, 1024))
+		require.ErrorIs(t, err, errRead)
+		require.Zero(t, n)
+	})
+
+	t.Run("NotStream", func(t *testing.T) {
+		require.Error(t, decrypt([]byte("not an encrypted stream")))
+	})
+}
@@ -0,0 +1,81 @@
+package awskmseth
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/yyle88/erero"
+	"golang.org/x/crypto/sha3"
+)
+
+// Address is a 20-byte Ethereum account address
+//
+// Address 是 20 字节的以太坊账户地址
+type Address [20]byte
+
+// PublicKeyToAddress derives the address as the last 20 bytes of keccak256 over the uncompressed public key point
+//
+// PublicKeyToAddress 将未压缩公钥点 keccak256 哈希的后 20 字节作为地址
+func PublicKeyToAddress(publicKey *secp256k1.PublicKey) Address {
+	var address Address
+	copy(address[:], Keccak256(publicKey.SerializeUncompressed()[1:])[12:])
+	return address
+}
+
+// HexToAddress parses a 0x prefixed hex address, checking the EIP-55 checksum when the input is mixed case
+//
+// HexToAddress 解析 0x 前缀的十六进制地址，输入为大小写混合时检查 EIP-55 校验和
+func HexToAddress(text string) (Address, error) {
+	var address Address
+	digits, ok := strings.CutPrefix(text, "0x")
+	if !ok {
+		digits, ok = strings.CutPrefix(text, "0X")
+	}
+	if !ok || len(digits) != 2*len(address) {
+		return address, erero.Errorf("address %q is not 0x followed by 40 hex digits", text)
+	}
+	if _, err := hex.Decode(address[:], []byte(digits)); err != nil {
+		return address, erero.Wro(err)
+	}
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && address.Hex() != "0x"+digits {
+		return address, erero.Errorf("address %q has an invalid EIP-55 checksum", text)
+	}
+	return address, nil
+}
+
+// Hex returns the EIP-55 mixed case checksum encoding
+//
+// Hex 返回 EIP-55 大小写混合的校验和编码
+func (a Address) Hex() string {
+	digits := []byte(hex.EncodeToString(a[:]))
+	hash := Keccak256(digits)
+	for idx, digit := range digits {
+		nibble := hash[idx/2] >> 4
+		if idx%2 == 1 {
+			nibble = hash[idx/2] & 0x0f
+		}
+		if digit >= 'a' && nibble >= 8 {
+			digits[idx] = digit - 'a' + 'A'
+		}
+	}
+	return "0x" + string(digits)
+}
+
+// String returns the EIP-55 encoding
+//
+// String 返回 EIP-55 编码
+func (a Address) String() string {
+	return a.Hex()
+}
+
+// Keccak256 returns the legacy Keccak-256 hash that Ethereum uses, which differs from SHA3-256 in padding
+//
+// Keccak256 返回以太坊使用的旧版 Keccak-256 哈希，与 SHA3-256 的填充方式不同
+func Keccak256(data ...[]byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	for _, one := range data {
+		hash.Write(one)
+	}
+	return hash.Sum(nil)
+}
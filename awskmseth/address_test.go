@@ -0,0 +1,51 @@
+package awskmseth_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/go-xlan/go-aws-kms/awskmseth"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPublicKeyToAddress tests the address of the well-known private key 1
+//
+// TestPublicKeyToAddress 测试众所周知的私钥 1 对应的地址
+func TestPublicKeyToAddress(t *testing.T) {
+	privateKey := secp256k1.PrivKeyFromBytes([]byte{1})
+	address := awskmseth.PublicKeyToAddress(privateKey.PubKey())
+	require.Equal(t, "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf", address.Hex())
+}
+
+// TestHexToAddress tests EIP-55 checksum encoding and validation
+//
+// TestHexToAddress 测试 EIP-55 校验和编码与校验
+func TestHexToAddress(t *testing.T) {
+	for _, text := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		address, err := awskmseth.HexToAddress(text)
+		require.NoError(t, err)
+		require.Equal(t, text, address.Hex())
+	}
+
+	address, err := awskmseth.HexToAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed")
+	require.NoError(t, err)
+	require.Equal(t, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", address.String())
+
+	_, err = awskmseth.HexToAddress("0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	require.Error(t, err)
+	_, err = awskmseth.HexToAddress("5aaeb6053f3e94c9b9a09f33669435e7ef1beaed")
+	require.Error(t, err)
+}
+
+// TestKeccak256 tests the legacy Keccak-256 padding, which differs from SHA3-256
+//
+// TestKeccak256 测试旧版 Keccak-256 填充，与 SHA3-256 不同
+func TestKeccak256(t *testing.T) {
+	require.Equal(t, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", hex.EncodeToString(awskmseth.Keccak256()))
+}
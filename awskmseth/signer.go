@@ -0,0 +1,278 @@
+// Package awskmseth: Ethereum signing with AWS KMS ECC_SECG_P256K1 keys
+// Derives the account address from the KMS public key and converts KMS DER signatures into 65-byte recoverable R||S||V
+// Signs transaction hashes, EIP-191 personal messages and EIP-712 typed data, the private key never leaves KMS
+//
+// awskmseth: 使用 AWS KMS ECC_SECG_P256K1 密钥进行以太坊签名
+// 根据 KMS 公钥推导账户地址，并将 KMS DER 签名转换为 65 字节可恢复的 R||S||V
+// 对交易哈希、EIP-191 个人消息和 EIP-712 结构化数据签名，私钥不会离开 KMS
+package awskmseth
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+var (
+	oidPublicKeyEcdsa = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1} // id-ecPublicKey // id-ecPublicKey
+	oidCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}       // secp256k1 named curve // secp256k1 命名曲线
+)
+
+// Signer signs Ethereum hashes with a KMS ECC_SECG_P256K1 SIGN_VERIFY key
+// Signatures are normalized to low-S and carry the recovery ID, as Ethereum requires
+// Safe in concurrent use across goroutines
+//
+// Signer 使用 KMS ECC_SECG_P256K1 SIGN_VERIFY 密钥对以太坊哈希签名
+// 签名按以太坊要求规范化为低位 S 并携带恢复 ID
+// 可在多个 goroutine 中并发使用
+type Signer struct {
+	client    awskms.SignerAPI     // AWS KMS client to handle API operations // AWS KMS 客户端用于处理 API 操作
+	signKeyID string               // KMS ID used in signing // 用于签名的 KMS ID
+	kmsSigner *awskms.AwsKmsSigner // ECDSA_SHA_256 digest signer // ECDSA_SHA_256 摘要签名器
+	mutex     sync.Mutex           // Guards the cached public key // 保护缓存的公钥
+	publicKey *secp256k1.PublicKey // Cached public key, nil until fetched // 缓存的公钥，获取前为 nil
+}
+
+// NewSigner creates Signer with given KMS client and ECC_SECG_P256K1 key ID
+//
+// NewSigner 使用给定的 KMS 客户端和 ECC_SECG_P256K1 密钥 ID 创建 Signer
+func NewSigner(client awskms.SignerAPI, signKeyID string) *Signer {
+	return &Signer{
+		client:    utils.MustClient(client),
+		signKeyID: must.Nice(signKeyID),
+		kmsSigner: awskms.NewAwsKmsSigner(client, signKeyID, types.SigningAlgorithmSpecEcdsaSha256),
+	}
+}
+
+// PublicKey returns the secp256k1 public key, fetched once through KMS GetPublicKey then cached
+//
+// PublicKey 返回 secp256k1 公钥，首次通过 KMS GetPublicKey 获取后缓存
+func (s *Signer) PublicKey() (*secp256k1.PublicKey, error) {
+	return s.PublicKeyContext(context.Background())
+}
+
+// PublicKeyContext returns the secp256k1 public key with the given context
+//
+// PublicKeyContext 使用给定的上下文返回 secp256k1 公钥
+func (s *Signer) PublicKeyContext(ctx context.Context) (*secp256k1.PublicKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.publicKey != nil {
+		return s.publicKey, nil
+	}
+	res, err := s.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: &s.signKeyID})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if res.KeySpec != types.KeySpecEccSecgP256k1 {
+		return nil, erero.Errorf("key spec %s is not %s", res.KeySpec, types.KeySpecEccSecgP256k1)
+	}
+	publicKey, err := parseSecp256k1PublicKey(res.PublicKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	s.publicKey = publicKey
+	return publicKey, nil
+}
+
+// Address returns the Ethereum address of the KMS key
+//
+// Address 返回 KMS 密钥的以太坊地址
+func (s *Signer) Address() (Address, error) {
+	return s.AddressContext(context.Background())
+}
+
+// AddressContext returns the Ethereum address of the KMS key with the given context
+//
+// AddressContext 使用给定的上下文返回 KMS 密钥的以太坊地址
+func (s *Signer) AddressContext(ctx context.Context) (Address, error) {
+	publicKey, err := s.PublicKeyContext(ctx)
+	if err != nil {
+		return Address{}, erero.Wro(err)
+	}
+	return PublicKeyToAddress(publicKey), nil
+}
+
+// SignHash signs a 32-byte hash, such as a transaction signing hash, returning R||S||V with V of 0 or 1
+// EIP-155 transactions then encode v as V + 35 + 2*chainID, typed transactions use V as is
+//
+// SignHash 对 32 字节哈希（例如交易签名哈希）签名，返回 R||S||V，V 为 0 或 1
+// EIP-155 交易随后将 v 编码为 V + 35 + 2*chainID，类型化交易直接使用 V
+func (s *Signer) SignHash(hash []byte) ([]byte, error) {
+	return s.SignHashContext(context.Background(), hash)
+}
+
+// SignHashContext signs a 32-byte hash with the given context
+//
+// SignHashContext 使用给定的上下文对 32 字节哈希签名
+func (s *Signer) SignHashContext(ctx context.Context, hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, erero.Errorf("hash length %d is not 32", len(hash))
+	}
+	publicKey, err := s.PublicKeyContext(ctx)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	der, err := s.kmsSigner.SignDigestContext(ctx, hash)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return recoverableSignature(der, hash, publicKey)
+}
+
+// SignPersonalMessage signs an EIP-191 personal message, as eth_sign and personal_sign do, with V of 27 or 28
+//
+// SignPersonalMessage 与 eth_sign 和 personal_sign 一样对 EIP-191 个人消息签名，V 为 27 或 28
+func (s *Signer) SignPersonalMessage(message []byte) ([]byte, error) {
+	return s.SignPersonalMessageContext(context.Background(), message)
+}
+
+// SignPersonalMessageContext signs an EIP-191 personal message with the given context
+//
+// SignPersonalMessageContext 使用给定的上下文对 EIP-191 个人消息签名
+func (s *Signer) SignPersonalMessageContext(ctx context.Context, message []byte) ([]byte, error) {
+	signature, err := s.SignHashContext(ctx, PersonalMessageHash(message))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	signature[64] += 27
+	return signature, nil
+}
+
+// SignTypedData signs EIP-712 typed data, as eth_signTypedData_v4 does, with V of 27 or 28
+//
+// SignTypedData 与 eth_signTypedData_v4 一样对 EIP-712 结构化数据签名，V 为 27 或 28
+func (s *Signer) SignTypedData(typedData *TypedData) ([]byte, error) {
+	return s.SignTypedDataContext(context.Background(), typedData)
+}
+
+// SignTypedDataContext signs EIP-712 typed data with the given context
+//
+// SignTypedDataContext 使用给定的上下文对 EIP-712 结构化数据签名
+func (s *Signer) SignTypedDataContext(ctx context.Context, typedData *TypedData) ([]byte, error) {
+	hash, err := typedData.Hash()
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	signature, err := s.SignHashContext(ctx, hash)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	signature[64] += 27
+	return signature, nil
+}
+
+// PersonalMessageHash returns the EIP-191 hash keccak256("\x19Ethereum Signed Message:\n" + len(message) + message)
+//
+// PersonalMessageHash 返回 EIP-191 哈希 keccak256("\x19Ethereum Signed Message:\n" + len(message) + message)
+func PersonalMessageHash(message []byte) []byte {
+	return Keccak256([]byte("\x19Ethereum Signed Message:\n"+strconv.Itoa(len(message))), message)
+}
+
+// RecoverAddress recovers the signer address of a 65-byte R||S||V signature, accepting V of 0, 1, 27 or 28
+// Rejects high-S signatures the way Ethereum does
+//
+// RecoverAddress 从 65 字节 R||S||V 签名恢复签名者地址，接受 V 为 0、1、27 或 28
+// 与以太坊一样拒绝高位 S 签名
+func RecoverAddress(hash []byte, signature []byte) (Address, error) {
+	if len(hash) != 32 || len(signature) != 65 {
+		return Address{}, erero.New("hash must be 32 bytes and signature 65 bytes")
+	}
+	recoveryID := signature[64]
+	if recoveryID >= 27 {
+		recoveryID -= 27
+	}
+	if recoveryID > 1 {
+		return Address{}, erero.Errorf("signature V %d is not valid", signature[64])
+	}
+	var sValue secp256k1.ModNScalar
+	if sValue.SetByteSlice(signature[32:64]) || sValue.IsOverHalfOrder() {
+		return Address{}, erero.New("signature S is not in the low half of the curve order")
+	}
+	publicKey, _, err := ecdsa.RecoverCompact(compactSignature(signature[:64], recoveryID), hash)
+	if err != nil {
+		return Address{}, erero.Wro(err)
+	}
+	return PublicKeyToAddress(publicKey), nil
+}
+
+// recoverableSignature converts a KMS DER signature into low-S R||S||V, finding V by public key recovery
+//
+// recoverableSignature 将 KMS DER 签名转换为低位 S 的 R||S||V，通过公钥恢复确定 V
+func recoverableSignature(der []byte, hash []byte, publicKey *secp256k1.PublicKey) ([]byte, error) {
+	var values struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &values)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if len(rest) != 0 || values.R.Sign() <= 0 || values.S.Sign() <= 0 || values.R.BitLen() > 256 || values.S.BitLen() > 256 {
+		return nil, erero.New("ECDSA signature is malformed")
+	}
+	var sValue secp256k1.ModNScalar
+	if sValue.SetByteSlice(values.S.Bytes()) {
+		return nil, erero.New("ECDSA signature S is not below the curve order")
+	}
+	if sValue.IsOverHalfOrder() {
+		sValue.Negate()
+	}
+	signature := make([]byte, 65)
+	values.R.FillBytes(signature[:32])
+	sValue.PutBytesUnchecked(signature[32:64])
+
+	for recoveryID := byte(0); recoveryID < 2; recoveryID++ {
+		recovered, _, err := ecdsa.RecoverCompact(compactSignature(signature[:64], recoveryID), hash)
+		if err == nil && recovered.IsEqual(publicKey) {
+			signature[64] = recoveryID
+			return signature, nil
+		}
+	}
+	return nil, erero.New("signature does not recover the KMS public key")
+}
+
+// compactSignature builds the recovery code||R||S form that the secp256k1 package recovers from
+//
+// compactSignature 构建 secp256k1 包用于恢复公钥的 恢复码||R||S 格式
+func compactSignature(rs []byte, recoveryID byte) []byte {
+	return append([]byte{27 + recoveryID}, rs...)
+}
+
+// parseSecp256k1PublicKey parses the DER SubjectPublicKeyInfo of a secp256k1 key, which crypto/x509 does not support
+//
+// parseSecp256k1PublicKey 解析 secp256k1 密钥的 DER SubjectPublicKeyInfo，crypto/x509 不支持该曲线
+func parseSecp256k1PublicKey(der []byte) (*secp256k1.PublicKey, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if len(rest) != 0 || !info.Algorithm.Algorithm.Equal(oidPublicKeyEcdsa) {
+		return nil, erero.New("public key is not an EC SubjectPublicKeyInfo")
+	}
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &curve); err != nil {
+		return nil, erero.Wro(err)
+	}
+	if !curve.Equal(oidCurveSecp256k1) {
+		return nil, erero.Errorf("public key curve %s is not secp256k1", curve)
+	}
+	publicKey, err := secp256k1.ParsePubKey(info.PublicKey.Bytes)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return publicKey, nil
+}
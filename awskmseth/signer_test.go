@@ -0,0 +1,94 @@
+package awskmseth_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskmseth"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSigner_SignHash tests signatures are low-S and recover the address of the KMS key
+// Repeats so that KMS signatures with high S, which the fake emits at random, get normalized
+//
+// TestSigner_SignHash 测试签名为低位 S 并可恢复出 KMS 密钥的地址
+// 多次重复，使假实现随机产生的高位 S 签名也经过规范化
+func TestSigner_SignHash(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	signer := awskmseth.NewSigner(fake, fake.MustCreateKey(types.KeySpecEccSecgP256k1, types.KeyUsageTypeSignVerify))
+
+	address, err := signer.Address()
+	require.NoError(t, err)
+
+	for idx := 0; idx < 16; idx++ {
+		hash := awskmseth.Keccak256([]byte{byte(idx)})
+		signature, err := signer.SignHash(hash)
+		require.NoError(t, err)
+		require.Len(t, signature, 65)
+		require.LessOrEqual(t, signature[64], byte(1))
+
+		recovered, err := awskmseth.RecoverAddress(hash, signature)
+		require.NoError(t, err)
+		require.Equal(t, address, recovered)
+	}
+
+	t.Run("BadHash", func(t *testing.T) {
+		_, err := signer.SignHash([]byte("short"))
+		require.Error(t, err)
+	})
+
+	t.Run("WrongKeySpec", func(t *testing.T) {
+		other := awskmseth.NewSigner(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify))
+		_, err := other.Address()
+		require.Error(t, err)
+	})
+}
+
+// TestSigner_SignPersonalMessage tests EIP-191 and EIP-712 signatures carry V of 27 or 28
+//
+// TestSigner_SignPersonalMessage 测试 EIP-191 和 EIP-712 签名的 V 为 27 或 28
+func TestSigner_SignPersonalMessage(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	signer := awskmseth.NewSigner(fake, fake.MustCreateKey(types.KeySpecEccSecgP256k1, types.KeyUsageTypeSignVerify))
+	address, err := signer.Address()
+	require.NoError(t, err)
+
+	signature, err := signer.SignPersonalMessage([]byte("hello"))
+	require.NoError(t, err)
+	require.Contains(t, []byte{27, 28}, signature[64])
+	recovered, err := awskmseth.RecoverAddress(awskmseth.PersonalMessageHash([]byte("hello")), signature)
+	require.NoError(t, err)
+	require.Equal(t, address, recovered)
+
+	typedData, err := awskmseth.ParseTypedData([]byte(mailTypedData))
+	require.NoError(t, err)
+	signature, err = signer.SignTypedData(typedData)
+	require.NoError(t, err)
+	require.Contains(t, []byte{27, 28}, signature[64])
+	hash, err := typedData.Hash()
+	require.NoError(t, err)
+	recovered, err = awskmseth.RecoverAddress(hash, signature)
+	require.NoError(t, err)
+	require.Equal(t, address, recovered)
+
+	t.Run("HighS", func(t *testing.T) {
+		order := []byte{
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe,
+			0xba, 0xae, 0xdc, 0xe6, 0xaf, 0x48, 0xa0, 0x3b, 0xbf, 0xd2, 0x5e, 0x8c, 0xd0, 0x36, 0x41, 0x41,
+		}
+		highS := append([]byte{}, signature...)
+		borrow := 0
+		for idx := 31; idx >= 0; idx-- {
+			value := int(order[idx]) - int(signature[32+idx]) - borrow
+			borrow = 0
+			if value < 0 {
+				value += 256
+				borrow = 1
+			}
+			highS[32+idx] = byte(value)
+		}
+		_, err := awskmseth.RecoverAddress(hash, highS)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,361 @@
+package awskmseth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yyle88/erero"
+)
+
+// TypedDataField is one member of an EIP-712 struct type
+//
+// TypedDataField 是 EIP-712 结构体类型的一个成员
+type TypedDataField struct {
+	Name string `json:"name"` // Member name // 成员名称
+	Type string `json:"type"` // Solidity type, struct name or array of them // Solidity 类型、结构体名称或它们的数组
+}
+
+// TypedData is the EIP-712 payload in the JSON shape of eth_signTypedData_v4
+// Numbers may be JSON numbers, decimal strings or 0x hex strings, bytes and addresses are 0x hex strings
+//
+// TypedData 是 EIP-712 载荷，JSON 结构与 eth_signTypedData_v4 一致
+// 数值可以是 JSON 数字、十进制字符串或 0x 十六进制字符串，bytes 和地址为 0x 十六进制字符串
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`       // Struct type definitions // 结构体类型定义
+	PrimaryType string                      `json:"primaryType"` // Type of the message // 消息的类型
+	Domain      map[string]any              `json:"domain"`      // EIP712Domain values // EIP712Domain 的值
+	Message     map[string]any              `json:"message"`     // Message values // 消息的值
+}
+
+// domainFields lists the EIP712Domain members in canonical order, used when types omit EIP712Domain
+//
+// domainFields 按规范顺序列出 EIP712Domain 成员，types 中缺少 EIP712Domain 时使用
+var domainFields = []TypedDataField{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "chainId", Type: "uint256"},
+	{Name: "verifyingContract", Type: "address"},
+	{Name: "salt", Type: "bytes32"},
+}
+
+// ParseTypedData decodes eth_signTypedData_v4 JSON, keeping numbers exact
+//
+// ParseTypedData 解码 eth_signTypedData_v4 JSON，并保持数值精确
+func ParseTypedData(data []byte) (*TypedData, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var typedData TypedData
+	if err := decoder.Decode(&typedData); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &typedData, nil
+}
+
+// Hash returns the EIP-712 signing hash keccak256(0x19 0x01 || domainSeparator || hashStruct(message))
+//
+// Hash 返回 EIP-712 签名哈希 keccak256(0x19 0x01 || domainSeparator || hashStruct(message))
+func (d *TypedData) Hash() ([]byte, error) {
+	domainSeparator, err := d.DomainSeparator()
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if d.PrimaryType == "EIP712Domain" {
+		return Keccak256([]byte{0x19, 0x01}, domainSeparator), nil
+	}
+	messageHash, err := d.hashStruct(d.PrimaryType, d.Message)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return Keccak256([]byte{0x19, 0x01}, domainSeparator, messageHash), nil
+}
+
+// DomainSeparator returns hashStruct(domain), deriving the EIP712Domain type from the domain keys when absent
+//
+// DomainSeparator 返回 hashStruct(domain)，缺少 EIP712Domain 类型时根据 domain 的键推导
+func (d *TypedData) DomainSeparator() ([]byte, error) {
+	if _, ok := d.Types["EIP712Domain"]; ok {
+		return d.hashStruct("EIP712Domain", d.Domain)
+	}
+	fields := make([]TypedDataField, 0, len(domainFields))
+	for _, field := range domainFields {
+		if _, ok := d.Domain[field.Name]; ok {
+			fields = append(fields, field)
+		}
+	}
+	derived := &TypedData{Types: map[string][]TypedDataField{"EIP712Domain": fields}}
+	for name, fields := range d.Types {
+		derived.Types[name] = fields
+	}
+	return derived.hashStruct("EIP712Domain", d.Domain)
+}
+
+// hashStruct returns keccak256(typeHash || encodeData(value))
+//
+// hashStruct 返回 keccak256(typeHash || encodeData(value))
+func (d *TypedData) hashStruct(typeName string, value map[string]any) ([]byte, error) {
+	fields, ok := d.Types[typeName]
+	if !ok {
+		return nil, erero.Errorf("type %q is not defined", typeName)
+	}
+	encodedType, err := d.encodeType(typeName)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	encoded := Keccak256([]byte(encodedType))
+	for _, field := range fields {
+		word, err := d.encodeValue(field.Type, value[field.Name])
+		if err != nil {
+			return nil, erero.Wrapf(err, "member %s.%s", typeName, field.Name)
+		}
+		encoded = append(encoded, word...)
+	}
+	return Keccak256(encoded), nil
+}
+
+// encodeType returns the type string with its referenced struct types appended in name order
+//
+// encodeType 返回类型字符串，并按名称顺序追加其引用的结构体类型
+func (d *TypedData) encodeType(typeName string) (string, error) {
+	dependencies := map[string]bool{}
+	if err := d.collectDependencies(typeName, dependencies); err != nil {
+		return "", erero.Wro(err)
+	}
+	delete(dependencies, typeName)
+	names := make([]string, 0, len(dependencies))
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var builder strings.Builder
+	for _, name := range append([]string{typeName}, names...) {
+		builder.WriteString(name)
+		builder.WriteString("(")
+		for idx, field := range d.Types[name] {
+			if idx > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(field.Type)
+			builder.WriteString(" ")
+			builder.WriteString(field.Name)
+		}
+		builder.WriteString(")")
+	}
+	return builder.String(), nil
+}
+
+// collectDependencies gathers the struct types reachable from the type
+//
+// collectDependencies 收集从该类型可达的结构体类型
+func (d *TypedData) collectDependencies(typeName string, dependencies map[string]bool) error {
+	if dependencies[typeName] {
+		return nil
+	}
+	fields, ok := d.Types[typeName]
+	if !ok {
+		return erero.Errorf("type %q is not defined", typeName)
+	}
+	dependencies[typeName] = true
+	for _, field := range fields {
+		baseType := field.Type
+		if idx := strings.Index(baseType, "["); idx >= 0 {
+			baseType = baseType[:idx]
+		}
+		if _, ok := d.Types[baseType]; ok {
+			if err := d.collectDependencies(baseType, dependencies); err != nil {
+				return erero.Wro(err)
+			}
+		}
+	}
+	return nil
+}
+
+// encodeValue encodes one member value into a 32-byte word
+// Dynamic types, structs and arrays are encoded as the keccak256 of their contents
+//
+// encodeValue 将一个成员值编码为 32 字节的字
+// 动态类型、结构体和数组编码为其内容的 keccak256
+func (d *TypedData) encodeValue(typeName string, value any) ([]byte, error) {
+	if strings.HasSuffix(typeName, "]") {
+		open := strings.LastIndex(typeName, "[")
+		if open < 0 {
+			return nil, erero.Errorf("type %q is not valid", typeName)
+		}
+		items, ok := value.([]any)
+		if !ok {
+			return nil, erero.Errorf("value of %s is not an array", typeName)
+		}
+		if size := typeName[open+1 : len(typeName)-1]; size != "" {
+			if length, err := strconv.Atoi(size); err != nil || length != len(items) {
+				return nil, erero.Errorf("value of %s has %d items", typeName, len(items))
+			}
+		}
+		var encoded []byte
+		for _, item := range items {
+			word, err := d.encodeValue(typeName[:open], item)
+			if err != nil {
+				return nil, erero.Wro(err)
+			}
+			encoded = append(encoded, word...)
+		}
+		return Keccak256(encoded), nil
+	}
+	if _, ok := d.Types[typeName]; ok {
+		members, ok := value.(map[string]any)
+		if !ok {
+			return nil, erero.Errorf("value of %s is not an object", typeName)
+		}
+		return d.hashStruct(typeName, members)
+	}
+
+	switch {
+	case typeName == "string":
+		text, ok := value.(string)
+		if !ok {
+			return nil, erero.New("value of string is not a string")
+		}
+		return Keccak256([]byte(text)), nil
+	case typeName == "bytes":
+		data, err := toBytes(value)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return Keccak256(data), nil
+	case typeName == "bool":
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, erero.New("value of bool is not a bool")
+		}
+		word := make([]byte, 32)
+		if flag {
+			word[31] = 1
+		}
+		return word, nil
+	case typeName == "address":
+		text, ok := value.(string)
+		if !ok {
+			return nil, erero.New("value of address is not a string")
+		}
+		address, err := HexToAddress(text)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return append(make([]byte, 12), address[:]...), nil
+	case strings.HasPrefix(typeName, "bytes"):
+		size, err := strconv.Atoi(typeName[len("bytes"):])
+		if err != nil || size < 1 || size > 32 {
+			return nil, erero.Errorf("type %q is not valid", typeName)
+		}
+		data, err := toBytes(value)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		if len(data) != size {
+			return nil, erero.Errorf("value of %s has %d bytes", typeName, len(data))
+		}
+		word := make([]byte, 32)
+		copy(word, data)
+		return word, nil
+	case strings.HasPrefix(typeName, "uint"), strings.HasPrefix(typeName, "int"):
+		return encodeInteger(typeName, value)
+	default:
+		return nil, erero.Errorf("type %q is not supported", typeName)
+	}
+}
+
+// encodeInteger encodes uintN and intN values as 32-byte big-endian two's complement words
+//
+// encodeInteger 将 uintN 和 intN 值编码为 32 字节大端补码字
+func encodeInteger(typeName string, value any) ([]byte, error) {
+	signed := strings.HasPrefix(typeName, "int")
+	bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typeName, "u"), "int"))
+	if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+		return nil, erero.Errorf("type %q is not valid", typeName)
+	}
+	number, err := toBigInt(value)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if signed {
+		limit.Rsh(limit, 1)
+		if number.Cmp(limit) >= 0 || number.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, erero.Errorf("value %s overflows %s", number, typeName)
+		}
+	} else if number.Sign() < 0 || number.Cmp(limit) >= 0 {
+		return nil, erero.Errorf("value %s overflows %s", number, typeName)
+	}
+	if number.Sign() < 0 {
+		number = new(big.Int).Add(number, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return number.FillBytes(make([]byte, 32)), nil
+}
+
+// toBigInt converts JSON numbers, decimal or 0x hex strings and Go integers into big.Int
+//
+// toBigInt 将 JSON 数字、十进制或 0x 十六进制字符串以及 Go 整数转换为 big.Int
+func toBigInt(value any) (*big.Int, error) {
+	var text string
+	switch value := value.(type) {
+	case *big.Int:
+		return new(big.Int).Set(value), nil
+	case json.Number:
+		text = value.String()
+	case string:
+		text = value
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, erero.Errorf("value %v is not an integer", value) // big.NewFloat panics on NaN // big.NewFloat 遇到 NaN 会 panic
+		}
+		number, accuracy := big.NewFloat(value).Int(nil)
+		if accuracy != big.Exact {
+			return nil, erero.Errorf("value %v is not an integer", value)
+		}
+		return number, nil
+	case int:
+		return big.NewInt(int64(value)), nil
+	case int64:
+		return big.NewInt(value), nil
+	case uint64:
+		return new(big.Int).SetUint64(value), nil
+	default:
+		return nil, erero.Errorf("value %v of %T is not an integer", value, value)
+	}
+	base := 10
+	if digits, ok := strings.CutPrefix(text, "0x"); ok {
+		text, base = digits, 16
+	}
+	number, ok := new(big.Int).SetString(text, base)
+	if !ok {
+		return nil, erero.Errorf("value %q is not an integer", text)
+	}
+	return number, nil
+}
+
+// toBytes converts 0x hex strings and byte slices into bytes
+//
+// toBytes 将 0x 十六进制字符串和字节切片转换为字节
+func toBytes(value any) ([]byte, error) {
+	switch value := value.(type) {
+	case []byte:
+		return value, nil
+	case string:
+		digits, ok := strings.CutPrefix(value, "0x")
+		if !ok {
+			return nil, erero.Errorf("value %q is not 0x hex", value)
+		}
+		data, err := hex.DecodeString(digits)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return data, nil
+	default:
+		return nil, erero.Errorf("value %v of %T is not bytes", value, value)
+	}
+}
@@ -0,0 +1,123 @@
+package awskmseth_test
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/go-xlan/go-aws-kms/awskmseth"
+	"github.com/stretchr/testify/require"
+)
+
+// mailTypedData is the example of the EIP-712 specification
+//
+// mailTypedData 是 EIP-712 规范中的示例
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+// TestTypedData_Hash tests the signing hash against the EIP-712 specification example
+//
+// TestTypedData_Hash 使用 EIP-712 规范示例测试签名哈希
+func TestTypedData_Hash(t *testing.T) {
+	typedData, err := awskmseth.ParseTypedData([]byte(mailTypedData))
+	require.NoError(t, err)
+
+	domainSeparator, err := typedData.DomainSeparator()
+	require.NoError(t, err)
+	require.Equal(t, "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f", hex.EncodeToString(domainSeparator))
+
+	hash, err := typedData.Hash()
+	require.NoError(t, err)
+	require.Equal(t, "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", hex.EncodeToString(hash))
+
+	t.Run("DerivedDomain", func(t *testing.T) {
+		delete(typedData.Types, "EIP712Domain")
+		derived, err := typedData.Hash()
+		require.NoError(t, err)
+		require.Equal(t, hash, derived)
+	})
+}
+
+// TestTypedData_Values tests arrays, integers, bytes and invalid values
+//
+// TestTypedData_Values 测试数组、整数、bytes 以及非法值
+func TestTypedData_Values(t *testing.T) {
+	newTypedData := func(fieldType string, value any) *awskmseth.TypedData {
+		return &awskmseth.TypedData{
+			Types: map[string][]awskmseth.TypedDataField{
+				"Order": {{Name: "value", Type: fieldType}},
+			},
+			PrimaryType: "Order",
+			Domain:      map[string]any{"name": "Shop", "chainId": "0x1"},
+			Message:     map[string]any{"value": value},
+		}
+	}
+
+	for _, tc := range []struct {
+		fieldType string
+		value     any
+	}{
+		{"uint256[]", []any{"1", "0x2", 3.0}},
+		{"int8[2]", []any{"-128", "127"}},
+		{"bytes", "0x0102"},
+		{"bytes4", "0x01020304"},
+		{"bool", true},
+	} {
+		_, err := newTypedData(tc.fieldType, tc.value).Hash()
+		require.NoError(t, err, tc.fieldType)
+	}
+
+	for _, tc := range []struct {
+		fieldType string
+		value     any
+	}{
+		{"uint8", "256"},
+		{"uint256", "-1"},
+		{"int8", "128"},
+		{"int8[2]", []any{"1"}},
+		{"bytes4", "0x0102"},
+		{"address", "0x1234"},
+		{"Missing", map[string]any{}},
+		{"uint256", 1.5},
+		{"uint256", math.NaN()},
+		{"uint256", math.Inf(1)},
+	} {
+		_, err := newTypedData(tc.fieldType, tc.value).Hash()
+		require.Error(t, err, tc.fieldType)
+	}
+
+	first, err := newTypedData("uint256", "010").Hash()
+	require.NoError(t, err)
+	second, err := newTypedData("uint256", 10.0).Hash()
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+}
@@ -0,0 +1,440 @@
+package awskmsjwt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// KeyAlgorithm is the JWE "alg" header value, naming how the content key is wrapped
+//
+// KeyAlgorithm 是 JWE 的 "alg" 头部值，表示内容密钥的包装方式
+type KeyAlgorithm string
+
+const (
+	RSAOAEP    KeyAlgorithm = "RSA-OAEP"     // RSAES-OAEP with SHA-1 on an RSA KMS key // 基于 RSA KMS 密钥的 SHA-1 RSAES-OAEP
+	RSAOAEP256 KeyAlgorithm = "RSA-OAEP-256" // RSAES-OAEP with SHA-256 on an RSA KMS key // 基于 RSA KMS 密钥的 SHA-256 RSAES-OAEP
+	AWSKMS     KeyAlgorithm = "AWS-KMS"      // Custom alg, content key is a KMS Encrypt blob of a symmetric key // 自定义算法，内容密钥为对称 KMS 密钥的 Encrypt 密文
+)
+
+// A256GCM is the only supported JWE "enc" content encryption
+//
+// A256GCM 是唯一支持的 JWE "enc" 内容加密算法
+const A256GCM = "A256GCM"
+
+// oaepAlgorithms maps the RSA JWE algorithms to KMS encryption algorithms
+//
+// oaepAlgorithms 将 RSA JWE 算法映射为 KMS 加密算法
+var oaepAlgorithms = map[KeyAlgorithm]types.EncryptionAlgorithmSpec{
+	RSAOAEP:    types.EncryptionAlgorithmSpecRsaesOaepSha1,
+	RSAOAEP256: types.EncryptionAlgorithmSpecRsaesOaepSha256,
+}
+
+// JweHeader is the JOSE header of JWE messages
+//
+// JweHeader 是 JWE 消息的 JOSE 头部
+type JweHeader struct {
+	Alg  KeyAlgorithm `json:"alg"`            // Key management algorithm // 密钥管理算法
+	Enc  string       `json:"enc"`            // Content encryption algorithm // 内容加密算法
+	Kid  string       `json:"kid,omitempty"`  // Key ID of the wrapping key // 包装密钥的 ID
+	Cty  string       `json:"cty,omitempty"`  // Content type of the plaintext // 明文的内容类型
+	Zip  string       `json:"zip,omitempty"`  // Compression, rejected when present // 压缩算法，出现时拒绝
+	Crit []string     `json:"crit,omitempty"` // Critical extensions, rejected when present // 关键扩展，出现时拒绝
+}
+
+// JweJSON is the JSON serialization of JWE messages
+// Encrypt writes the flattened form, and Decrypt accepts both flattened and general forms
+//
+// JweJSON 是 JWE 消息的 JSON 序列化格式
+// 加密时输出扁平格式，解密时同时接受扁平格式和通用格式
+type JweJSON struct {
+	Protected    string          `json:"protected"`               // Base64url protected header // base64url 受保护头部
+	Unprotected  *JweHeader      `json:"unprotected,omitempty"`   // Shared unprotected header // 共享的非受保护头部
+	Header       *JweHeader      `json:"header,omitempty"`        // Flattened per-recipient header // 扁平格式的接收方头部
+	EncryptedKey string          `json:"encrypted_key,omitempty"` // Flattened wrapped content key // 扁平格式的已包装内容密钥
+	Recipients   []*JweRecipient `json:"recipients,omitempty"`    // General form recipients // 通用格式的接收方列表
+	Aad          string          `json:"aad,omitempty"`           // Base64url additional authenticated data // base64url 附加认证数据
+	Iv           string          `json:"iv"`                      // Base64url GCM nonce // base64url GCM nonce
+	Ciphertext   string          `json:"ciphertext"`              // Base64url ciphertext // base64url 密文
+	Tag          string          `json:"tag"`                     // Base64url GCM tag // base64url GCM 标签
+}
+
+// JweRecipient is one recipient of the general JWE JSON serialization
+//
+// JweRecipient 是通用 JWE JSON 序列化格式中的一个接收方
+type JweRecipient struct {
+	Header       *JweHeader `json:"header,omitempty"`        // Per-recipient header // 接收方头部
+	EncryptedKey string     `json:"encrypted_key,omitempty"` // Base64url wrapped content key // base64url 已包装内容密钥
+}
+
+// Jwe encrypts and decrypts JWE messages with A256GCM content keys wrapped by KMS
+// RSA-OAEP and RSA-OAEP-256 use an RSA ENCRYPT_DECRYPT key, AWS-KMS uses a symmetric key
+// Unwrapping always goes through the AwsKms, the private key never leaves KMS
+//
+// Jwe 使用由 KMS 包装的 A256GCM 内容密钥加密和解密 JWE 消息
+// RSA-OAEP 和 RSA-OAEP-256 使用 RSA ENCRYPT_DECRYPT 密钥，AWS-KMS 使用对称密钥
+// 解包总是通过 AwsKms 完成，私钥不会离开 KMS
+type Jwe struct {
+	awsKms       *awskms.AwsKms       // KMS wrapper used to wrap and unwrap // 用于包装和解包的 KMS 封装
+	alg          KeyAlgorithm         // Key management algorithm // 密钥管理算法
+	kid          string               // Key ID written to the header, empty means none // 写入头部的密钥 ID，为空时不写入
+	rsaEncrypter *awskms.RsaEncrypter // Optional offline RSA wrapping // 可选的离线 RSA 包装
+}
+
+// NewJwe creates Jwe on the AwsKms with the given key management algorithm
+// No kid header is written by default, so messages do not reveal the KMS key ARN
+// Set one with WithKid, or opt in to the AwsKms key ID with WithKeyIDKid
+//
+// NewJwe 使用给定的密钥管理算法基于 AwsKms 创建 Jwe
+// 默认不写入 kid 头部，消息不会暴露 KMS 密钥 ARN
+// 可以通过 WithKid 设置，或通过 WithKeyIDKid 主动选择使用 AwsKms 的密钥 ID
+func NewJwe(awsKms *awskms.AwsKms, alg KeyAlgorithm) (*Jwe, error) {
+	if _, ok := oaepAlgorithms[alg]; !ok && alg != AWSKMS {
+		return nil, erero.Errorf("JWE algorithm %q is not supported", alg)
+	}
+	return &Jwe{
+		awsKms: must.Nice(awsKms),
+		alg:    alg,
+	}, nil
+}
+
+// WithKid sets the kid header written on encryption
+// Returns self in method chaining
+//
+// WithKid 设置加密时写入的 kid 头部
+// 返回自身以支持链式调用
+func (j *Jwe) WithKid(kid string) *Jwe {
+	j.kid = kid
+	return j
+}
+
+// WithKeyIDKid uses the AwsKms key ID as the kid header
+// Opt-in only, a key ARN reveals the AWS account, region and key ID to every recipient
+// Returns self in method chaining
+//
+// WithKeyIDKid 使用 AwsKms 的密钥 ID 作为 kid 头部
+// 需要主动启用，密钥 ARN 会向每个接收方暴露 AWS 账号、区域和密钥 ID
+// 返回自身以支持链式调用
+func (j *Jwe) WithKeyIDKid() *Jwe {
+	j.kid = j.awsKms.KeyID()
+	return j
+}
+
+// WithRsaEncrypter wraps content keys locally with the RSA public key instead of calling KMS Encrypt
+// The encrypter algorithm must match the RSA JWE algorithm
+// Returns self in method chaining
+//
+// WithRsaEncrypter 使用 RSA 公钥在本地包装内容密钥，而不调用 KMS Encrypt
+// 加密器的算法必须与 RSA JWE 算法一致
+// 返回自身以支持链式调用
+func (j *Jwe) WithRsaEncrypter(rsaEncrypter *awskms.RsaEncrypter) *Jwe {
+	must.True(rsaEncrypter.Algorithm() == oaepAlgorithms[j.alg])
+	j.rsaEncrypter = rsaEncrypter
+	return j
+}
+
+// Encrypt encrypts plaintext into a compact JWE
+//
+// Encrypt 将明文加密为紧凑格式的 JWE
+func (j *Jwe) Encrypt(plaintext []byte) (string, error) {
+	return j.EncryptContext(context.Background(), plaintext)
+}
+
+// EncryptContext encrypts plaintext into a compact JWE with the given context
+//
+// EncryptContext 使用给定的上下文将明文加密为紧凑格式的 JWE
+func (j *Jwe) EncryptContext(ctx context.Context, plaintext []byte) (string, error) {
+	protected, encryptedKey, iv, ciphertext, tag, err := j.encrypt(ctx, plaintext, nil)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return strings.Join([]string{
+		protected,
+		encodeSegment(encryptedKey),
+		encodeSegment(iv),
+		encodeSegment(ciphertext),
+		encodeSegment(tag),
+	}, "."), nil
+}
+
+// Decrypt decrypts a compact JWE
+//
+// Decrypt 解密紧凑格式的 JWE
+func (j *Jwe) Decrypt(token string) ([]byte, error) {
+	return j.DecryptContext(context.Background(), token)
+}
+
+// DecryptContext decrypts a compact JWE with the given context
+//
+// DecryptContext 使用给定的上下文解密紧凑格式的 JWE
+func (j *Jwe) DecryptContext(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, erero.New("token is not a compact JWE with five parts")
+	}
+	segments := make([][]byte, 4)
+	for idx, part := range parts[1:] {
+		data, err := decodeSegment(part)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		segments[idx] = data
+	}
+	header, err := decodeProtectedHeader(parts[0])
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return j.decrypt(ctx, header, segments[0], segments[1], segments[2], segments[3], []byte(parts[0]))
+}
+
+// EncryptJSON encrypts plaintext into the flattened JWE JSON serialization
+// The aad is optional additional authenticated data carried in the message
+//
+// EncryptJSON 将明文加密为扁平 JWE JSON 序列化格式
+// aad 是可选的附加认证数据，会随消息一起携带
+func (j *Jwe) EncryptJSON(plaintext []byte, aad []byte) ([]byte, error) {
+	return j.EncryptJSONContext(context.Background(), plaintext, aad)
+}
+
+// EncryptJSONContext encrypts plaintext into the flattened JWE JSON serialization with the given context
+//
+// EncryptJSONContext 使用给定的上下文将明文加密为扁平 JWE JSON 序列化格式
+func (j *Jwe) EncryptJSONContext(ctx context.Context, plaintext []byte, aad []byte) ([]byte, error) {
+	protected, encryptedKey, iv, ciphertext, tag, err := j.encrypt(ctx, plaintext, aad)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	message := &JweJSON{
+		Protected:    protected,
+		EncryptedKey: encodeSegment(encryptedKey),
+		Iv:           encodeSegment(iv),
+		Ciphertext:   encodeSegment(ciphertext),
+		Tag:          encodeSegment(tag),
+	}
+	if len(aad) > 0 {
+		message.Aad = encodeSegment(aad)
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return data, nil
+}
+
+// DecryptJSON decrypts the flattened or general JWE JSON serialization
+// In the general form the first recipient with matching alg and kid is used
+// A recipient kid matches when absent, equal to the configured kid or equal to the AwsKms key ID
+//
+// DecryptJSON 解密扁平或通用 JWE JSON 序列化格式
+// 通用格式中使用第一个 alg 和 kid 匹配的接收方
+// 接收方 kid 为空、等于配置的 kid 或等于 AwsKms 的密钥 ID 时视为匹配
+func (j *Jwe) DecryptJSON(data []byte) ([]byte, error) {
+	return j.DecryptJSONContext(context.Background(), data)
+}
+
+// DecryptJSONContext decrypts the JWE JSON serialization with the given context
+//
+// DecryptJSONContext 使用给定的上下文解密 JWE JSON 序列化格式
+func (j *Jwe) DecryptJSONContext(ctx context.Context, data []byte) ([]byte, error) {
+	var message JweJSON
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, erero.Wro(err)
+	}
+	protected, err := decodeProtectedHeader(message.Protected)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	recipients := message.Recipients
+	if len(recipients) == 0 {
+		recipients = []*JweRecipient{{Header: message.Header, EncryptedKey: message.EncryptedKey}}
+	}
+	var recipient *JweRecipient
+	var header *JweHeader
+	for _, candidate := range recipients {
+		merged, err := mergeJweHeader(protected, message.Unprotected, candidate.Header)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		if merged.Alg == j.alg && j.matchesKid(merged.Kid) {
+			recipient, header = candidate, merged
+			break
+		}
+	}
+	if recipient == nil {
+		return nil, erero.Errorf("no JWE recipient matches alg %q and kid %q", j.alg, j.kid)
+	}
+
+	segments := make([][]byte, 4)
+	for idx, part := range []string{recipient.EncryptedKey, message.Iv, message.Ciphertext, message.Tag} {
+		value, err := decodeSegment(part)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		segments[idx] = value
+	}
+	aad := message.Protected
+	if message.Aad != "" {
+		aad += "." + message.Aad
+	}
+	return j.decrypt(ctx, header, segments[0], segments[1], segments[2], segments[3], []byte(aad))
+}
+
+// encrypt generates a fresh content key, wraps it and seals the plaintext
+// The content key is zeroed once the plaintext is sealed
+// The GCM additional data is the protected header, followed by "." and the aad when present
+//
+// encrypt 生成新的内容密钥，包装后加密明文
+// 明文加密完成后内容密钥会被清零
+// GCM 附加数据为受保护头部，存在 aad 时再拼接 "." 和 aad
+func (j *Jwe) encrypt(ctx context.Context, plaintext []byte, aad []byte) (protected string, encryptedKey, iv, ciphertext, tag []byte, err error) {
+	headerData, err := json.Marshal(&JweHeader{Alg: j.alg, Enc: A256GCM, Kid: j.kid})
+	if err != nil {
+		return "", nil, nil, nil, nil, erero.Wro(err)
+	}
+	protected = encodeSegment(headerData)
+
+	cek := make([]byte, 32)
+	defer clear(cek)
+	if _, err := rand.Read(cek); err != nil {
+		return "", nil, nil, nil, nil, erero.Wro(err)
+	}
+	encryptedKey, err = j.wrapKey(ctx, cek)
+	if err != nil {
+		return "", nil, nil, nil, nil, erero.Wro(err)
+	}
+
+	gcm, err := utils.NewAesGcm(cek)
+	if err != nil {
+		return "", nil, nil, nil, nil, erero.Wro(err)
+	}
+	iv = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", nil, nil, nil, nil, erero.Wro(err)
+	}
+	additionalData := protected
+	if len(aad) > 0 {
+		additionalData += "." + encodeSegment(aad)
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(additionalData))
+	tagOffset := len(sealed) - gcm.Overhead()
+	return protected, encryptedKey, iv, sealed[:tagOffset], sealed[tagOffset:], nil
+}
+
+// decrypt checks the header, unwraps the content key through KMS and opens the ciphertext
+// The unwrapped content key is zeroed after use
+//
+// decrypt 检查头部，通过 KMS 解包内容密钥并解密密文
+// 解包出的内容密钥用完后会被清零
+func (j *Jwe) decrypt(ctx context.Context, header *JweHeader, encryptedKey, iv, ciphertext, tag []byte, additionalData []byte) ([]byte, error) {
+	if header.Alg != j.alg {
+		return nil, erero.Errorf("JWE alg %q does not match %q", header.Alg, j.alg)
+	}
+	if header.Enc != A256GCM {
+		return nil, erero.Errorf("JWE enc %q is not supported", header.Enc)
+	}
+	if header.Zip != "" || len(header.Crit) > 0 {
+		return nil, erero.New("JWE zip and crit headers are not supported")
+	}
+	cek, err := j.unwrapKey(ctx, encryptedKey)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer clear(cek)
+	if len(cek) != 32 {
+		return nil, erero.New("JWE content key is not 32 bytes")
+	}
+	gcm, err := utils.NewAesGcm(cek)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+		return nil, erero.New("JWE iv or tag has wrong length")
+	}
+	plaintext, err := gcm.Open(nil, iv, append(append([]byte{}, ciphertext...), tag...), additionalData)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return plaintext, nil
+}
+
+// wrapKey wraps the content key locally with the RsaEncrypter, or through KMS Encrypt
+//
+// wrapKey 使用 RsaEncrypter 在本地包装内容密钥，或通过 KMS Encrypt 包装
+func (j *Jwe) wrapKey(ctx context.Context, cek []byte) ([]byte, error) {
+	if j.alg == AWSKMS {
+		return j.awsKms.EncryptContext(ctx, cek)
+	}
+	if j.rsaEncrypter != nil {
+		return j.rsaEncrypter.Encrypt(cek)
+	}
+	return j.awsKms.EncryptAsymmetricContext(ctx, cek, oaepAlgorithms[j.alg])
+}
+
+// unwrapKey unwraps the content key through KMS Decrypt
+//
+// unwrapKey 通过 KMS Decrypt 解包内容密钥
+func (j *Jwe) unwrapKey(ctx context.Context, encryptedKey []byte) ([]byte, error) {
+	if j.alg == AWSKMS {
+		return j.awsKms.DecryptContext(ctx, encryptedKey)
+	}
+	return j.awsKms.DecryptAsymmetricContext(ctx, encryptedKey, oaepAlgorithms[j.alg])
+}
+
+// decodeProtectedHeader decodes the base64url protected header
+//
+// decodeProtectedHeader 解码 base64url 受保护头部
+func decodeProtectedHeader(protected string) (*JweHeader, error) {
+	data, err := decodeSegment(protected)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var header JweHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &header, nil
+}
+
+// matchesKid reports whether a recipient kid names this Jwe
+//
+// matchesKid 判断接收方 kid 是否指向该 Jwe
+func (j *Jwe) matchesKid(kid string) bool {
+	return kid == "" || kid == j.kid || kid == j.awsKms.KeyID()
+}
+
+// mergeJweHeader fills the empty protected header members from the shared and per-recipient headers
+// RFC 7516 requires crit to be integrity protected, so crit outside the protected header is rejected
+//
+// mergeJweHeader 使用共享头部和接收方头部补全受保护头部中为空的成员
+// RFC 7516 要求 crit 必须受完整性保护，因此受保护头部之外的 crit 会被拒绝
+func mergeJweHeader(protected *JweHeader, headers ...*JweHeader) (*JweHeader, error) {
+	merged := *protected
+	for _, header := range headers {
+		if header == nil {
+			continue
+		}
+		if len(header.Crit) > 0 {
+			return nil, erero.New("JWE crit header must be in the protected header")
+		}
+		if merged.Alg == "" {
+			merged.Alg = header.Alg
+		}
+		if merged.Enc == "" {
+			merged.Enc = header.Enc
+		}
+		if merged.Kid == "" {
+			merged.Kid = header.Kid
+		}
+		if merged.Zip == "" {
+			merged.Zip = header.Zip
+		}
+	}
+	return &merged, nil
+}
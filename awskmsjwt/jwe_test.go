@@ -0,0 +1,213 @@
+package awskmsjwt_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmsjwt"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestJwe_Encrypt tests compact JWE round trips with each key management algorithm
+//
+// TestJwe_Encrypt 测试各密钥管理算法的紧凑格式 JWE 往返
+func TestJwe_Encrypt(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+
+	for alg, keySpec := range map[awskmsjwt.KeyAlgorithm]types.KeySpec{
+		awskmsjwt.RSAOAEP:    types.KeySpecRsa2048,
+		awskmsjwt.RSAOAEP256: types.KeySpecRsa3072,
+		awskmsjwt.AWSKMS:     types.KeySpecSymmetricDefault,
+	} {
+		t.Run(string(alg), func(t *testing.T) {
+			awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(keySpec, types.KeyUsageTypeEncryptDecrypt))
+			jwe, err := awskmsjwt.NewJwe(awsKms, alg)
+			require.NoError(t, err)
+
+			token, err := jwe.Encrypt([]byte(`{"card":"4111"}`))
+			require.NoError(t, err)
+			require.Len(t, strings.Split(token, "."), 5)
+
+			plaintext, err := jwe.Decrypt(token)
+			require.NoError(t, err)
+			require.Equal(t, `{"card":"4111"}`, string(plaintext))
+
+			parts := strings.Split(token, ".")
+			parts[3] = base64.RawURLEncoding.EncodeToString([]byte("tampered-ciphertext"))
+			_, err = jwe.Decrypt(strings.Join(parts, "."))
+			require.Error(t, err)
+		})
+	}
+
+	t.Run("Kid", func(t *testing.T) {
+		awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt))
+		jwe, err := awskmsjwt.NewJwe(awsKms, awskmsjwt.AWSKMS)
+		require.NoError(t, err)
+
+		token, err := jwe.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+		protected := string(mustDecode(t, strings.Split(token, ".")[0]))
+		require.NotContains(t, protected, awsKms.KeyID())
+		require.NotContains(t, protected, `"kid"`)
+
+		token, err = jwe.WithKeyIDKid().Encrypt([]byte("test message"))
+		require.NoError(t, err)
+		require.Contains(t, string(mustDecode(t, strings.Split(token, ".")[0])), awsKms.KeyID())
+
+		plaintext, err := jwe.WithKid("").Decrypt(token)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt))
+		_, err := awskmsjwt.NewJwe(awsKms, "dir")
+		require.Error(t, err)
+
+		jwe, err := awskmsjwt.NewJwe(awsKms, awskmsjwt.AWSKMS)
+		require.NoError(t, err)
+		token, err := jwe.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		rsaKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt))
+		rsaJwe, err := awskmsjwt.NewJwe(rsaKms, awskmsjwt.RSAOAEP256)
+		require.NoError(t, err)
+		_, err = rsaJwe.Decrypt(token)
+		require.Error(t, err)
+	})
+}
+
+// TestJwe_Partner tests JWEs built by a partner with the public key alone decrypt through KMS
+//
+// TestJwe_Partner 测试合作方仅使用公钥构建的 JWE 可以通过 KMS 解密
+func TestJwe_Partner(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt))
+	jwe, err := awskmsjwt.NewJwe(awsKms, awskmsjwt.RSAOAEP256)
+	require.NoError(t, err)
+
+	rsaEncrypter, err := awsKms.FetchRsaEncrypter(types.EncryptionAlgorithmSpecRsaesOaepSha256)
+	require.NoError(t, err)
+
+	t.Run("RsaEncrypter", func(t *testing.T) {
+		partner, err := awskmsjwt.NewJwe(awsKms, awskmsjwt.RSAOAEP256)
+		require.NoError(t, err)
+		token, err := partner.WithRsaEncrypter(rsaEncrypter).Encrypt([]byte("test message"))
+		require.NoError(t, err)
+
+		plaintext, err := jwe.Decrypt(token)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	})
+
+	t.Run("StandardLibrary", func(t *testing.T) {
+		protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RSA-OAEP-256","enc":"A256GCM"}`))
+		cek := make([]byte, 32)
+		_, err := rand.Read(cek)
+		require.NoError(t, err)
+		encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaEncrypter.PublicKey(), cek, nil)
+		require.NoError(t, err)
+
+		block, err := aes.NewCipher(cek)
+		require.NoError(t, err)
+		gcm, err := cipher.NewGCM(block)
+		require.NoError(t, err)
+		iv := make([]byte, 12)
+		_, err = rand.Read(iv)
+		require.NoError(t, err)
+		sealed := gcm.Seal(nil, iv, []byte("test message"), []byte(protected))
+
+		token := strings.Join([]string{
+			protected,
+			base64.RawURLEncoding.EncodeToString(encryptedKey),
+			base64.RawURLEncoding.EncodeToString(iv),
+			base64.RawURLEncoding.EncodeToString(sealed[:len(sealed)-16]),
+			base64.RawURLEncoding.EncodeToString(sealed[len(sealed)-16:]),
+		}, ".")
+		plaintext, err := jwe.Decrypt(token)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	})
+}
+
+// TestJwe_EncryptJSON tests the flattened and general JSON serializations with aad
+//
+// TestJwe_EncryptJSON 测试带 aad 的扁平和通用 JSON 序列化格式
+func TestJwe_EncryptJSON(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	awsKms := awskms.NewAwsKms(fake, fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt))
+	jwe, err := awskmsjwt.NewJwe(awsKms, awskmsjwt.AWSKMS)
+	require.NoError(t, err)
+
+	data, err := jwe.EncryptJSON([]byte("test message"), []byte("order-42"))
+	require.NoError(t, err)
+
+	plaintext, err := jwe.DecryptJSON(data)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	var message awskmsjwt.JweJSON
+	require.NoError(t, json.Unmarshal(data, &message))
+	require.NotEmpty(t, message.Aad)
+
+	t.Run("General", func(t *testing.T) {
+		general := message
+		general.Recipients = []*awskmsjwt.JweRecipient{
+			{Header: &awskmsjwt.JweHeader{Kid: "partner-key"}, EncryptedKey: general.EncryptedKey},
+			{EncryptedKey: general.EncryptedKey},
+		}
+		general.EncryptedKey = ""
+		generalData, err := json.Marshal(&general)
+		require.NoError(t, err)
+
+		plaintext, err := jwe.DecryptJSON(generalData)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	})
+
+	t.Run("UnprotectedCrit", func(t *testing.T) {
+		for _, place := range []string{"unprotected", "header"} {
+			unprotected := message
+			if place == "unprotected" {
+				unprotected.Unprotected = &awskmsjwt.JweHeader{Crit: []string{"exp"}}
+			} else {
+				unprotected.Header = &awskmsjwt.JweHeader{Crit: []string{"exp"}}
+			}
+			unprotectedData, err := json.Marshal(&unprotected)
+			require.NoError(t, err)
+
+			_, err = jwe.DecryptJSON(unprotectedData)
+			require.Error(t, err)
+		}
+	})
+
+	t.Run("UnprotectedZip", func(t *testing.T) {
+		unprotected := message
+		unprotected.Unprotected = &awskmsjwt.JweHeader{Zip: "DEF"}
+		unprotectedData, err := json.Marshal(&unprotected)
+		require.NoError(t, err)
+
+		_, err = jwe.DecryptJSON(unprotectedData)
+		require.Error(t, err)
+	})
+
+	t.Run("TamperedAad", func(t *testing.T) {
+		tampered := message
+		tampered.Aad = base64.RawURLEncoding.EncodeToString([]byte("order-43"))
+		tamperedData, err := json.Marshal(&tampered)
+		require.NoError(t, err)
+
+		_, err = jwe.DecryptJSON(tamperedData)
+		require.Error(t, err)
+	})
+}
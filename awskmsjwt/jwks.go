@@ -0,0 +1,152 @@
+package awskmsjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+
+	"github.com/yyle88/erero"
+)
+
+// JWK is one public key entry of a JWKS document, holding RSA or EC members
+//
+// JWK 是 JWKS 文档中的一个公钥条目，包含 RSA 或 EC 成员
+type JWK struct {
+	Kty string `json:"kty"`           // Key type, RSA or EC // 密钥类型，RSA 或 EC
+	Kid string `json:"kid,omitempty"` // Key ID matching the token kid header // 与令牌 kid 头部匹配的密钥 ID
+	Use string `json:"use,omitempty"` // Public key use, sig // 公钥用途，sig
+	Alg string `json:"alg,omitempty"` // JWS algorithm // JWS 算法
+	N   string `json:"n,omitempty"`   // RSA modulus // RSA 模数
+	E   string `json:"e,omitempty"`   // RSA public exponent // RSA 公开指数
+	Crv string `json:"crv,omitempty"` // EC curve name // EC 曲线名称
+	X   string `json:"x,omitempty"`   // EC x coordinate // EC x 坐标
+	Y   string `json:"y,omitempty"`   // EC y coordinate // EC y 坐标
+}
+
+// JWKS is a JSON Web Key Set document, as served at /.well-known/jwks.json
+//
+// JWKS 是 JSON Web Key Set 文档，通常在 /.well-known/jwks.json 提供
+type JWKS struct {
+	Keys []*JWK `json:"keys"` // Public keys // 公钥列表
+}
+
+// JWK builds the public JWK of the signer from the KMS public key
+// Returns exception with HS256 signers since the HMAC secret is not public
+//
+// JWK 根据 KMS 公钥构建签名器的公开 JWK
+// HS256 签名器返回异常，因为 HMAC 密钥不能公开
+func (s *Signer) JWK() (*JWK, error) {
+	return s.JWKContext(context.Background())
+}
+
+// JWKContext builds the public JWK of the signer with the given context
+//
+// JWKContext 使用给定的上下文构建签名器的公开 JWK
+func (s *Signer) JWKContext(ctx context.Context) (*JWK, error) {
+	jwk, err := s.publicJWK(ctx)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	kid, err := s.KidContext(ctx)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	jwk.Kid = kid
+	return jwk, nil
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the JWK as base64url
+// Only the required members of the key type take part, in lexicographic order
+//
+// Thumbprint 返回 JWK 的 RFC 7638 SHA-256 指纹，使用 base64url 编码
+// 只有该密钥类型的必需成员按字典序参与计算
+func (j *JWK) Thumbprint() (string, error) {
+	var members any
+	switch j.Kty {
+	case "RSA":
+		members = &struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{E: j.E, Kty: j.Kty, N: j.N}
+	case "EC":
+		members = &struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{Crv: j.Crv, Kty: j.Kty, X: j.X, Y: j.Y}
+	default:
+		return "", erero.Errorf("JWK key type %q is not supported", j.Kty)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	digest := sha256.Sum256(data)
+	return encodeSegment(digest[:]), nil
+}
+
+// publicJWK builds the public JWK of the signer without kid
+//
+// publicJWK 构建签名器的公开 JWK，不包含 kid
+func (s *Signer) publicJWK(ctx context.Context) (*JWK, error) {
+	if s.kmsSigner == nil {
+		return nil, erero.Errorf("JWT algorithm %q has no public key", s.alg)
+	}
+	publicKey, err := s.kmsSigner.PublicKeyContext(ctx)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	jwk := &JWK{
+		Use: "sig",
+		Alg: string(s.alg),
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeSegment(publicKey.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = publicKey.Curve.Params().Name
+		jwk.X = encodeSegment(publicKey.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeSegment(publicKey.Y.FillBytes(make([]byte, size)))
+	default:
+		return nil, erero.Errorf("public key type %T is not supported", publicKey)
+	}
+	return jwk, nil
+}
+
+// NewJWKS builds a JWKS document from the public keys of the signers
+// HS256 signers are skipped, so a mixed set of signers can be passed as is
+// Keep the previous signer in the list during key rotation so tokens it issued still verify
+//
+// NewJWKS 根据签名器的公钥构建 JWKS 文档
+// HS256 签名器会被跳过，因此可以直接传入混合的签名器集合
+// 密钥轮换期间将旧签名器保留在列表中，使其签发的令牌仍可校验
+func NewJWKS(signers ...*Signer) (*JWKS, error) {
+	return NewJWKSContext(context.Background(), signers...)
+}
+
+// NewJWKSContext builds a JWKS document from the public keys of the signers with the given context
+//
+// NewJWKSContext 使用给定的上下文根据签名器的公钥构建 JWKS 文档
+func NewJWKSContext(ctx context.Context, signers ...*Signer) (*JWKS, error) {
+	jwks := &JWKS{Keys: make([]*JWK, 0, len(signers))}
+	for _, signer := range signers {
+		if signer.kmsSigner == nil {
+			continue
+		}
+		jwk, err := signer.JWKContext(ctx)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks, nil
+}
@@ -0,0 +1,81 @@
+package awskmsjwt_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskmsjwt"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewJWKS tests the JWKS document lists the asymmetric keys and verifies RSA tokens offline
+//
+// TestNewJWKS 测试 JWKS 文档列出非对称密钥并可离线校验 RSA 令牌
+func TestNewJWKS(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	rsaSigner, err := awskmsjwt.NewSigner(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify), awskmsjwt.RS256)
+	require.NoError(t, err)
+	ecSigner, err := awskmsjwt.NewSigner(fake, fake.MustCreateKey(types.KeySpecEccNistP521, types.KeyUsageTypeSignVerify), awskmsjwt.ES512)
+	require.NoError(t, err)
+	hmacSigner, err := awskmsjwt.NewSigner(fake, fake.MustCreateKey(types.KeySpecHmac256, types.KeyUsageTypeGenerateVerifyMac), awskmsjwt.HS256)
+	require.NoError(t, err)
+
+	jwks, err := awskmsjwt.NewJWKS(rsaSigner, ecSigner, hmacSigner)
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 2)
+
+	rsaJwk := jwks.Keys[0]
+	require.Equal(t, "RSA", rsaJwk.Kty)
+	rsaKid, err := rsaSigner.Kid()
+	require.NoError(t, err)
+	require.Equal(t, rsaKid, rsaJwk.Kid)
+	thumbprint, err := rsaJwk.Thumbprint()
+	require.NoError(t, err)
+	require.Equal(t, thumbprint, rsaJwk.Kid)
+	require.NotContains(t, rsaJwk.Kid, "arn:")
+	require.Equal(t, "sig", rsaJwk.Use)
+	require.Equal(t, "AQAB", rsaJwk.E)
+
+	ecJwk := jwks.Keys[1]
+	require.Equal(t, "P-521", ecJwk.Crv)
+	require.Len(t, mustDecode(t, ecJwk.X), 66)
+	require.Len(t, mustDecode(t, ecJwk.Y), 66)
+
+	publicKey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(mustDecode(t, rsaJwk.N)),
+		E: int(new(big.Int).SetBytes(mustDecode(t, rsaJwk.E)).Int64()),
+	}
+	token, err := rsaSigner.Sign(&testClaims{Sub: "user-1"})
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], mustDecode(t, parts[2])))
+
+	_, err = hmacSigner.JWK()
+	require.Error(t, err)
+}
+
+// TestJWK_Thumbprint tests the thumbprint against the RFC 7638 example key
+//
+// TestJWK_Thumbprint 使用 RFC 7638 示例密钥测试指纹
+func TestJWK_Thumbprint(t *testing.T) {
+	jwk := &awskmsjwt.JWK{
+		Kty: "RSA",
+		Kid: "2011-04-29",
+		Alg: "RS256",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	thumbprint, err := jwk.Thumbprint()
+	require.NoError(t, err)
+	require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+
+	_, err = (&awskmsjwt.JWK{Kty: "OKP"}).Thumbprint()
+	require.Error(t, err)
+}
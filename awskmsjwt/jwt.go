@@ -0,0 +1,425 @@
+// Package awskmsjwt: JWT signing, verification and JWE encryption with AWS KMS keys
+// Issues RS256/RS384/RS512, PS256/PS384/PS512, ES256/ES384/ES512 tokens via KMS Sign, and HS256 via KMS HMAC
+// Converts ECDSA DER signatures from KMS into the raw R||S encoding that JOSE requires
+// Generates JWKS documents from the KMS public keys so relying parties can verify offline
+// Encrypts JWE messages with A256GCM content keys wrapped by KMS
+//
+// awskmsjwt: 使用 AWS KMS 密钥签发和校验 JWT，以及加密 JWE
+// 通过 KMS Sign 签发 RS256/RS384/RS512、PS256/PS384/PS512、ES256/ES384/ES512 令牌，通过 KMS HMAC 签发 HS256
+// 将 KMS 返回的 ECDSA DER 签名转换为 JOSE 要求的原始 R||S 编码
+// 根据 KMS 公钥生成 JWKS 文档，依赖方可以离线校验
+// 使用由 KMS 包装的 A256GCM 内容密钥加密 JWE 消息
+package awskmsjwt
+
+import (
+	"context"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// Algorithm is the JWS "alg" header value
+//
+// Algorithm 是 JWS 的 "alg" 头部值
+type Algorithm string
+
+const (
+	RS256 Algorithm = "RS256" // RSASSA-PKCS1-v1_5 with SHA-256 // 使用 SHA-256 的 RSASSA-PKCS1-v1_5
+	RS384 Algorithm = "RS384" // RSASSA-PKCS1-v1_5 with SHA-384 // 使用 SHA-384 的 RSASSA-PKCS1-v1_5
+	RS512 Algorithm = "RS512" // RSASSA-PKCS1-v1_5 with SHA-512 // 使用 SHA-512 的 RSASSA-PKCS1-v1_5
+	PS256 Algorithm = "PS256" // RSASSA-PSS with SHA-256 // 使用 SHA-256 的 RSASSA-PSS
+	PS384 Algorithm = "PS384" // RSASSA-PSS with SHA-384 // 使用 SHA-384 的 RSASSA-PSS
+	PS512 Algorithm = "PS512" // RSASSA-PSS with SHA-512 // 使用 SHA-512 的 RSASSA-PSS
+	ES256 Algorithm = "ES256" // ECDSA P-256 with SHA-256 // 使用 SHA-256 的 ECDSA P-256
+	ES384 Algorithm = "ES384" // ECDSA P-384 with SHA-384 // 使用 SHA-384 的 ECDSA P-384
+	ES512 Algorithm = "ES512" // ECDSA P-521 with SHA-512 // 使用 SHA-512 的 ECDSA P-521
+	HS256 Algorithm = "HS256" // HMAC with SHA-256 via KMS GenerateMac // 通过 KMS GenerateMac 使用 SHA-256 的 HMAC
+)
+
+// signingAlgorithms maps JWS algorithms to KMS signing algorithms
+//
+// signingAlgorithms 将 JWS 算法映射为 KMS 签名算法
+var signingAlgorithms = map[Algorithm]types.SigningAlgorithmSpec{
+	RS256: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+	RS384: types.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+	RS512: types.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+	PS256: types.SigningAlgorithmSpecRsassaPssSha256,
+	PS384: types.SigningAlgorithmSpecRsassaPssSha384,
+	PS512: types.SigningAlgorithmSpecRsassaPssSha512,
+	ES256: types.SigningAlgorithmSpecEcdsaSha256,
+	ES384: types.SigningAlgorithmSpecEcdsaSha384,
+	ES512: types.SigningAlgorithmSpecEcdsaSha512,
+}
+
+// ecdsaSizes gives the R and S byte length of each ECDSA algorithm in JOSE encoding
+//
+// ecdsaSizes 给出各 ECDSA 算法在 JOSE 编码中 R 和 S 的字节长度
+var ecdsaSizes = map[Algorithm]int{
+	ES256: 32,
+	ES384: 48,
+	ES512: 66,
+}
+
+// Header is the JOSE header of the tokens
+//
+// Header 是令牌的 JOSE 头部
+type Header struct {
+	Alg Algorithm `json:"alg"`           // Signing algorithm // 签名算法
+	Typ string    `json:"typ,omitempty"` // Token type, JWT // 令牌类型，JWT
+	Kid string    `json:"kid,omitempty"` // Key ID matching the JWKS entry // 与 JWKS 条目匹配的密钥 ID
+}
+
+// SignerAPI defines the KMS operations used by Signer, covering both asymmetric and HMAC algorithms
+//
+// SignerAPI 定义 Signer 使用的 KMS 操作，涵盖非对称算法和 HMAC 算法
+type SignerAPI interface {
+	awskms.SignerAPI
+	awskms.MacAPI
+}
+
+var _ SignerAPI = (*kms.Client)(nil)
+
+// Signer issues and verifies JWTs with one KMS key
+// The private key or HMAC secret never leaves KMS
+// Safe in concurrent use across goroutines
+//
+// Signer 使用一个 KMS 密钥签发和校验 JWT
+// 私钥或 HMAC 密钥不会离开 KMS
+// 可在多个 goroutine 中并发使用
+type Signer struct {
+	alg        Algorithm            // JWS algorithm // JWS 算法
+	keyID      string               // KMS key ID or ARN // KMS 密钥 ID 或 ARN
+	kid        string               // Key ID set with WithKid, empty means the JWK thumbprint // 通过 WithKid 设置的密钥 ID，为空时使用 JWK 指纹
+	kmsSigner  *awskms.AwsKmsSigner // Asymmetric signer, nil with HS256 // 非对称签名器，HS256 时为 nil
+	kmsMac     *awskms.AwsKmsMac    // HMAC component, nil unless HS256 // HMAC 组件，仅 HS256 时非 nil
+	timeNowFun func() time.Time     // Clock used to check exp and nbf // 用于检查 exp 和 nbf 的时钟
+}
+
+// NewSigner creates a JWT Signer on a KMS key with the given algorithm
+// Uses a SIGN_VERIFY key on RS, PS and ES algorithms and a GENERATE_VERIFY_MAC HMAC_256 key on HS256
+// The kid header defaults to the RFC 7638 JWK thumbprint, so tokens and JWKS do not reveal the KMS key ARN
+// HS256 has no public key and writes no kid by default, use WithKid or WithKeyIDKid to set one
+//
+// NewSigner 使用给定算法基于 KMS 密钥创建 JWT Signer
+// RS、PS 和 ES 算法使用 SIGN_VERIFY 密钥，HS256 使用 GENERATE_VERIFY_MAC 的 HMAC_256 密钥
+// kid 头部默认为 RFC 7638 JWK 指纹，令牌和 JWKS 不会暴露 KMS 密钥 ARN
+// HS256 没有公钥，默认不写入 kid，可以通过 WithKid 或 WithKeyIDKid 设置
+func NewSigner(client SignerAPI, keyID string, alg Algorithm) (*Signer, error) {
+	signer := &Signer{
+		alg:        alg,
+		keyID:      must.Nice(keyID),
+		timeNowFun: time.Now,
+	}
+	if alg == HS256 {
+		signer.kmsMac = awskms.NewAwsKmsMac(client, keyID, types.MacAlgorithmSpecHmacSha256)
+		return signer, nil
+	}
+	signingAlgorithm, ok := signingAlgorithms[alg]
+	if !ok {
+		return nil, erero.Errorf("JWT algorithm %q is not supported", alg)
+	}
+	signer.kmsSigner = awskms.NewAwsKmsSigner(client, keyID, signingAlgorithm)
+	return signer, nil
+}
+
+// WithKid sets the kid header written to tokens and matched on verification
+// Returns self in method chaining
+//
+// WithKid 设置写入令牌并在校验时匹配的 kid 头部
+// 返回自身以支持链式调用
+func (s *Signer) WithKid(kid string) *Signer {
+	s.kid = kid
+	return s
+}
+
+// WithKeyIDKid uses the KMS key ID given to NewSigner as the kid header
+// Opt-in only, a key ARN reveals the AWS account, region and key ID to every token holder
+// Returns self in method chaining
+//
+// WithKeyIDKid 使用传给 NewSigner 的 KMS 密钥 ID 作为 kid 头部
+// 需要主动启用，密钥 ARN 会向每个令牌持有者暴露 AWS 账号、区域和密钥 ID
+// 返回自身以支持链式调用
+func (s *Signer) WithKeyIDKid() *Signer {
+	s.kid = s.keyID
+	return s
+}
+
+// WithTimeNow sets the clock used to check exp and nbf claims, mainly in tests
+// Returns self in method chaining
+//
+// WithTimeNow 设置用于检查 exp 和 nbf 声明的时钟，主要用于测试
+// 返回自身以支持链式调用
+func (s *Signer) WithTimeNow(timeNowFun func() time.Time) *Signer {
+	must.True(timeNowFun != nil)
+	s.timeNowFun = timeNowFun
+	return s
+}
+
+// Alg returns the JWS algorithm
+//
+// Alg 返回 JWS 算法
+func (s *Signer) Alg() Algorithm {
+	return s.alg
+}
+
+// Kid returns the kid header value, the JWK thumbprint unless set with WithKid or WithKeyIDKid
+//
+// Kid 返回 kid 头部值，未通过 WithKid 或 WithKeyIDKid 设置时为 JWK 指纹
+func (s *Signer) Kid() (string, error) {
+	return s.KidContext(context.Background())
+}
+
+// KidContext returns the kid header value with the given context
+// The thumbprint needs the public key, fetched once through KMS GetPublicKey then cached
+//
+// KidContext 使用给定的上下文返回 kid 头部值
+// 指纹需要公钥，首次通过 KMS GetPublicKey 获取后缓存
+func (s *Signer) KidContext(ctx context.Context) (string, error) {
+	if s.kid != "" || s.kmsSigner == nil {
+		return s.kid, nil
+	}
+	jwk, err := s.publicJWK(ctx)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return thumbprint, nil
+}
+
+// Sign issues a compact JWT with the claims marshaled as JSON payload
+//
+// Sign 签发紧凑格式的 JWT，claims 序列化为 JSON 载荷
+func (s *Signer) Sign(claims any) (string, error) {
+	return s.SignContext(context.Background(), claims)
+}
+
+// SignContext issues a compact JWT with the given context
+// HS256 tokens are limited to 4 KB of signing input by KMS GenerateMac
+//
+// SignContext 使用给定的上下文签发紧凑格式的 JWT
+// HS256 令牌的签名输入受 KMS GenerateMac 限制为 4 KB
+func (s *Signer) SignContext(ctx context.Context, claims any) (string, error) {
+	kid, err := s.KidContext(ctx)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	header, err := json.Marshal(&Header{Alg: s.alg, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+
+	signature, err := s.sign(ctx, []byte(signingInput))
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Verify checks the token signature, alg, kid, exp and nbf, then unmarshals the payload into claims
+// Pass nil claims when only the check is needed
+//
+// Verify 检查令牌签名、alg、kid、exp 和 nbf，然后将载荷反序列化到 claims
+// 只需要检查时 claims 传 nil
+func (s *Signer) Verify(token string, claims any) error {
+	return s.VerifyContext(context.Background(), token, claims)
+}
+
+// VerifyContext checks the token with the given context
+// Asymmetric tokens are verified locally with the public key cached after the first GetPublicKey call
+//
+// VerifyContext 使用给定的上下文检查令牌
+// 非对称令牌使用首次 GetPublicKey 调用后缓存的公钥在本地校验
+func (s *Signer) VerifyContext(ctx context.Context, token string, claims any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return erero.New("token is not a compact JWS with three parts")
+	}
+	headerData, err := decodeSegment(parts[0])
+	if err != nil {
+		return erero.Wro(err)
+	}
+	var header Header
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return erero.Wro(err)
+	}
+	if header.Alg != s.alg {
+		return erero.Errorf("token alg %q does not match %q", header.Alg, s.alg)
+	}
+	if header.Kid != "" {
+		kid, err := s.KidContext(ctx)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		if header.Kid != kid {
+			return erero.Errorf("token kid %q does not match %q", header.Kid, kid)
+		}
+	}
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return erero.Wro(err)
+	}
+	valid, err := s.verify(ctx, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	if !valid {
+		return erero.New("token signature is not valid")
+	}
+
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return erero.Wro(err)
+	}
+	if err := s.checkTimes(payload); err != nil {
+		return erero.Wro(err)
+	}
+	if claims != nil {
+		if err := json.Unmarshal(payload, claims); err != nil {
+			return erero.Wro(err)
+		}
+	}
+	return nil
+}
+
+// sign produces the JWS signature bytes, converting ECDSA DER into R||S
+//
+// sign 生成 JWS 签名字节，将 ECDSA DER 转换为 R||S
+func (s *Signer) sign(ctx context.Context, signingInput []byte) ([]byte, error) {
+	if s.kmsMac != nil {
+		return s.kmsMac.GenerateMacContext(ctx, signingInput)
+	}
+	signature, err := s.kmsSigner.SignMessageContext(ctx, signingInput)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if size, ok := ecdsaSizes[s.alg]; ok {
+		return derToRaw(signature, size)
+	}
+	return signature, nil
+}
+
+// verify checks the JWS signature bytes, converting ECDSA R||S back into DER
+//
+// verify 校验 JWS 签名字节，将 ECDSA R||S 转换回 DER
+func (s *Signer) verify(ctx context.Context, signingInput []byte, signature []byte) (bool, error) {
+	if s.kmsMac != nil {
+		return s.kmsMac.VerifyMacContext(ctx, signingInput, signature)
+	}
+	if size, ok := ecdsaSizes[s.alg]; ok {
+		if len(signature) != 2*size {
+			return false, nil
+		}
+		der, err := rawToDer(signature)
+		if err != nil {
+			return false, erero.Wro(err)
+		}
+		signature = der
+	}
+	return s.kmsSigner.VerifyMessageLocalContext(ctx, signingInput, signature)
+}
+
+// checkTimes rejects expired and not yet valid tokens using the numeric exp and nbf claims
+//
+// checkTimes 使用数值型 exp 和 nbf 声明拒绝已过期和尚未生效的令牌
+func (s *Signer) checkTimes(payload []byte) error {
+	var times struct {
+		Exp *json.Number `json:"exp"`
+		Nbf *json.Number `json:"nbf"`
+	}
+	if err := json.Unmarshal(payload, &times); err != nil {
+		return erero.Wro(err)
+	}
+	now := s.timeNowFun()
+	if times.Exp != nil {
+		exp, err := times.Exp.Float64()
+		if err != nil {
+			return erero.Wro(err)
+		}
+		if !now.Before(time.Unix(int64(exp), 0)) {
+			return erero.New("token is expired")
+		}
+	}
+	if times.Nbf != nil {
+		nbf, err := times.Nbf.Float64()
+		if err != nil {
+			return erero.Wro(err)
+		}
+		if now.Before(time.Unix(int64(nbf), 0)) {
+			return erero.New("token is not valid yet")
+		}
+	}
+	return nil
+}
+
+// ecdsaSignature is the ASN.1 structure of DER encoded ECDSA signatures
+//
+// ecdsaSignature 是 DER 编码 ECDSA 签名的 ASN.1 结构
+type ecdsaSignature struct {
+	R *big.Int
+	S *big.Int
+}
+
+// derToRaw converts a DER ECDSA signature into fixed-size R||S
+//
+// derToRaw 将 DER 格式的 ECDSA 签名转换为定长的 R||S
+func derToRaw(der []byte, size int) ([]byte, error) {
+	var signature ecdsaSignature
+	rest, err := asn1.Unmarshal(der, &signature)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if len(rest) != 0 || signature.R.Sign() <= 0 || signature.S.Sign() <= 0 {
+		return nil, erero.New("ECDSA signature is malformed")
+	}
+	if signature.R.BitLen() > 8*size || signature.S.BitLen() > 8*size {
+		return nil, erero.New("ECDSA signature is too long for the curve")
+	}
+	raw := make([]byte, 2*size)
+	signature.R.FillBytes(raw[:size])
+	signature.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// rawToDer converts a fixed-size R||S ECDSA signature into DER
+//
+// rawToDer 将定长 R||S 格式的 ECDSA 签名转换为 DER
+func rawToDer(raw []byte) ([]byte, error) {
+	size := len(raw) / 2
+	der, err := asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(raw[:size]),
+		S: new(big.Int).SetBytes(raw[size:]),
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return der, nil
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return data, nil
+}
@@ -0,0 +1,179 @@
+package awskmsjwt_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskmsjwt"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+type testClaims struct {
+	Sub string `json:"sub"`
+	Exp int64  `json:"exp,omitempty"`
+	Nbf int64  `json:"nbf,omitempty"`
+}
+
+// TestSigner_Sign tests token round trips across every supported algorithm
+//
+// TestSigner_Sign 测试所有支持算法的令牌往返
+func TestSigner_Sign(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+
+	for _, tc := range []struct {
+		alg       awskmsjwt.Algorithm
+		keySpec   types.KeySpec
+		keyUsage  types.KeyUsageType
+		signature int
+	}{
+		{awskmsjwt.RS256, types.KeySpecRsa2048, types.KeyUsageTypeSignVerify, 256},
+		{awskmsjwt.RS384, types.KeySpecRsa3072, types.KeyUsageTypeSignVerify, 384},
+		{awskmsjwt.RS512, types.KeySpecRsa4096, types.KeyUsageTypeSignVerify, 512},
+		{awskmsjwt.PS256, types.KeySpecRsa2048, types.KeyUsageTypeSignVerify, 256},
+		{awskmsjwt.PS384, types.KeySpecRsa2048, types.KeyUsageTypeSignVerify, 256},
+		{awskmsjwt.PS512, types.KeySpecRsa2048, types.KeyUsageTypeSignVerify, 256},
+		{awskmsjwt.ES256, types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify, 64},
+		{awskmsjwt.ES384, types.KeySpecEccNistP384, types.KeyUsageTypeSignVerify, 96},
+		{awskmsjwt.ES512, types.KeySpecEccNistP521, types.KeyUsageTypeSignVerify, 132},
+		{awskmsjwt.HS256, types.KeySpecHmac256, types.KeyUsageTypeGenerateVerifyMac, 32},
+	} {
+		t.Run(string(tc.alg), func(t *testing.T) {
+			keyID := fake.MustCreateKey(tc.keySpec, tc.keyUsage)
+			signer, err := awskmsjwt.NewSigner(fake, keyID, tc.alg)
+			require.NoError(t, err)
+
+			token, err := signer.Sign(&testClaims{Sub: "user-1"})
+			require.NoError(t, err)
+
+			parts := strings.Split(token, ".")
+			require.Len(t, parts, 3)
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			require.NoError(t, err)
+			require.Len(t, signature, tc.signature)
+
+			var claims testClaims
+			require.NoError(t, signer.Verify(token, &claims))
+			require.Equal(t, "user-1", claims.Sub)
+
+			tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2]
+			require.Error(t, signer.Verify(tampered, nil))
+		})
+	}
+}
+
+// TestSigner_ES256 tests ES256 signatures are raw R||S and verify with the standard library
+//
+// TestSigner_ES256 测试 ES256 签名为原始 R||S 并可使用标准库校验
+func TestSigner_ES256(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	signer, err := awskmsjwt.NewSigner(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify), awskmsjwt.ES256)
+	require.NoError(t, err)
+
+	token, err := signer.Sign(&testClaims{Sub: "user-1"})
+	require.NoError(t, err)
+
+	jwk, err := signer.JWK()
+	require.NoError(t, err)
+	require.Equal(t, "EC", jwk.Kty)
+	require.Equal(t, "P-256", jwk.Crv)
+	require.Equal(t, "ES256", jwk.Alg)
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(mustDecode(t, jwk.X)),
+		Y:     new(big.Int).SetBytes(mustDecode(t, jwk.Y)),
+	}
+
+	parts := strings.Split(token, ".")
+	signature := mustDecode(t, parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	require.True(t, ecdsa.Verify(publicKey, digest[:], r, s))
+}
+
+// TestSigner_Verify tests header checks and exp and nbf handling
+//
+// TestSigner_Verify 测试头部检查以及 exp 和 nbf 处理
+func TestSigner_Verify(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify)
+	now := time.Unix(1700000000, 0)
+	signer, err := awskmsjwt.NewSigner(fake, keyID, awskmsjwt.RS256)
+	require.NoError(t, err)
+	signer.WithKid("key-2024").WithTimeNow(func() time.Time { return now })
+	kid, err := signer.Kid()
+	require.NoError(t, err)
+	require.Equal(t, "key-2024", kid)
+
+	t.Run("DefaultKid", func(t *testing.T) {
+		thumbprintSigner, err := awskmsjwt.NewSigner(fake, keyID, awskmsjwt.RS256)
+		require.NoError(t, err)
+		kid, err := thumbprintSigner.Kid()
+		require.NoError(t, err)
+		require.NotEmpty(t, kid)
+		require.NotContains(t, kid, keyID)
+
+		token, err := thumbprintSigner.Sign(&testClaims{Sub: "user-1"})
+		require.NoError(t, err)
+		require.NotContains(t, string(mustDecode(t, strings.Split(token, ".")[0])), keyID)
+		require.NoError(t, thumbprintSigner.Verify(token, nil))
+
+		kid, err = thumbprintSigner.WithKeyIDKid().Kid()
+		require.NoError(t, err)
+		require.Equal(t, keyID, kid)
+
+		hmacSigner, err := awskmsjwt.NewSigner(fake, fake.MustCreateKey(types.KeySpecHmac256, types.KeyUsageTypeGenerateVerifyMac), awskmsjwt.HS256)
+		require.NoError(t, err)
+		kid, err = hmacSigner.Kid()
+		require.NoError(t, err)
+		require.Empty(t, kid)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		token, err := signer.Sign(&testClaims{Sub: "user-1", Exp: now.Add(time.Minute).Unix()})
+		require.NoError(t, err)
+		require.NoError(t, signer.Verify(token, nil))
+
+		token, err = signer.Sign(&testClaims{Sub: "user-1", Exp: now.Unix()})
+		require.NoError(t, err)
+		require.Error(t, signer.Verify(token, nil))
+
+		token, err = signer.Sign(&testClaims{Sub: "user-1", Nbf: now.Add(time.Minute).Unix()})
+		require.NoError(t, err)
+		require.Error(t, signer.Verify(token, nil))
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		token, err := signer.Sign(&testClaims{Sub: "user-1"})
+		require.NoError(t, err)
+
+		other, err := awskmsjwt.NewSigner(fake, keyID, awskmsjwt.PS256)
+		require.NoError(t, err)
+		require.Error(t, other.WithKid("key-2024").Verify(token, nil))
+
+		other, err = awskmsjwt.NewSigner(fake, keyID, awskmsjwt.RS256)
+		require.NoError(t, err)
+		require.Error(t, other.Verify(token, nil))
+
+		require.Error(t, signer.Verify("a.b", nil))
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := awskmsjwt.NewSigner(fake, keyID, "none")
+		require.Error(t, err)
+	})
+}
+
+func mustDecode(t *testing.T, segment string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,130 @@
+// Package awskmsssh: SSH signing with AWS KMS SIGN_VERIFY keys
+// Adapts KMS RSA, ECDSA and Ed25519 keys to golang.org/x/crypto/ssh.Signer, the private key never leaves KMS
+// Usable as SSH client auth, host key or certificate authority, and prints the authorized_keys line
+//
+// awskmsssh: 使用 AWS KMS SIGN_VERIFY 密钥进行 SSH 签名
+// 将 KMS 的 RSA、ECDSA 和 Ed25519 密钥适配为 golang.org/x/crypto/ssh.Signer，私钥不会离开 KMS
+// 可用于 SSH 客户端认证、主机密钥或证书颁发机构，并可输出 authorized_keys 行
+package awskmsssh
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/yyle88/erero"
+	"golang.org/x/crypto/ssh"
+)
+
+var _ ssh.MultiAlgorithmSigner = (*Signer)(nil)
+
+// Signer implements ssh.Signer and ssh.AlgorithmSigner with a KMS SIGN_VERIFY key
+// KMS has no SHA-1 signing, so RSA keys sign with rsa-sha2-512 or rsa-sha2-256 and never with ssh-rsa
+//
+// Signer 使用 KMS SIGN_VERIFY 密钥实现 ssh.Signer 和 ssh.AlgorithmSigner
+// KMS 不支持 SHA-1 签名，因此 RSA 密钥使用 rsa-sha2-512 或 rsa-sha2-256 签名，从不使用 ssh-rsa
+type Signer struct {
+	cryptoSigner *awskms.AwsKmsCryptoSigner // KMS key as crypto.Signer // 作为 crypto.Signer 的 KMS 密钥
+	sshSigner    ssh.AlgorithmSigner        // SSH wire format adapter // SSH 线路格式适配器
+	algorithms   []string                   // Signature algorithms in order of preference // 按优先顺序排列的签名算法
+}
+
+// NewSigner creates Signer, fetching the public key via GetPublicKey
+// Accepts any awskms.SignerAPI client, e.g. *kms.Client
+//
+// NewSigner 创建 Signer，并通过 GetPublicKey 获取公钥
+// 接受任意 awskms.SignerAPI 客户端，例如 *kms.Client
+func NewSigner(client awskms.SignerAPI, signKeyID string) (*Signer, error) {
+	return NewSignerContext(context.Background(), client, signKeyID)
+}
+
+// NewSignerContext creates Signer, fetching the public key with the given context
+//
+// NewSignerContext 创建 Signer，使用给定的上下文获取公钥
+func NewSignerContext(ctx context.Context, client awskms.SignerAPI, signKeyID string) (*Signer, error) {
+	cryptoSigner, err := awskms.NewAwsKmsCryptoSignerContext(ctx, client, signKeyID)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	signer, err := ssh.NewSignerFromSigner(cryptoSigner)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	sshSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, erero.Errorf("ssh signer %T does not support signature algorithms", signer)
+	}
+	algorithms := []string{signer.PublicKey().Type()}
+	if signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		algorithms = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256}
+	}
+	return &Signer{
+		cryptoSigner: cryptoSigner,
+		sshSigner:    sshSigner,
+		algorithms:   algorithms,
+	}, nil
+}
+
+// KeyID returns the KMS key ARN
+//
+// KeyID 返回 KMS 密钥 ARN
+func (s *Signer) KeyID() string {
+	return s.cryptoSigner.KeyID()
+}
+
+// PublicKey returns the SSH public key, implementing ssh.Signer
+//
+// PublicKey 返回 SSH 公钥，实现 ssh.Signer
+func (s *Signer) PublicKey() ssh.PublicKey {
+	return s.sshSigner.PublicKey()
+}
+
+// Sign signs the data with the first algorithm of Algorithms, implementing ssh.Signer
+// The rand argument is ignored since randomness comes from KMS
+//
+// Sign 使用 Algorithms 中的第一个算法对数据签名，实现 ssh.Signer
+// rand 参数被忽略，随机性由 KMS 提供
+func (s *Signer) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, s.algorithms[0])
+}
+
+// SignWithAlgorithm signs the data with the given algorithm, implementing ssh.AlgorithmSigner
+// An empty algorithm selects the default, as ssh.AlgorithmSigner defines
+//
+// SignWithAlgorithm 使用给定的算法对数据签名，实现 ssh.AlgorithmSigner
+// 算法为空时按 ssh.AlgorithmSigner 的定义选择默认算法
+func (s *Signer) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	if algorithm == "" {
+		algorithm = s.algorithms[0]
+	}
+	if !slices.Contains(s.algorithms, algorithm) {
+		return nil, erero.Errorf("signature algorithm %s is not supported, supported: %v", algorithm, s.algorithms)
+	}
+	signature, err := s.sshSigner.SignWithAlgorithm(rand, data, algorithm)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return signature, nil
+}
+
+// Algorithms returns the signature algorithms the key supports, implementing ssh.MultiAlgorithmSigner
+//
+// Algorithms 返回密钥支持的签名算法，实现 ssh.MultiAlgorithmSigner
+func (s *Signer) Algorithms() []string {
+	return slices.Clone(s.algorithms)
+}
+
+// AuthorizedKey returns the authorized_keys line of the public key, without the trailing newline
+// The comment is appended when not empty, e.g. the key alias or the owner
+//
+// AuthorizedKey 返回公钥的 authorized_keys 行，不含末尾换行
+// 注释不为空时追加在末尾，例如密钥别名或所有者
+func (s *Signer) AuthorizedKey(comment string) string {
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(s.PublicKey())), "\n")
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
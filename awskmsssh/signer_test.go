@@ -0,0 +1,120 @@
+package awskmsssh_test
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmsssh"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// TestSigner_Sign tests SSH signatures of RSA, ECDSA and Ed25519 keys verify with the SSH public key
+//
+// TestSigner_Sign 测试 RSA、ECDSA 和 Ed25519 密钥的 SSH 签名可用 SSH 公钥校验
+func TestSigner_Sign(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	testCases := []struct {
+		keySpec    types.KeySpec
+		keyType    string
+		algorithms []string
+	}{
+		{types.KeySpecRsa2048, ssh.KeyAlgoRSA, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256}},
+		{types.KeySpecEccNistP256, ssh.KeyAlgoECDSA256, []string{ssh.KeyAlgoECDSA256}},
+		{types.KeySpecEccNistP384, ssh.KeyAlgoECDSA384, []string{ssh.KeyAlgoECDSA384}},
+		{types.KeySpecEccNistP521, ssh.KeyAlgoECDSA521, []string{ssh.KeyAlgoECDSA521}},
+		{awskms.KeySpecEccNistEdwards25519, ssh.KeyAlgoED25519, []string{ssh.KeyAlgoED25519}},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.keySpec), func(t *testing.T) {
+			signer, err := awskmsssh.NewSigner(fake, fake.MustCreateKey(tc.keySpec, types.KeyUsageTypeSignVerify))
+			require.NoError(t, err)
+			require.Equal(t, tc.keyType, signer.PublicKey().Type())
+			require.Equal(t, tc.algorithms, signer.Algorithms())
+
+			data := []byte("ssh session data")
+			signature, err := signer.Sign(rand.Reader, data)
+			require.NoError(t, err)
+			require.Equal(t, tc.algorithms[0], signature.Format)
+			require.NoError(t, signer.PublicKey().Verify(data, signature))
+			require.Error(t, signer.PublicKey().Verify([]byte("other data"), signature))
+
+			for _, algorithm := range tc.algorithms {
+				signature, err := signer.SignWithAlgorithm(rand.Reader, data, algorithm)
+				require.NoError(t, err)
+				require.Equal(t, algorithm, signature.Format)
+				require.NoError(t, signer.PublicKey().Verify(data, signature))
+			}
+		})
+	}
+
+	t.Run("RejectSshRsa", func(t *testing.T) {
+		signer, err := awskmsssh.NewSigner(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify))
+		require.NoError(t, err)
+		_, err = signer.SignWithAlgorithm(rand.Reader, []byte("data"), ssh.KeyAlgoRSA)
+		require.Error(t, err)
+	})
+
+	t.Run("WrongKeyUsage", func(t *testing.T) {
+		_, err := awskmsssh.NewSigner(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt))
+		require.Error(t, err)
+	})
+}
+
+// TestSigner_SignCert tests the KMS key acting as SSH certificate authority
+//
+// TestSigner_SignCert 测试 KMS 密钥作为 SSH 证书颁发机构
+func TestSigner_SignCert(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	authority, err := awskmsssh.NewSigner(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify))
+	require.NoError(t, err)
+	user, err := awskmsssh.NewSigner(fake, fake.MustCreateKey(awskms.KeySpecEccNistEdwards25519, types.KeyUsageTypeSignVerify))
+	require.NoError(t, err)
+
+	now := time.Now()
+	certificate := &ssh.Certificate{
+		Key:             user.PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           "alice",
+		ValidPrincipals: []string{"alice"},
+		ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+	}
+	require.NoError(t, certificate.SignCert(rand.Reader, authority))
+	require.Equal(t, ssh.KeyAlgoRSASHA512, certificate.Signature.Format)
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(authority.PublicKey().Marshal())
+		},
+	}
+	require.NoError(t, checker.CheckCert("alice", certificate))
+	require.Error(t, checker.CheckCert("bob", certificate))
+}
+
+// TestSigner_AuthorizedKey tests the authorized_keys line parses back to the same public key
+//
+// TestSigner_AuthorizedKey 测试 authorized_keys 行可解析回相同的公钥
+func TestSigner_AuthorizedKey(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	signer, err := awskmsssh.NewSigner(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify))
+	require.NoError(t, err)
+	require.Contains(t, signer.KeyID(), "arn:aws:kms:")
+
+	line := signer.AuthorizedKey("deploy@kms")
+	require.True(t, strings.HasPrefix(line, ssh.KeyAlgoECDSA256+" "))
+	require.True(t, strings.HasSuffix(line, " deploy@kms"))
+	require.NotContains(t, line, "\n")
+
+	publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	require.NoError(t, err)
+	require.Equal(t, "deploy@kms", comment)
+	require.Equal(t, signer.PublicKey().Marshal(), publicKey.Marshal())
+
+	require.Equal(t, strings.TrimSuffix(line, " deploy@kms"), signer.AuthorizedKey(""))
+}
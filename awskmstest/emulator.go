@@ -0,0 +1,216 @@
+package awskmstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+	"github.com/yyle88/must"
+)
+
+const (
+	targetPrefix = "TrentService."              // X-Amz-Target prefix of KMS operations // KMS 操作的 X-Amz-Target 前缀
+	contentType  = "application/x-amz-json-1.1" // AWS JSON 1.1 content type // AWS JSON 1.1 内容类型
+)
+
+// operation decodes one JSON request body, calls FakeKms and returns the output to encode
+//
+// operation 解码单个 JSON 请求体，调用 FakeKms 并返回待编码的输出
+type operation func(ctx context.Context, body []byte) (any, error)
+
+// Emulator is an http.Handler speaking the AWS KMS JSON 1.1 wire protocol on top of FakeKms
+// A real kms.Client pointed at the emulator endpoint works unchanged, including signing and retries
+// Requests must carry a SigV4 Authorization header, but the signature itself is not verified
+//
+// Emulator 是基于 FakeKms 实现 AWS KMS JSON 1.1 协议的 http.Handler
+// 指向该模拟器地址的真实 kms.Client 无需修改即可工作，包括签名和重试
+// 请求必须携带 SigV4 Authorization 头，但不校验签名本身
+type Emulator struct {
+	operations   map[string]operation // Operations indexed by name // 按名称索引的操作
+	requestCount atomic.Int64         // Number of handled requests // 已处理的请求数
+}
+
+// NewEmulator creates Emulator serving the given FakeKms
+//
+// NewEmulator 创建为给定 FakeKms 提供服务的 Emulator
+func NewEmulator(fake *FakeKms) *Emulator {
+	must.Full(fake)
+	return &Emulator{
+		operations: map[string]operation{
+			"CreateKey":                           newOperation(fake.CreateKey),
+			"DescribeKey":                         newOperation(fake.DescribeKey),
+			"EnableKey":                           newOperation(fake.EnableKey),
+			"DisableKey":                          newOperation(fake.DisableKey),
+			"CreateAlias":                         newOperation(fake.CreateAlias),
+			"DeleteAlias":                         newOperation(fake.DeleteAlias),
+			"ListAliases":                         newOperation(fake.ListAliases),
+			"Encrypt":                             newOperation(fake.Encrypt),
+			"Decrypt":                             newOperation(fake.Decrypt),
+			"ReEncrypt":                           newOperation(fake.ReEncrypt),
+			"GenerateDataKey":                     newOperation(fake.GenerateDataKey),
+			"GenerateDataKeyWithoutPlaintext":     newOperation(fake.GenerateDataKeyWithoutPlaintext),
+			"GenerateDataKeyPair":                 newOperation(fake.GenerateDataKeyPair),
+			"GenerateDataKeyPairWithoutPlaintext": newOperation(fake.GenerateDataKeyPairWithoutPlaintext),
+			"GetPublicKey":                        newOperation(fake.GetPublicKey),
+			"Sign":                                newOperation(fake.Sign),
+			"Verify":                              newOperation(fake.Verify),
+			"GenerateMac":                         newOperation(fake.GenerateMac),
+			"VerifyMac":                           newOperation(fake.VerifyMac),
+			"DeriveSharedSecret":                  newOperation(fake.DeriveSharedSecret),
+		},
+	}
+}
+
+// NewEmulatorServer starts an httptest.Server serving Emulator on top of the given FakeKms
+// Callers close the server when done, usually with t.Cleanup(server.Close)
+//
+// NewEmulatorServer 启动基于给定 FakeKms 提供 Emulator 服务的 httptest.Server
+// 调用方在使用结束后关闭服务，通常使用 t.Cleanup(server.Close)
+func NewEmulatorServer(fake *FakeKms) *httptest.Server {
+	return httptest.NewServer(NewEmulator(fake))
+}
+
+// NewEmulatorClient creates kms.Client pointing at the emulator endpoint with static test credentials
+//
+// NewEmulatorClient 创建指向模拟器地址、使用静态测试凭证的 kms.Client
+func NewEmulatorClient(endpointURL string, optFns ...func(*kms.Options)) *kms.Client {
+	return kms.New(kms.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIAEMULATOR", "emulator-secret", ""),
+		BaseEndpoint: aws.String(must.Nice(endpointURL)),
+	}, optFns...)
+}
+
+// RequestCount returns the number of requests handled, retries included
+//
+// RequestCount 返回已处理的请求数，包括重试请求
+func (e *Emulator) RequestCount() int64 {
+	return e.requestCount.Load()
+}
+
+// ServeHTTP dispatches the request by X-Amz-Target and writes the JSON response or error
+//
+// ServeHTTP 根据 X-Amz-Target 分发请求并写入 JSON 响应或错误
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.requestCount.Add(1)
+
+	if r.Method != http.MethodPost {
+		writeError(w, &smithy.GenericAPIError{Code: "UnknownOperationException", Message: "only POST is supported", Fault: smithy.FaultClient})
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		writeError(w, &smithy.GenericAPIError{Code: "MissingAuthenticationTokenException", Message: "request is missing SigV4 authorization", Fault: smithy.FaultClient})
+		return
+	}
+	target := r.Header.Get("X-Amz-Target")
+	op, exists := e.operations[strings.TrimPrefix(target, targetPrefix)]
+	if !strings.HasPrefix(target, targetPrefix) || !exists {
+		writeError(w, &smithy.GenericAPIError{Code: "UnknownOperationException", Message: "unknown operation " + target, Fault: smithy.FaultClient})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, &smithy.GenericAPIError{Code: "SerializationException", Message: err.Error(), Fault: smithy.FaultClient})
+		return
+	}
+	output, err := op(r.Context(), body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	data, err := json.Marshal(toWireOutput(output))
+	if err != nil {
+		writeError(w, &types.KMSInternalException{Message: aws.String(err.Error())})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// newOperation adapts a FakeKms method into an operation decoding its input from JSON
+// AWS JSON member names match the SDK field names, so inputs decode directly
+//
+// newOperation 将 FakeKms 方法适配为从 JSON 解码输入的 operation
+// AWS JSON 成员名与 SDK 字段名一致，因此输入可以直接解码
+func newOperation[I any, O any](call func(context.Context, *I, ...func(*kms.Options)) (O, error)) operation {
+	return func(ctx context.Context, body []byte) (any, error) {
+		input := new(I)
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, input); err != nil {
+				return nil, &smithy.GenericAPIError{Code: "SerializationException", Message: err.Error(), Fault: smithy.FaultClient}
+			}
+		}
+		return call(ctx, input)
+	}
+}
+
+// wireKeyMetadata encodes KeyMetadata timestamps as epoch seconds, as AWS JSON 1.1 requires
+// The shadowing fields take precedence over the embedded ones in encoding/json
+//
+// wireKeyMetadata 按 AWS JSON 1.1 的要求将 KeyMetadata 时间戳编码为纪元秒
+// 在 encoding/json 中外层同名字段优先于内嵌字段
+type wireKeyMetadata struct {
+	*types.KeyMetadata
+	CreationDate *float64 `json:",omitempty"`
+	DeletionDate *float64 `json:",omitempty"`
+	ValidTo      *float64 `json:",omitempty"`
+}
+
+// toWireOutput converts outputs holding KeyMetadata into their wire shape
+//
+// toWireOutput 将包含 KeyMetadata 的输出转换为协议格式
+func toWireOutput(output any) any {
+	switch res := output.(type) {
+	case *kms.CreateKeyOutput:
+		return map[string]any{"KeyMetadata": newWireKeyMetadata(res.KeyMetadata)}
+	case *kms.DescribeKeyOutput:
+		return map[string]any{"KeyMetadata": newWireKeyMetadata(res.KeyMetadata)}
+	default:
+		return output
+	}
+}
+
+func newWireKeyMetadata(metadata *types.KeyMetadata) *wireKeyMetadata {
+	res := &wireKeyMetadata{KeyMetadata: metadata}
+	if metadata.CreationDate != nil {
+		res.CreationDate = aws.Float64(float64(metadata.CreationDate.UnixMilli()) / 1000)
+	}
+	if metadata.DeletionDate != nil {
+		res.DeletionDate = aws.Float64(float64(metadata.DeletionDate.UnixMilli()) / 1000)
+	}
+	if metadata.ValidTo != nil {
+		res.ValidTo = aws.Float64(float64(metadata.ValidTo.UnixMilli()) / 1000)
+	}
+	return res
+}
+
+// writeError writes the AWS JSON 1.1 error body, using status 500 on server faults and 400 otherwise
+//
+// writeError 写入 AWS JSON 1.1 错误体，服务端错误使用 500 状态码，其余使用 400
+func writeError(w http.ResponseWriter, err error) {
+	code, message, status := "KMSInternalException", err.Error(), http.StatusInternalServerError
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code, message = apiErr.ErrorCode(), apiErr.ErrorMessage()
+		if apiErr.ErrorFault() != smithy.FaultServer {
+			status = http.StatusBadRequest
+		}
+	}
+	data, _ := json.Marshal(map[string]string{"__type": code, "message": message})
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Amzn-ErrorType", code)
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
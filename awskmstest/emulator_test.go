@@ -0,0 +1,268 @@
+package awskmstest_test
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewAwsKmsFromEnv_Emulator tests NewAwsKmsFromEnv end-to-end against the local emulator
+// Uses the custom endpoint URL environment variable to point the real kms.Client at the emulator
+//
+// TestNewAwsKmsFromEnv_Emulator 针对本地模拟器端到端测试 NewAwsKmsFromEnv
+// 通过自定义端点 URL 环境变量让真实的 kms.Client 指向模拟器
+func TestNewAwsKmsFromEnv_Emulator(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	fake.MustCreateAlias("alias/emulator", keyID)
+
+	server := awskmstest.NewEmulatorServer(fake)
+	t.Cleanup(server.Close)
+
+	envOptions := awskms.NewEnvOptions()
+	t.Setenv(envOptions.RegionID, "us-east-1")
+	t.Setenv(envOptions.AccessKeyID, "AKIAEMULATOR")
+	t.Setenv(envOptions.SecretAccessKey, "emulator-secret")
+	t.Setenv(envOptions.SessionToken, "")
+	t.Setenv(envOptions.EncryptKeyID, "alias/emulator")
+	t.Setenv(envOptions.EndpointURL, server.URL)
+
+	awsKms, err := awskms.NewAwsKmsFromEnv(envOptions)
+	require.NoError(t, err)
+
+	ciphertext, err := awsKms.Encrypts("test message from emulator")
+	require.NoError(t, err)
+
+	plaintext, err := awsKms.Decrypts(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "test message from emulator", plaintext)
+}
+
+// TestEmulator_Operations tests the wire protocol of each emulated operation through kms.Client
+//
+// TestEmulator_Operations 通过 kms.Client 测试每个模拟操作的协议编解码
+func TestEmulator_Operations(t *testing.T) {
+	ctx := context.Background()
+	server := awskmstest.NewEmulatorServer(awskmstest.NewFakeKms())
+	t.Cleanup(server.Close)
+	client := awskmstest.NewEmulatorClient(server.URL)
+
+	created, err := client.CreateKey(ctx, &kms.CreateKeyInput{Description: aws.String("emulator key")})
+	require.NoError(t, err)
+	keyID := aws.ToString(created.KeyMetadata.KeyId)
+	require.NotNil(t, created.KeyMetadata.CreationDate)
+
+	_, err = client.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String("alias/ops"), TargetKeyId: aws.String(keyID)})
+	require.NoError(t, err)
+
+	t.Run("DescribeKey", func(t *testing.T) {
+		res, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/ops")})
+		require.NoError(t, err)
+		require.Equal(t, keyID, aws.ToString(res.KeyMetadata.KeyId))
+		require.Equal(t, "emulator key", aws.ToString(res.KeyMetadata.Description))
+		require.Equal(t, types.KeyStateEnabled, res.KeyMetadata.KeyState)
+		require.Equal(t, created.KeyMetadata.CreationDate.Unix(), res.KeyMetadata.CreationDate.Unix())
+	})
+
+	t.Run("ListAliases", func(t *testing.T) {
+		res, err := client.ListAliases(ctx, &kms.ListAliasesInput{KeyId: aws.String(keyID)})
+		require.NoError(t, err)
+		require.Len(t, res.Aliases, 1)
+		require.Equal(t, "alias/ops", aws.ToString(res.Aliases[0].AliasName))
+	})
+
+	t.Run("GenerateDataKey", func(t *testing.T) {
+		res, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+			KeyId:             aws.String("alias/ops"),
+			KeySpec:           types.DataKeySpecAes256,
+			EncryptionContext: map[string]string{"purpose": "test"},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Plaintext, 32)
+
+		out, err := client.Decrypt(ctx, &kms.DecryptInput{
+			CiphertextBlob:    res.CiphertextBlob,
+			EncryptionContext: map[string]string{"purpose": "test"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, res.Plaintext, out.Plaintext)
+	})
+
+	t.Run("ReEncrypt", func(t *testing.T) {
+		other, err := client.CreateKey(ctx, &kms.CreateKeyInput{})
+		require.NoError(t, err)
+
+		enc, err := client.Encrypt(ctx, &kms.EncryptInput{KeyId: aws.String(keyID), Plaintext: []byte("rotate me")})
+		require.NoError(t, err)
+
+		res, err := client.ReEncrypt(ctx, &kms.ReEncryptInput{
+			CiphertextBlob:   enc.CiphertextBlob,
+			DestinationKeyId: other.KeyMetadata.KeyId,
+		})
+		require.NoError(t, err)
+		require.Equal(t, aws.ToString(other.KeyMetadata.Arn), aws.ToString(res.KeyId))
+		require.Equal(t, aws.ToString(created.KeyMetadata.Arn), aws.ToString(res.SourceKeyId))
+
+		out, err := client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: res.CiphertextBlob})
+		require.NoError(t, err)
+		require.Equal(t, "rotate me", string(out.Plaintext))
+	})
+
+	t.Run("GetPublicKey", func(t *testing.T) {
+		rsaKey, err := client.CreateKey(ctx, &kms.CreateKeyInput{KeySpec: types.KeySpecRsa2048, KeyUsage: types.KeyUsageTypeEncryptDecrypt})
+		require.NoError(t, err)
+
+		res, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: rsaKey.KeyMetadata.KeyId})
+		require.NoError(t, err)
+		require.Equal(t, types.KeySpecRsa2048, res.KeySpec)
+		require.Contains(t, res.EncryptionAlgorithms, types.EncryptionAlgorithmSpecRsaesOaepSha256)
+		publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+		require.NoError(t, err)
+		require.IsType(t, &rsa.PublicKey{}, publicKey)
+
+		enc, err := client.Encrypt(ctx, &kms.EncryptInput{
+			KeyId:               rsaKey.KeyMetadata.KeyId,
+			Plaintext:           []byte("asymmetric"),
+			EncryptionAlgorithm: types.EncryptionAlgorithmSpecRsaesOaepSha256,
+		})
+		require.NoError(t, err)
+
+		out, err := client.Decrypt(ctx, &kms.DecryptInput{
+			KeyId:               rsaKey.KeyMetadata.KeyId,
+			CiphertextBlob:      enc.CiphertextBlob,
+			EncryptionAlgorithm: types.EncryptionAlgorithmSpecRsaesOaepSha256,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "asymmetric", string(out.Plaintext))
+	})
+
+	t.Run("SignVerify", func(t *testing.T) {
+		ecKey, err := client.CreateKey(ctx, &kms.CreateKeyInput{KeySpec: types.KeySpecEccNistP256, KeyUsage: types.KeyUsageTypeSignVerify})
+		require.NoError(t, err)
+
+		res, err := client.Sign(ctx, &kms.SignInput{
+			KeyId:            ecKey.KeyMetadata.KeyId,
+			Message:          []byte("sign me"),
+			SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+		})
+		require.NoError(t, err)
+
+		out, err := client.Verify(ctx, &kms.VerifyInput{
+			KeyId:            ecKey.KeyMetadata.KeyId,
+			Message:          []byte("sign me"),
+			Signature:        res.Signature,
+			SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+		})
+		require.NoError(t, err)
+		require.True(t, out.SignatureValid)
+
+		_, err = client.Verify(ctx, &kms.VerifyInput{
+			KeyId:            ecKey.KeyMetadata.KeyId,
+			Message:          []byte("sign me!"),
+			Signature:        res.Signature,
+			SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+		})
+		var invalidSignature *types.KMSInvalidSignatureException
+		require.ErrorAs(t, err, &invalidSignature)
+	})
+
+	t.Run("GenerateDataKeyPair", func(t *testing.T) {
+		res, err := client.GenerateDataKeyPairWithoutPlaintext(ctx, &kms.GenerateDataKeyPairWithoutPlaintextInput{
+			KeyId:       aws.String("alias/ops"),
+			KeyPairSpec: types.DataKeyPairSpecEccNistP256,
+		})
+		require.NoError(t, err)
+		require.Equal(t, types.DataKeyPairSpecEccNistP256, res.KeyPairSpec)
+		publicKey, err := x509.ParsePKIXPublicKey(res.PublicKey)
+		require.NoError(t, err)
+
+		out, err := client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: res.PrivateKeyCiphertextBlob})
+		require.NoError(t, err)
+		privateKey, err := x509.ParsePKCS8PrivateKey(out.Plaintext)
+		require.NoError(t, err)
+		require.True(t, privateKey.(*ecdsa.PrivateKey).PublicKey.Equal(publicKey))
+	})
+
+	t.Run("DeriveSharedSecret", func(t *testing.T) {
+		ecKey, err := client.CreateKey(ctx, &kms.CreateKeyInput{KeySpec: types.KeySpecEccNistP256, KeyUsage: types.KeyUsageTypeKeyAgreement})
+		require.NoError(t, err)
+
+		pub, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: ecKey.KeyMetadata.KeyId})
+		require.NoError(t, err)
+		require.Equal(t, []types.KeyAgreementAlgorithmSpec{types.KeyAgreementAlgorithmSpecEcdh}, pub.KeyAgreementAlgorithms)
+		kmsPublicKey, err := x509.ParsePKIXPublicKey(pub.PublicKey)
+		require.NoError(t, err)
+		kmsEcdhPublicKey, err := kmsPublicKey.(*ecdsa.PublicKey).ECDH()
+		require.NoError(t, err)
+
+		peerPrivateKey, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		peerPublicKey, err := x509.MarshalPKIXPublicKey(peerPrivateKey.PublicKey())
+		require.NoError(t, err)
+
+		res, err := client.DeriveSharedSecret(ctx, &kms.DeriveSharedSecretInput{
+			KeyId:                 ecKey.KeyMetadata.KeyId,
+			KeyAgreementAlgorithm: types.KeyAgreementAlgorithmSpecEcdh,
+			PublicKey:             peerPublicKey,
+		})
+		require.NoError(t, err)
+		expected, err := peerPrivateKey.ECDH(kmsEcdhPublicKey)
+		require.NoError(t, err)
+		require.Equal(t, expected, res.SharedSecret)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/missing")})
+		var notFound *types.NotFoundException
+		require.ErrorAs(t, err, &notFound)
+
+		_, err = client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: []byte("garbage")})
+		var invalid *types.InvalidCiphertextException
+		require.ErrorAs(t, err, &invalid)
+	})
+}
+
+// TestEmulator_Retry tests that SDK retries reach the emulator after injected server faults
+//
+// TestEmulator_Retry 测试注入服务端错误后 SDK 的重试能到达模拟器
+func TestEmulator_Retry(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+
+	emulator := awskmstest.NewEmulator(fake)
+	server := httptest.NewServer(emulator)
+	t.Cleanup(server.Close)
+
+	fake.FailNext(2, &types.KMSInternalException{Message: aws.String("injected fault")})
+
+	// Skip backoff delays so the retries do not slow down the test // 跳过退避等待，避免重试拖慢测试
+	client := awskmstest.NewEmulatorClient(server.URL, func(o *kms.Options) {
+		o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) {
+			so.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) {
+				return 0, nil
+			})
+		})
+	})
+	awsKms := awskms.NewAwsKms(client, keyID)
+	ciphertext, err := awsKms.Encrypt([]byte("retry me"))
+	require.NoError(t, err)
+	require.EqualValues(t, 3, emulator.RequestCount())
+
+	plaintext, err := awsKms.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "retry me", string(plaintext))
+}
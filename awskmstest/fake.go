@@ -0,0 +1,728 @@
+// Package awskmstest: In-memory AWS KMS fake in offline testing
+// Provides FakeKms which implements awskms.KmsAPI without network access or AWS credentials
+// Produces opaque ciphertext blobs that embed the key ID and bind the encryption context
+// Rejects tampered blobs and mismatched encryption context the same way AWS KMS does
+//
+// awskmstest: 用于离线测试的内存 AWS KMS 假实现
+// 提供实现 awskms.KmsAPI 的 FakeKms，无需网络访问和 AWS 凭证
+// 生成嵌入 key ID 并绑定加密上下文的不透明密文块
+// 与 AWS KMS 一样拒绝被篡改的密文块和不匹配的加密上下文
+package awskmstest
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+const (
+	blobVersion = 0x01 // symmetric ciphertext blob version // 对称密文块版本
+	nonceSize   = 12   // AES-GCM nonce size // AES-GCM nonce 长度
+	maxPlainLen = 4096 // KMS plaintext size limit // KMS 明文长度上限
+)
+
+var (
+	_ awskms.KmsAPI          = (*FakeKms)(nil)
+	_ awskms.DataKeyAPI      = (*FakeKms)(nil)
+	_ awskms.ReEncryptAPI    = (*FakeKms)(nil)
+	_ awskms.DataKeyPairAPI  = (*FakeKms)(nil)
+	_ awskms.KeyAgreementAPI = (*FakeKms)(nil)
+	_ awskms.SignerAPI       = (*FakeKms)(nil)
+	_ awskms.MacAPI          = (*FakeKms)(nil)
+	_ awskms.DecrypterAPI    = (*FakeKms)(nil)
+)
+
+// FakeKms is an in-memory AWS KMS implementation in offline testing
+// Keys live in process memory and are lost when the instance is dropped
+// Safe in concurrent use across goroutines
+//
+// FakeKms 是用于离线测试的内存 AWS KMS 实现
+// 密钥保存在进程内存中，实例释放后即丢失
+// 可在多个 goroutine 中并发使用
+type FakeKms struct {
+	region    string              // Region used in key ARNs // 用于 key ARN 的区域
+	accountID string              // Account ID used in key ARNs // 用于 key ARN 的账号 ID
+	mutex     sync.RWMutex        // Guards keys and aliases // 保护 keys 和 aliases
+	keys      map[string]*fakeKey // Keys indexed by key ID // 按 key ID 索引的密钥
+	aliases   map[string]string   // Alias name to key ID // 别名到 key ID 的映射
+	faults    []error             // Errors returned by the next API calls // 后续 API 调用将返回的错误
+}
+
+// fakeKey holds key metadata and secret material of one fake KMS key
+//
+// fakeKey 保存单个假 KMS 密钥的元数据和密钥材料
+type fakeKey struct {
+	metadata   types.KeyMetadata // Key metadata as returned by DescribeKey // DescribeKey 返回的密钥元数据
+	material   []byte            // Symmetric or HMAC key material // 对称或 HMAC 密钥材料
+	privateKey crypto.Signer     // Private key of asymmetric keys, nil on symmetric keys // 非对称密钥的私钥，对称密钥为 nil
+}
+
+// NewFakeKms creates FakeKms with default region us-east-1 and a fixed test account ID
+//
+// NewFakeKms 创建默认区域为 us-east-1、使用固定测试账号 ID 的 FakeKms
+func NewFakeKms() *FakeKms {
+	return NewFakeKmsWithRegion("us-east-1")
+}
+
+// NewFakeKmsWithRegion creates FakeKms which reports the given region in key ARNs
+//
+// NewFakeKmsWithRegion 创建在 key ARN 中使用给定区域的 FakeKms
+func NewFakeKmsWithRegion(region string) *FakeKms {
+	return &FakeKms{
+		region:    must.Nice(region),
+		accountID: "111122223333",
+		keys:      map[string]*fakeKey{},
+		aliases:   map[string]string{},
+	}
+}
+
+// MustCreateKey creates a key with the given spec and usage and returns its key ID
+// Panics when the spec is not supported, which keeps test setup concise
+//
+// MustCreateKey 使用给定的规格和用途创建密钥并返回 key ID
+// 规格不支持时 panic，使测试准备代码保持简洁
+func (f *FakeKms) MustCreateKey(keySpec types.KeySpec, keyUsage types.KeyUsageType) string {
+	res := rese.P1(f.CreateKey(context.Background(), &kms.CreateKeyInput{
+		KeySpec:  keySpec,
+		KeyUsage: keyUsage,
+	}))
+	return aws.ToString(res.KeyMetadata.KeyId)
+}
+
+// MustCreateAlias creates an alias pointing at the given key and panics on failure
+//
+// MustCreateAlias 创建指向给定密钥的别名，失败时 panic
+func (f *FakeKms) MustCreateAlias(aliasName string, keyID string) {
+	rese.P1(f.CreateAlias(context.Background(), &kms.CreateAliasInput{
+		AliasName:   aws.String(aliasName),
+		TargetKeyId: aws.String(keyID),
+	}))
+}
+
+// CreateKey creates a new fake KMS key, matching the AWS SDK CreateKey signature
+// Defaults to SYMMETRIC_DEFAULT and ENCRYPT_DECRYPT when spec and usage are not set
+//
+// CreateKey 创建新的假 KMS 密钥，签名与 AWS SDK 的 CreateKey 一致
+// 未设置规格和用途时默认使用 SYMMETRIC_DEFAULT 和 ENCRYPT_DECRYPT
+func (f *FakeKms) CreateKey(ctx context.Context, params *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	if params == nil {
+		params = &kms.CreateKeyInput{}
+	}
+	keySpec := params.KeySpec
+	if keySpec == "" {
+		keySpec = types.KeySpecSymmetricDefault
+	}
+	keyUsage := params.KeyUsage
+	if keyUsage == "" {
+		keyUsage = types.KeyUsageTypeEncryptDecrypt
+	}
+	key, err := newFakeKey(keySpec, keyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := newUUID()
+	if aws.ToBool(params.MultiRegion) {
+		keyID = newMultiRegionKeyID()
+	}
+	key.metadata.KeyId = aws.String(keyID)
+	key.metadata.Arn = aws.String(f.keyArn(keyID))
+	key.metadata.AWSAccountId = aws.String(f.accountID)
+	key.metadata.CreationDate = aws.Time(time.Now())
+	key.metadata.Description = params.Description
+	key.metadata.Enabled = true
+	key.metadata.KeyState = types.KeyStateEnabled
+	key.metadata.KeySpec = keySpec
+	key.metadata.CustomerMasterKeySpec = types.CustomerMasterKeySpec(keySpec)
+	key.metadata.KeyUsage = keyUsage
+	key.metadata.KeyManager = types.KeyManagerTypeCustomer
+	key.metadata.Origin = types.OriginTypeAwsKms
+	key.metadata.MultiRegion = aws.Bool(aws.ToBool(params.MultiRegion))
+	if aws.ToBool(params.MultiRegion) {
+		key.metadata.MultiRegionConfiguration = &types.MultiRegionConfiguration{
+			MultiRegionKeyType: types.MultiRegionKeyTypePrimary,
+			PrimaryKey:         &types.MultiRegionKey{Arn: key.metadata.Arn, Region: aws.String(f.region)},
+		}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.keys[keyID] = key
+	return &kms.CreateKeyOutput{KeyMetadata: cloneMetadata(key.metadata)}, nil
+}
+
+// CreateAlias creates an alias pointing at an existing key
+// Alias names must start with alias/ and must not be taken
+//
+// CreateAlias 创建指向已有密钥的别名
+// 别名必须以 alias/ 开头且不能已被占用
+func (f *FakeKms) CreateAlias(ctx context.Context, params *kms.CreateAliasInput, optFns ...func(*kms.Options)) (*kms.CreateAliasOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	aliasName := aws.ToString(params.AliasName)
+	if !strings.HasPrefix(aliasName, "alias/") || aliasName == "alias/" {
+		return nil, &types.InvalidAliasNameException{Message: aws.String("alias name must begin with alias/")}
+	}
+	if strings.HasPrefix(aliasName, "alias/aws/") {
+		return nil, &types.InvalidAliasNameException{Message: aws.String("alias/aws/ prefix is reserved")}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, exists := f.aliases[aliasName]; exists {
+		return nil, &types.AlreadyExistsException{Message: aws.String(fmt.Sprintf("alias %s already exists", aliasName))}
+	}
+	key, err := f.resolveKey(aws.ToString(params.TargetKeyId))
+	if err != nil {
+		return nil, err
+	}
+	f.aliases[aliasName] = aws.ToString(key.metadata.KeyId)
+	return &kms.CreateAliasOutput{}, nil
+}
+
+// DescribeKey returns metadata of the key identified by key ID, key ARN, alias name or alias ARN
+//
+// DescribeKey 返回通过 key ID、key ARN、别名或别名 ARN 标识的密钥元数据
+func (f *FakeKms) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveKey(aws.ToString(params.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: cloneMetadata(key.metadata)}, nil
+}
+
+// EnableKey sets the key state to Enabled so that it can be used again
+//
+// EnableKey 将密钥状态设为 Enabled 以便重新使用
+func (f *FakeKms) EnableKey(ctx context.Context, params *kms.EnableKeyInput, optFns ...func(*kms.Options)) (*kms.EnableKeyOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	key, err := f.resolveKey(aws.ToString(params.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	key.metadata.Enabled = true
+	key.metadata.KeyState = types.KeyStateEnabled
+	return &kms.EnableKeyOutput{}, nil
+}
+
+// DisableKey sets the key state to Disabled so that cryptographic operations get DisabledException
+//
+// DisableKey 将密钥状态设为 Disabled，之后的加密操作将返回 DisabledException
+func (f *FakeKms) DisableKey(ctx context.Context, params *kms.DisableKeyInput, optFns ...func(*kms.Options)) (*kms.DisableKeyOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	key, err := f.resolveKey(aws.ToString(params.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	key.metadata.Enabled = false
+	key.metadata.KeyState = types.KeyStateDisabled
+	return &kms.DisableKeyOutput{}, nil
+}
+
+// Encrypt encrypts plaintext with the symmetric key and returns an opaque ciphertext blob
+// The blob embeds the key ID and is bound to the encryption context through AES-GCM AAD
+//
+// Encrypt 使用对称密钥加密明文并返回不透明密文块
+// 密文块嵌入 key ID，并通过 AES-GCM AAD 绑定加密上下文
+func (f *FakeKms) Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	if len(params.Plaintext) == 0 || len(params.Plaintext) > maxPlainLen {
+		return nil, validationError(fmt.Sprintf("plaintext length must be between 1 and %d bytes", maxPlainLen))
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeEncryptDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	if key.privateKey != nil {
+		return key.encryptRsa(params)
+	}
+	if err := checkSymmetricAlgorithm(params.EncryptionAlgorithm); err != nil {
+		return nil, err
+	}
+	return &kms.EncryptOutput{
+		KeyId:               key.metadata.Arn,
+		CiphertextBlob:      key.seal(params.Plaintext, params.EncryptionContext),
+		EncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault,
+	}, nil
+}
+
+// Decrypt decrypts a ciphertext blob produced by this FakeKms
+// Detects the key from the blob, and returns IncorrectKeyException when KeyId names another key
+// Returns InvalidCiphertextException on tampered blobs or mismatched encryption context
+//
+// Decrypt 解密由该 FakeKms 生成的密文块
+// 从密文块中识别密钥，当 KeyId 指向其它密钥时返回 IncorrectKeyException
+// 密文块被篡改或加密上下文不匹配时返回 InvalidCiphertextException
+func (f *FakeKms) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	if isRsaAlgorithm(params.EncryptionAlgorithm) {
+		return f.decryptRsa(params)
+	}
+	key, plaintext, err := f.open(params.CiphertextBlob, params.EncryptionContext, aws.ToString(params.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSymmetricAlgorithm(params.EncryptionAlgorithm); err != nil {
+		return nil, err
+	}
+	return &kms.DecryptOutput{
+		KeyId:               key.metadata.Arn,
+		Plaintext:           plaintext,
+		EncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault,
+	}, nil
+}
+
+// GenerateDataKey returns a random data key in plaintext and encrypted under the given key
+// Requires exactly one of KeySpec (AES_128 or AES_256) and NumberOfBytes (1 to 1024)
+//
+// GenerateDataKey 返回随机数据密钥的明文以及使用给定密钥加密后的密文
+// KeySpec（AES_128 或 AES_256）与 NumberOfBytes（1 到 1024）必须且只能设置一个
+func (f *FakeKms) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	size, err := dataKeySize(params.KeySpec, params.NumberOfBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeEncryptDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.checkSymmetricKey(); err != nil {
+		return nil, err
+	}
+	plaintext := newRandomBytes(size)
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          key.metadata.Arn,
+		Plaintext:      plaintext,
+		CiphertextBlob: key.seal(plaintext, params.EncryptionContext),
+	}, nil
+}
+
+// GenerateDataKeyWithoutPlaintext returns a random data key encrypted under the given key only
+//
+// GenerateDataKeyWithoutPlaintext 只返回使用给定密钥加密后的随机数据密钥
+func (f *FakeKms) GenerateDataKeyWithoutPlaintext(ctx context.Context, params *kms.GenerateDataKeyWithoutPlaintextInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyWithoutPlaintextOutput, error) {
+	res, err := f.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             params.KeyId,
+		EncryptionContext: params.EncryptionContext,
+		KeySpec:           params.KeySpec,
+		NumberOfBytes:     params.NumberOfBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyWithoutPlaintextOutput{
+		KeyId:          res.KeyId,
+		CiphertextBlob: res.CiphertextBlob,
+	}, nil
+}
+
+// ReEncrypt decrypts the blob and encrypts it again under the destination key and context
+// The plaintext stays inside the fake, the same way it stays inside AWS KMS
+//
+// ReEncrypt 解密密文块并使用目标密钥和上下文重新加密
+// 明文只存在于假实现内部，与 AWS KMS 中的行为一致
+func (f *FakeKms) ReEncrypt(ctx context.Context, params *kms.ReEncryptInput, optFns ...func(*kms.Options)) (*kms.ReEncryptOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	source, plaintext, err := f.open(params.CiphertextBlob, params.SourceEncryptionContext, aws.ToString(params.SourceKeyId))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSymmetricAlgorithm(params.SourceEncryptionAlgorithm); err != nil {
+		return nil, err
+	}
+	destination, err := f.resolveUsableKey(aws.ToString(params.DestinationKeyId), types.KeyUsageTypeEncryptDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	if err := destination.checkSymmetricKey(); err != nil {
+		return nil, err
+	}
+	if err := checkSymmetricAlgorithm(params.DestinationEncryptionAlgorithm); err != nil {
+		return nil, err
+	}
+	return &kms.ReEncryptOutput{
+		KeyId:                          destination.metadata.Arn,
+		SourceKeyId:                    source.metadata.Arn,
+		CiphertextBlob:                 destination.seal(plaintext, params.DestinationEncryptionContext),
+		SourceEncryptionAlgorithm:      types.EncryptionAlgorithmSpecSymmetricDefault,
+		DestinationEncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault,
+	}, nil
+}
+
+// ListAliases lists aliases sorted by name, optionally limited to those of one key
+//
+// ListAliases 按名称排序列出别名，可选只列出指向某个密钥的别名
+func (f *FakeKms) ListAliases(ctx context.Context, params *kms.ListAliasesInput, optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	if params == nil {
+		params = &kms.ListAliasesInput{}
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	var targetKeyID string
+	if params.KeyId != nil {
+		key, err := f.resolveKey(aws.ToString(params.KeyId))
+		if err != nil {
+			return nil, err
+		}
+		targetKeyID = aws.ToString(key.metadata.KeyId)
+	}
+
+	aliasNames := make([]string, 0, len(f.aliases))
+	for aliasName := range f.aliases {
+		aliasNames = append(aliasNames, aliasName)
+	}
+	sort.Strings(aliasNames)
+
+	aliases := make([]types.AliasListEntry, 0, len(aliasNames))
+	for _, aliasName := range aliasNames {
+		keyID := f.aliases[aliasName]
+		if targetKeyID != "" && keyID != targetKeyID {
+			continue
+		}
+		aliases = append(aliases, types.AliasListEntry{
+			AliasName:   aws.String(aliasName),
+			AliasArn:    aws.String(fmt.Sprintf("arn:aws:kms:%s:%s:%s", f.region, f.accountID, aliasName)),
+			TargetKeyId: aws.String(keyID),
+		})
+	}
+	return &kms.ListAliasesOutput{Aliases: aliases}, nil
+}
+
+// DeleteAlias removes the alias without touching the key it points at
+//
+// DeleteAlias 删除别名，不影响其指向的密钥
+func (f *FakeKms) DeleteAlias(ctx context.Context, params *kms.DeleteAliasInput, optFns ...func(*kms.Options)) (*kms.DeleteAliasOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	aliasName := aws.ToString(params.AliasName)
+	if _, exists := f.aliases[aliasName]; !exists {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("alias %s is not found", aliasName))}
+	}
+	delete(f.aliases, aliasName)
+	return &kms.DeleteAliasOutput{}, nil
+}
+
+// FailNext makes the next count API calls return err before touching any key
+// Used to simulate throttling, outages and internal errors in tests
+//
+// FailNext 使后续 count 次 API 调用在访问密钥前直接返回 err
+// 用于在测试中模拟限流、故障和内部错误
+func (f *FakeKms) FailNext(count int, err error) {
+	must.Nice(err)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i := 0; i < count; i++ {
+		f.faults = append(f.faults, err)
+	}
+}
+
+// takeFault pops the next injected fault, returning nil when there is none
+//
+// takeFault 取出下一个注入的错误，没有时返回 nil
+func (f *FakeKms) takeFault() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.faults) == 0 {
+		return nil
+	}
+	err := f.faults[0]
+	f.faults = f.faults[1:]
+	return err
+}
+
+// open parses and decrypts a ciphertext blob, checking the expected key when given
+// Caller must hold the read lock
+//
+// open 解析并解密密文块，指定时检查期望的密钥
+// 调用方必须持有读锁
+func (f *FakeKms) open(blob []byte, encryptionContext map[string]string, expectKeyID string) (*fakeKey, []byte, error) {
+	keyID, nonce, sealed, ok := parseBlob(blob)
+	if !ok {
+		return nil, nil, invalidCiphertext()
+	}
+	key, exists := f.keys[keyID]
+	if !exists {
+		return nil, nil, invalidCiphertext()
+	}
+	if expectKeyID != "" {
+		expect, err := f.resolveKey(expectKeyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if expect != key {
+			return nil, nil, &types.IncorrectKeyException{Message: aws.String("the key ID in the request does not identify the key used to encrypt the ciphertext")}
+		}
+	}
+	if err := key.checkUsable(types.KeyUsageTypeEncryptDecrypt); err != nil {
+		return nil, nil, err
+	}
+	if key.material == nil {
+		return nil, nil, invalidCiphertext()
+	}
+	gcm := newGCM(key.material)
+	plaintext, err := gcm.Open(nil, nonce, sealed, blobAAD(keyID, encryptionContext))
+	if err != nil {
+		return nil, nil, invalidCiphertext()
+	}
+	return key, plaintext, nil
+}
+
+// resolveUsableKey resolves the key and checks it is enabled with the expected usage
+// Caller must hold the read lock
+//
+// resolveUsableKey 解析密钥并检查其已启用且用途符合预期
+// 调用方必须持有读锁
+func (f *FakeKms) resolveUsableKey(keyRef string, keyUsage types.KeyUsageType) (*fakeKey, error) {
+	key, err := f.resolveKey(keyRef)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.checkUsable(keyUsage); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// resolveKey finds a key by key ID, key ARN, alias name or alias ARN
+// Caller must hold the lock
+//
+// resolveKey 通过 key ID、key ARN、别名或别名 ARN 查找密钥
+// 调用方必须持有锁
+func (f *FakeKms) resolveKey(keyRef string) (*fakeKey, error) {
+	if keyRef == "" {
+		return nil, &types.NotFoundException{Message: aws.String("key ID is required")}
+	}
+	ref := keyRef
+	if strings.HasPrefix(ref, "arn:") {
+		parts := strings.SplitN(ref, ":", 6)
+		if len(parts) != 6 {
+			return nil, &types.InvalidArnException{Message: aws.String(fmt.Sprintf("invalid arn %s", keyRef))}
+		}
+		ref = strings.TrimPrefix(parts[5], "key/")
+	}
+	if strings.HasPrefix(ref, "alias/") {
+		keyID, exists := f.aliases[ref]
+		if !exists {
+			return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("alias %s is not found", keyRef))}
+		}
+		ref = keyID
+	}
+	key, exists := f.keys[ref]
+	if !exists {
+		return nil, &types.NotFoundException{Message: aws.String(fmt.Sprintf("key %s does not exist", keyRef))}
+	}
+	return key, nil
+}
+
+// keyArn formats the key ARN in this fake region and account
+//
+// keyArn 使用该假实现的区域和账号格式化 key ARN
+func (f *FakeKms) keyArn(keyID string) string {
+	return fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", f.region, f.accountID, keyID)
+}
+
+// checkUsable returns the KMS exception when the key is not enabled or has another usage
+//
+// checkUsable 当密钥未启用或用途不符时返回对应的 KMS 异常
+func (k *fakeKey) checkUsable(keyUsage types.KeyUsageType) error {
+	if k.metadata.KeyState != types.KeyStateEnabled {
+		return &types.DisabledException{Message: aws.String(fmt.Sprintf("%s is %s", aws.ToString(k.metadata.Arn), k.metadata.KeyState))}
+	}
+	if k.metadata.KeyUsage != keyUsage {
+		return &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("%s key usage is %s", aws.ToString(k.metadata.Arn), k.metadata.KeyUsage))}
+	}
+	return nil
+}
+
+// seal encrypts plaintext into the blob layout: version | len(keyID) | keyID | nonce | sealed
+//
+// seal 将明文加密为密文块格式：版本 | keyID 长度 | keyID | nonce | 密文
+func (k *fakeKey) seal(plaintext []byte, encryptionContext map[string]string) []byte {
+	keyID := aws.ToString(k.metadata.KeyId)
+	nonce := newRandomBytes(nonceSize)
+
+	blob := make([]byte, 0, 2+len(keyID)+nonceSize+len(plaintext)+16)
+	blob = append(blob, blobVersion, byte(len(keyID)))
+	blob = append(blob, keyID...)
+	blob = append(blob, nonce...)
+	return newGCM(k.material).Seal(blob, nonce, plaintext, blobAAD(keyID, encryptionContext))
+}
+
+// parseBlob splits a ciphertext blob into key ID, nonce and sealed payload
+//
+// parseBlob 将密文块拆分为 key ID、nonce 和密文载荷
+func parseBlob(blob []byte) (keyID string, nonce []byte, sealed []byte, ok bool) {
+	if len(blob) < 2 || blob[0] != blobVersion {
+		return "", nil, nil, false
+	}
+	size := int(blob[1])
+	if len(blob) < 2+size+nonceSize {
+		return "", nil, nil, false
+	}
+	keyID = string(blob[2 : 2+size])
+	nonce = blob[2+size : 2+size+nonceSize]
+	sealed = blob[2+size+nonceSize:]
+	return keyID, nonce, sealed, true
+}
+
+// blobAAD builds the additional authenticated data from the key ID and sorted encryption context
+//
+// blobAAD 使用 key ID 和排序后的加密上下文构造附加认证数据
+func blobAAD(keyID string, encryptionContext map[string]string) []byte {
+	names := make([]string, 0, len(encryptionContext))
+	for name := range encryptionContext {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	aad := appendLengthPrefixed(nil, keyID)
+	for _, name := range names {
+		aad = appendLengthPrefixed(aad, name)
+		aad = appendLengthPrefixed(aad, encryptionContext[name])
+	}
+	return aad
+}
+
+func appendLengthPrefixed(data []byte, value string) []byte {
+	data = binary.BigEndian.AppendUint32(data, uint32(len(value)))
+	return append(data, value...)
+}
+
+// checkSymmetricAlgorithm accepts the empty algorithm and SYMMETRIC_DEFAULT only
+//
+// checkSymmetricAlgorithm 只接受空算法和 SYMMETRIC_DEFAULT
+func checkSymmetricAlgorithm(algorithm types.EncryptionAlgorithmSpec) error {
+	if algorithm != "" && algorithm != types.EncryptionAlgorithmSpecSymmetricDefault {
+		return &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("algorithm %s is not valid with symmetric keys", algorithm))}
+	}
+	return nil
+}
+
+// dataKeySize returns the data key length from KeySpec or NumberOfBytes
+//
+// dataKeySize 根据 KeySpec 或 NumberOfBytes 返回数据密钥长度
+func dataKeySize(keySpec types.DataKeySpec, numberOfBytes *int32) (int, error) {
+	switch {
+	case keySpec != "" && numberOfBytes != nil:
+		return 0, validationError("KeySpec and NumberOfBytes cannot be set together")
+	case keySpec == types.DataKeySpecAes256:
+		return 32, nil
+	case keySpec == types.DataKeySpecAes128:
+		return 16, nil
+	case keySpec != "":
+		return 0, validationError(fmt.Sprintf("unknown data key spec %s", keySpec))
+	case numberOfBytes != nil && *numberOfBytes >= 1 && *numberOfBytes <= 1024:
+		return int(*numberOfBytes), nil
+	default:
+		return 0, validationError("either KeySpec or NumberOfBytes (1 to 1024) is required")
+	}
+}
+
+// validationError returns the unmodeled ValidationException in the shape the AWS SDK produces
+//
+// validationError 以 AWS SDK 的形式返回未建模的 ValidationException
+func validationError(message string) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: message, Fault: smithy.FaultClient}
+}
+
+func invalidCiphertext() error {
+	return &types.InvalidCiphertextException{Message: aws.String("the ciphertext is invalid or the encryption context does not match")}
+}
+
+func newGCM(material []byte) cipher.AEAD {
+	return rese.V1(cipher.NewGCM(rese.V1(aes.NewCipher(material))))
+}
+
+func newRandomBytes(size int) []byte {
+	data := make([]byte, size)
+	rese.C1(rand.Read(data))
+	return data
+}
+
+// newUUID generates a random version 4 UUID in the format used by KMS key IDs
+//
+// newUUID 生成 KMS key ID 格式的随机版本 4 UUID
+func newUUID() string {
+	b := newRandomBytes(16)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// cloneMetadata returns a copy of metadata so callers cannot mutate fake state
+//
+// cloneMetadata 返回元数据的副本，避免调用方修改假实现的状态
+func cloneMetadata(metadata types.KeyMetadata) *types.KeyMetadata {
+	res := metadata
+	res.EncryptionAlgorithms = append([]types.EncryptionAlgorithmSpec(nil), metadata.EncryptionAlgorithms...)
+	res.SigningAlgorithms = append([]types.SigningAlgorithmSpec(nil), metadata.SigningAlgorithms...)
+	res.MacAlgorithms = append([]types.MacAlgorithmSpec(nil), metadata.MacAlgorithms...)
+	res.KeyAgreementAlgorithms = append([]types.KeyAgreementAlgorithmSpec(nil), metadata.KeyAgreementAlgorithms...)
+	if metadata.MultiRegionConfiguration != nil {
+		configuration := *metadata.MultiRegionConfiguration
+		configuration.ReplicaKeys = append([]types.MultiRegionKey(nil), configuration.ReplicaKeys...)
+		res.MultiRegionConfiguration = &configuration
+	}
+	return &res
+}
@@ -0,0 +1,269 @@
+package awskmstest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// GetPublicKey returns the DER encoded public key of an asymmetric key with its algorithms
+// Returns UnsupportedOperationException on symmetric keys, which have no public key
+//
+// GetPublicKey 返回非对称密钥的 DER 编码公钥及其算法
+// 对称密钥没有公钥，返回 UnsupportedOperationException
+func (f *FakeKms) GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveKey(aws.ToString(params.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	if key.metadata.KeyState != types.KeyStateEnabled {
+		return nil, &types.DisabledException{Message: aws.String(fmt.Sprintf("%s is %s", aws.ToString(key.metadata.Arn), key.metadata.KeyState))}
+	}
+	if key.privateKey == nil {
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("%s is not an asymmetric key", aws.ToString(key.metadata.Arn)))}
+	}
+	var der []byte
+	if publicKey, ok := key.privateKey.Public().(*secp256k1.PublicKey); ok {
+		der, err = marshalSecp256k1PublicKey(publicKey)
+	} else {
+		der, err = x509.MarshalPKIXPublicKey(key.privateKey.Public())
+	}
+	if err != nil {
+		return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+	}
+	return &kms.GetPublicKeyOutput{
+		KeyId:                  key.metadata.Arn,
+		PublicKey:              der,
+		KeySpec:                key.metadata.KeySpec,
+		CustomerMasterKeySpec:  key.metadata.CustomerMasterKeySpec,
+		KeyUsage:               key.metadata.KeyUsage,
+		EncryptionAlgorithms:   append([]types.EncryptionAlgorithmSpec(nil), key.metadata.EncryptionAlgorithms...),
+		SigningAlgorithms:      append([]types.SigningAlgorithmSpec(nil), key.metadata.SigningAlgorithms...),
+		KeyAgreementAlgorithms: append([]types.KeyAgreementAlgorithmSpec(nil), key.metadata.KeyAgreementAlgorithms...),
+	}, nil
+}
+
+// newFakeKey generates key material and algorithm metadata in the given spec and usage
+// Returns UnsupportedOperationException on combinations the fake does not implement
+//
+// newFakeKey 按给定的规格和用途生成密钥材料和算法元数据
+// 假实现不支持的组合返回 UnsupportedOperationException
+func newFakeKey(keySpec types.KeySpec, keyUsage types.KeyUsageType) (*fakeKey, error) {
+	switch {
+	case keySpec == types.KeySpecSymmetricDefault && keyUsage == types.KeyUsageTypeEncryptDecrypt:
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				EncryptionAlgorithms: []types.EncryptionAlgorithmSpec{types.EncryptionAlgorithmSpecSymmetricDefault},
+			},
+			material: newRandomBytes(32),
+		}, nil
+	case rsaKeyBits(keySpec) != 0 && keyUsage == types.KeyUsageTypeEncryptDecrypt:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits(keySpec))
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				EncryptionAlgorithms: []types.EncryptionAlgorithmSpec{
+					types.EncryptionAlgorithmSpecRsaesOaepSha1,
+					types.EncryptionAlgorithmSpecRsaesOaepSha256,
+				},
+			},
+			privateKey: privateKey,
+		}, nil
+	case rsaKeyBits(keySpec) != 0 && keyUsage == types.KeyUsageTypeSignVerify:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits(keySpec))
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				SigningAlgorithms: []types.SigningAlgorithmSpec{
+					types.SigningAlgorithmSpecRsassaPssSha256,
+					types.SigningAlgorithmSpecRsassaPssSha384,
+					types.SigningAlgorithmSpecRsassaPssSha512,
+					types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+					types.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+					types.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+				},
+			},
+			privateKey: privateKey,
+		}, nil
+	case eccSigningAlgorithm(keySpec) != "" && keyUsage == types.KeyUsageTypeSignVerify:
+		privateKey, err := ecdsa.GenerateKey(eccCurve(keySpec), rand.Reader)
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				SigningAlgorithms: []types.SigningAlgorithmSpec{eccSigningAlgorithm(keySpec)},
+			},
+			privateKey: privateKey,
+		}, nil
+	case eccSigningAlgorithm(keySpec) != "" && keyUsage == types.KeyUsageTypeKeyAgreement:
+		privateKey, err := ecdsa.GenerateKey(eccCurve(keySpec), rand.Reader)
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				KeyAgreementAlgorithms: []types.KeyAgreementAlgorithmSpec{types.KeyAgreementAlgorithmSpecEcdh},
+			},
+			privateKey: privateKey,
+		}, nil
+	case keySpec == types.KeySpecEccSecgP256k1 && keyUsage == types.KeyUsageTypeSignVerify:
+		privateKey, err := newSecp256k1Signer()
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				SigningAlgorithms: []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha256},
+			},
+			privateKey: privateKey,
+		}, nil
+	case keySpec == keySpecEccNistEdwards25519 && keyUsage == types.KeyUsageTypeSignVerify:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				SigningAlgorithms: []types.SigningAlgorithmSpec{signingAlgorithmSpecEd25519Sha512},
+			},
+			privateKey: privateKey,
+		}, nil
+	case hmacKeySize(keySpec) != 0 && keyUsage == types.KeyUsageTypeGenerateVerifyMac:
+		return &fakeKey{
+			metadata: types.KeyMetadata{
+				MacAlgorithms: []types.MacAlgorithmSpec{types.MacAlgorithmSpec(strings.Replace(string(keySpec), "HMAC_", "HMAC_SHA_", 1))},
+			},
+			material: newRandomBytes(hmacKeySize(keySpec)),
+		}, nil
+	default:
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("fake kms does not support key spec %s with usage %s", keySpec, keyUsage))}
+	}
+}
+
+// encryptRsa encrypts with RSAES-OAEP the way KMS does, returning the raw RSA ciphertext
+// Asymmetric keys need an explicit algorithm and do not accept encryption context
+//
+// encryptRsa 与 KMS 一样使用 RSAES-OAEP 加密，返回原始 RSA 密文
+// 非对称密钥需要显式指定算法，且不接受加密上下文
+func (k *fakeKey) encryptRsa(params *kms.EncryptInput) (*kms.EncryptOutput, error) {
+	hashFunc, err := k.rsaHash(params.EncryptionAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.EncryptionContext) > 0 {
+		return nil, validationError("encryption context is not supported with asymmetric keys")
+	}
+	publicKey := k.privateKey.Public().(*rsa.PublicKey)
+	ciphertext, err := rsa.EncryptOAEP(hashFunc(), rand.Reader, publicKey, params.Plaintext, nil)
+	if err != nil {
+		return nil, validationError(fmt.Sprintf("plaintext is too long for %s with %s", k.metadata.KeySpec, params.EncryptionAlgorithm))
+	}
+	return &kms.EncryptOutput{
+		KeyId:               k.metadata.Arn,
+		CiphertextBlob:      ciphertext,
+		EncryptionAlgorithm: params.EncryptionAlgorithm,
+	}, nil
+}
+
+// decryptRsa decrypts raw RSA ciphertext, which carries no key ID so KeyId is required
+// Caller must hold the read lock
+//
+// decryptRsa 解密原始 RSA 密文，密文不包含 key ID，因此必须指定 KeyId
+// 调用方必须持有读锁
+func (f *FakeKms) decryptRsa(params *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if aws.ToString(params.KeyId) == "" {
+		return nil, validationError("KeyId is required with asymmetric encryption algorithms")
+	}
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeEncryptDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	if key.privateKey == nil {
+		return nil, &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("algorithm %s is not valid with symmetric keys", params.EncryptionAlgorithm))}
+	}
+	hashFunc, err := key.rsaHash(params.EncryptionAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.EncryptionContext) > 0 {
+		return nil, validationError("encryption context is not supported with asymmetric keys")
+	}
+	plaintext, err := rsa.DecryptOAEP(hashFunc(), rand.Reader, key.privateKey.(*rsa.PrivateKey), params.CiphertextBlob, nil)
+	if err != nil {
+		return nil, invalidCiphertext()
+	}
+	return &kms.DecryptOutput{
+		KeyId:               key.metadata.Arn,
+		Plaintext:           plaintext,
+		EncryptionAlgorithm: params.EncryptionAlgorithm,
+	}, nil
+}
+
+// rsaHash returns the OAEP hash of the algorithm, checking the key supports it
+//
+// rsaHash 返回算法对应的 OAEP 哈希，并检查密钥是否支持该算法
+func (k *fakeKey) rsaHash(algorithm types.EncryptionAlgorithmSpec) (func() hash.Hash, error) {
+	if _, ok := k.privateKey.(*rsa.PrivateKey); !ok || !isRsaAlgorithm(algorithm) {
+		return nil, &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("algorithm %q is not valid with %s", algorithm, k.metadata.KeySpec))}
+	}
+	if algorithm == types.EncryptionAlgorithmSpecRsaesOaepSha1 {
+		return sha1.New, nil
+	}
+	return sha256.New, nil
+}
+
+// checkSymmetricKey rejects asymmetric keys in operations working on symmetric keys only
+//
+// checkSymmetricKey 在只支持对称密钥的操作中拒绝非对称密钥
+func (k *fakeKey) checkSymmetricKey() error {
+	if k.material == nil {
+		return &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("%s is not a symmetric encryption key", aws.ToString(k.metadata.Arn)))}
+	}
+	return nil
+}
+
+// isRsaAlgorithm reports whether the algorithm is one of the RSAES-OAEP algorithms
+//
+// isRsaAlgorithm 判断算法是否为 RSAES-OAEP 算法之一
+func isRsaAlgorithm(algorithm types.EncryptionAlgorithmSpec) bool {
+	return algorithm == types.EncryptionAlgorithmSpecRsaesOaepSha1 || algorithm == types.EncryptionAlgorithmSpecRsaesOaepSha256
+}
+
+// rsaKeyBits returns the modulus size of RSA key specs and 0 on other specs
+//
+// rsaKeyBits 返回 RSA 密钥规格的模数位数，其它规格返回 0
+func rsaKeyBits(keySpec types.KeySpec) int {
+	switch keySpec {
+	case types.KeySpecRsa2048:
+		return 2048
+	case types.KeySpecRsa3072:
+		return 3072
+	case types.KeySpecRsa4096:
+		return 4096
+	default:
+		return 0
+	}
+}
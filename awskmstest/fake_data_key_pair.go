@@ -0,0 +1,104 @@
+package awskmstest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// GenerateDataKeyPair returns a new key pair with the PKCS#8 private key in plaintext and encrypted under the given key
+// Supports RSA_2048/3072/4096 and ECC_NIST_P256/P384/P521 pairs under symmetric ENCRYPT_DECRYPT keys
+//
+// GenerateDataKeyPair 返回新的密钥对，包含明文 PKCS#8 私钥和使用给定密钥加密的私钥
+// 支持对称 ENCRYPT_DECRYPT 密钥下的 RSA_2048/3072/4096 和 ECC_NIST_P256/P384/P521 密钥对
+func (f *FakeKms) GenerateDataKeyPair(ctx context.Context, params *kms.GenerateDataKeyPairInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	if params.Recipient != nil {
+		return nil, &types.UnsupportedOperationException{Message: aws.String("fake kms does not support Recipient attestation")}
+	}
+	privateKey, err := newDataKeyPairPrivateKey(params.KeyPairSpec)
+	if err != nil {
+		return nil, err
+	}
+	privateKeyDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+	}
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeEncryptDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.checkSymmetricKey(); err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyPairOutput{
+		KeyId:                    key.metadata.Arn,
+		KeyPairSpec:              params.KeyPairSpec,
+		PublicKey:                publicKeyDer,
+		PrivateKeyPlaintext:      privateKeyDer,
+		PrivateKeyCiphertextBlob: key.seal(privateKeyDer, params.EncryptionContext),
+	}, nil
+}
+
+// GenerateDataKeyPairWithoutPlaintext returns a new key pair with the private key encrypted under the given key only
+//
+// GenerateDataKeyPairWithoutPlaintext 返回新的密钥对，私钥只以使用给定密钥加密的形式返回
+func (f *FakeKms) GenerateDataKeyPairWithoutPlaintext(ctx context.Context, params *kms.GenerateDataKeyPairWithoutPlaintextInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairWithoutPlaintextOutput, error) {
+	res, err := f.GenerateDataKeyPair(ctx, &kms.GenerateDataKeyPairInput{
+		KeyId:             params.KeyId,
+		KeyPairSpec:       params.KeyPairSpec,
+		EncryptionContext: params.EncryptionContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clear(res.PrivateKeyPlaintext)
+	return &kms.GenerateDataKeyPairWithoutPlaintextOutput{
+		KeyId:                    res.KeyId,
+		KeyPairSpec:              res.KeyPairSpec,
+		PublicKey:                res.PublicKey,
+		PrivateKeyCiphertextBlob: res.PrivateKeyCiphertextBlob,
+	}, nil
+}
+
+// newDataKeyPairPrivateKey generates the private key of the data key pair spec
+//
+// newDataKeyPairPrivateKey 生成数据密钥对规格对应的私钥
+func newDataKeyPairPrivateKey(keyPairSpec types.DataKeyPairSpec) (crypto.Signer, error) {
+	keySpec := types.KeySpec(keyPairSpec)
+	switch {
+	case rsaKeyBits(keySpec) != 0:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits(keySpec))
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return privateKey, nil
+	case eccSigningAlgorithm(keySpec) != "":
+		privateKey, err := ecdsa.GenerateKey(eccCurve(keySpec), rand.Reader)
+		if err != nil {
+			return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+		}
+		return privateKey, nil
+	case keyPairSpec == "":
+		return nil, validationError("KeyPairSpec is required")
+	default:
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("fake kms does not support key pair spec %s", keyPairSpec))}
+	}
+}
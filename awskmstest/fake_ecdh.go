@@ -0,0 +1,76 @@
+package awskmstest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// DeriveSharedSecret runs ECDH between a KEY_AGREEMENT key and the DER SPKI public key of the peer
+// Returns the raw shared secret, the x-coordinate of the shared point, as KMS does
+//
+// DeriveSharedSecret 在 KEY_AGREEMENT 密钥与对方的 DER SPKI 公钥之间执行 ECDH
+// 与 KMS 一样返回原始共享密钥，即共享点的 x 坐标
+func (f *FakeKms) DeriveSharedSecret(ctx context.Context, params *kms.DeriveSharedSecretInput, optFns ...func(*kms.Options)) (*kms.DeriveSharedSecretOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeKeyAgreement)
+	if err != nil {
+		return nil, err
+	}
+	if params.KeyAgreementAlgorithm != types.KeyAgreementAlgorithmSpecEcdh {
+		return nil, validationError(fmt.Sprintf("key agreement algorithm %q is not valid", params.KeyAgreementAlgorithm))
+	}
+	if params.Recipient != nil {
+		return nil, &types.UnsupportedOperationException{Message: aws.String("fake kms does not support Recipient attestation")}
+	}
+	sharedSecret, err := key.deriveEcdh(params.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DeriveSharedSecretOutput{
+		KeyId:                 key.metadata.Arn,
+		KeyAgreementAlgorithm: params.KeyAgreementAlgorithm,
+		KeyOrigin:             key.metadata.Origin,
+		SharedSecret:          sharedSecret,
+	}, nil
+}
+
+// deriveEcdh parses the peer public key and computes the ECDH shared secret on the curve of the key
+//
+// deriveEcdh 解析对方公钥，并在密钥所在曲线上计算 ECDH 共享密钥
+func (k *fakeKey) deriveEcdh(peerPublicKeyDer []byte) ([]byte, error) {
+	peerPublicKey, err := x509.ParsePKIXPublicKey(peerPublicKeyDer)
+	if err != nil {
+		return nil, validationError(fmt.Sprintf("public key is not a valid DER SPKI: %v", err))
+	}
+	peerEcdsaPublicKey, ok := peerPublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, validationError(fmt.Sprintf("public key type %T is not an ECC key", peerPublicKey))
+	}
+	privateKey, ok := k.privateKey.(*ecdsa.PrivateKey)
+	if !ok || peerEcdsaPublicKey.Curve != privateKey.Curve {
+		return nil, validationError("public key curve does not match the key spec")
+	}
+	ecdhPrivateKey, err := privateKey.ECDH()
+	if err != nil {
+		return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+	}
+	ecdhPublicKey, err := peerEcdsaPublicKey.ECDH()
+	if err != nil {
+		return nil, validationError(err.Error())
+	}
+	sharedSecret, err := ecdhPrivateKey.ECDH(ecdhPublicKey)
+	if err != nil {
+		return nil, validationError(err.Error())
+	}
+	return sharedSecret, nil
+}
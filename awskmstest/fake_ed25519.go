@@ -0,0 +1,66 @@
+package awskmstest
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Ed25519 enum values of KMS, declared here since the pinned SDK predates them
+//
+// KMS 的 Ed25519 枚举值，由于固定的 SDK 版本早于这些值而在此声明
+const (
+	keySpecEccNistEdwards25519        types.KeySpec              = "ECC_NIST_EDWARDS25519" // Ed25519 key spec // Ed25519 密钥规格
+	signingAlgorithmSpecEd25519Sha512 types.SigningAlgorithmSpec = "ED25519_SHA_512"       // Pure Ed25519 on RAW messages // 对 RAW 消息的纯 Ed25519
+)
+
+// signEd25519 signs a RAW message with pure Ed25519, which hashes the whole message itself
+//
+// signEd25519 使用纯 Ed25519 对 RAW 消息签名，纯 Ed25519 自行对完整消息做哈希
+func (k *fakeKey) signEd25519(params *kms.SignInput) (*kms.SignOutput, error) {
+	if err := k.checkEd25519(params.SigningAlgorithm, params.MessageType, params.Message); err != nil {
+		return nil, err
+	}
+	return &kms.SignOutput{
+		KeyId:            k.metadata.Arn,
+		Signature:        ed25519.Sign(k.privateKey.(ed25519.PrivateKey), params.Message),
+		SigningAlgorithm: params.SigningAlgorithm,
+	}, nil
+}
+
+// verifyEd25519 checks a pure Ed25519 signature, returning KMSInvalidSignatureException when it does not match
+//
+// verifyEd25519 校验纯 Ed25519 签名，不匹配时返回 KMSInvalidSignatureException
+func (k *fakeKey) verifyEd25519(params *kms.VerifyInput) (*kms.VerifyOutput, error) {
+	if err := k.checkEd25519(params.SigningAlgorithm, params.MessageType, params.Message); err != nil {
+		return nil, err
+	}
+	publicKey := k.privateKey.Public().(ed25519.PublicKey)
+	if !ed25519.Verify(publicKey, params.Message, params.Signature) {
+		return nil, &types.KMSInvalidSignatureException{Message: aws.String("the signature is not valid")}
+	}
+	return &kms.VerifyOutput{
+		KeyId:            k.metadata.Arn,
+		SignatureValid:   true,
+		SigningAlgorithm: params.SigningAlgorithm,
+	}, nil
+}
+
+// checkEd25519 accepts ED25519_SHA_512 on RAW messages up to 4096 bytes, the prehashed variant is not implemented
+//
+// checkEd25519 接受 ED25519_SHA_512 和不超过 4096 字节的 RAW 消息，未实现预哈希变体
+func (k *fakeKey) checkEd25519(algorithm types.SigningAlgorithmSpec, messageType types.MessageType, message []byte) error {
+	if algorithm != signingAlgorithmSpecEd25519Sha512 {
+		return &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("algorithm %q is not valid with %s", algorithm, k.metadata.KeySpec))}
+	}
+	if messageType != "" && messageType != types.MessageTypeRaw {
+		return validationError(fmt.Sprintf("message type %s is not valid with %s", messageType, algorithm))
+	}
+	if len(message) == 0 || len(message) > maxPlainLen {
+		return validationError(fmt.Sprintf("message length must be between 1 and %d bytes", maxPlainLen))
+	}
+	return nil
+}
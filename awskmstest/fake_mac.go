@@ -0,0 +1,109 @@
+package awskmstest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// GenerateMac computes the HMAC of a message up to 4096 bytes with a GENERATE_VERIFY_MAC key
+//
+// GenerateMac 使用 GENERATE_VERIFY_MAC 密钥计算不超过 4096 字节消息的 HMAC
+func (f *FakeKms) GenerateMac(ctx context.Context, params *kms.GenerateMacInput, optFns ...func(*kms.Options)) (*kms.GenerateMacOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeGenerateVerifyMac)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := key.hmac(params.MacAlgorithm, params.Message)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateMacOutput{
+		KeyId:        key.metadata.Arn,
+		Mac:          mac,
+		MacAlgorithm: params.MacAlgorithm,
+	}, nil
+}
+
+// VerifyMac recomputes the HMAC and returns KMSInvalidMacException when it does not match
+//
+// VerifyMac 重新计算 HMAC，不匹配时返回 KMSInvalidMacException
+func (f *FakeKms) VerifyMac(ctx context.Context, params *kms.VerifyMacInput, optFns ...func(*kms.Options)) (*kms.VerifyMacOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeGenerateVerifyMac)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := key.hmac(params.MacAlgorithm, params.Message)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, params.Mac) {
+		return nil, &types.KMSInvalidMacException{Message: aws.String("the MAC is not valid")}
+	}
+	return &kms.VerifyMacOutput{
+		KeyId:        key.metadata.Arn,
+		MacValid:     true,
+		MacAlgorithm: params.MacAlgorithm,
+	}, nil
+}
+
+// hmac checks the algorithm matches the key and computes the HMAC of the message
+//
+// hmac 检查算法与密钥匹配并计算消息的 HMAC
+func (k *fakeKey) hmac(algorithm types.MacAlgorithmSpec, message []byte) ([]byte, error) {
+	if len(k.metadata.MacAlgorithms) != 1 || k.metadata.MacAlgorithms[0] != algorithm {
+		return nil, &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("algorithm %q is not valid with %s", algorithm, k.metadata.KeySpec))}
+	}
+	if len(message) == 0 || len(message) > maxPlainLen {
+		return nil, validationError(fmt.Sprintf("message length must be between 1 and %d bytes", maxPlainLen))
+	}
+	var newHash func() hash.Hash
+	switch algorithm {
+	case types.MacAlgorithmSpecHmacSha224:
+		newHash = sha256.New224
+	case types.MacAlgorithmSpecHmacSha256:
+		newHash = sha256.New
+	case types.MacAlgorithmSpecHmacSha384:
+		newHash = sha512.New384
+	default:
+		newHash = sha512.New
+	}
+	mac := hmac.New(newHash, k.material)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+// hmacKeySize returns the key material size of HMAC key specs and 0 on other specs
+//
+// hmacKeySize 返回 HMAC 密钥规格的密钥材料长度，其它规格返回 0
+func hmacKeySize(keySpec types.KeySpec) int {
+	switch keySpec {
+	case types.KeySpecHmac224:
+		return 28
+	case types.KeySpecHmac256:
+		return 32
+	case types.KeySpecHmac384:
+		return 48
+	case types.KeySpecHmac512:
+		return 64
+	default:
+		return 0
+	}
+}
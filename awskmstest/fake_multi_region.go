@@ -0,0 +1,85 @@
+package awskmstest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// MustCreateMultiRegionKey creates a multi-Region primary key with an mrk- key ID and returns its key ID
+//
+// MustCreateMultiRegionKey 创建 key ID 以 mrk- 开头的多区域主密钥并返回 key ID
+func (f *FakeKms) MustCreateMultiRegionKey(keySpec types.KeySpec, keyUsage types.KeyUsageType) string {
+	res := rese.P1(f.CreateKey(context.Background(), &kms.CreateKeyInput{
+		KeySpec:     keySpec,
+		KeyUsage:    keyUsage,
+		MultiRegion: aws.Bool(true),
+	}))
+	return aws.ToString(res.KeyMetadata.KeyId)
+}
+
+// ReplicateKey copies a multi-Region key into the replica FakeKms, which stands in for another region
+// The replica shares key ID and key material, so ciphertext from either region decrypts in both
+// Key state is tracked per region, disabling the replica leaves the primary enabled
+//
+// ReplicateKey 将多区域密钥复制到代表另一个区域的副本 FakeKms 中
+// 副本共享 key ID 和密钥材料，任一区域的密文都能在两个区域解密
+// 密钥状态按区域分别维护，禁用副本不影响主密钥
+func (f *FakeKms) ReplicateKey(keyID string, replica *FakeKms) (*types.KeyMetadata, error) {
+	must.Nice(replica)
+	must.True(replica != f)
+
+	f.mutex.RLock()
+	key, err := f.resolveKey(keyID)
+	if err != nil {
+		f.mutex.RUnlock()
+		return nil, err
+	}
+	if !aws.ToBool(key.metadata.MultiRegion) {
+		f.mutex.RUnlock()
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("%s is not a multi-Region key", aws.ToString(key.metadata.Arn)))}
+	}
+	metadata := *cloneMetadata(key.metadata)
+	replicaKey := &fakeKey{
+		material:   key.material,
+		privateKey: key.privateKey,
+	}
+	f.mutex.RUnlock()
+
+	replicaKeyID := aws.ToString(metadata.KeyId)
+	metadata.Arn = aws.String(replica.keyArn(replicaKeyID))
+	metadata.AWSAccountId = aws.String(replica.accountID)
+	metadata.Enabled = true
+	metadata.KeyState = types.KeyStateEnabled
+	metadata.MultiRegionConfiguration.MultiRegionKeyType = types.MultiRegionKeyTypeReplica
+	metadata.MultiRegionConfiguration.ReplicaKeys = []types.MultiRegionKey{{Arn: metadata.Arn, Region: aws.String(replica.region)}}
+	replicaKey.metadata = metadata
+
+	replica.mutex.Lock()
+	defer replica.mutex.Unlock()
+	if _, exists := replica.keys[replicaKeyID]; exists {
+		return nil, &types.AlreadyExistsException{Message: aws.String(fmt.Sprintf("%s is already replicated to %s", replicaKeyID, replica.region))}
+	}
+	replica.keys[replicaKeyID] = replicaKey
+	return cloneMetadata(replicaKey.metadata), nil
+}
+
+// MustReplicateKey replicates a multi-Region key into the replica FakeKms and returns the replica key ARN
+//
+// MustReplicateKey 将多区域密钥复制到副本 FakeKms 并返回副本的 key ARN
+func (f *FakeKms) MustReplicateKey(keyID string, replica *FakeKms) string {
+	metadata := rese.P1(f.ReplicateKey(keyID, replica))
+	return aws.ToString(metadata.Arn)
+}
+
+// newMultiRegionKeyID returns a key ID in the mrk- format of multi-Region keys
+//
+// newMultiRegionKeyID 返回多区域密钥 mrk- 格式的 key ID
+func newMultiRegionKeyID() string {
+	return fmt.Sprintf("mrk-%x", newRandomBytes(16))
+}
@@ -0,0 +1,57 @@
+package awskmstest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFakeKms_ReplicateKey tests ciphertext of a multi-Region key decrypts in the replica region and key state is per region
+//
+// TestFakeKms_ReplicateKey 测试多区域密钥的密文可以在副本区域解密，并且密钥状态按区域维护
+func TestFakeKms_ReplicateKey(t *testing.T) {
+	ctx := context.Background()
+	primary := awskmstest.NewFakeKmsWithRegion("us-east-1")
+	replica := awskmstest.NewFakeKmsWithRegion("eu-west-1")
+
+	keyID := primary.MustCreateMultiRegionKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	require.True(t, strings.HasPrefix(keyID, "mrk-"))
+	replicaArn := primary.MustReplicateKey(keyID, replica)
+	require.Equal(t, "arn:aws:kms:eu-west-1:111122223333:key/"+keyID, replicaArn)
+
+	described, err := replica.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	require.NoError(t, err)
+	require.True(t, aws.ToBool(described.KeyMetadata.MultiRegion))
+	require.Equal(t, types.MultiRegionKeyTypeReplica, described.KeyMetadata.MultiRegionConfiguration.MultiRegionKeyType)
+	require.Contains(t, aws.ToString(described.KeyMetadata.MultiRegionConfiguration.PrimaryKey.Arn), "us-east-1")
+
+	ciphertext, err := awskms.NewAwsKms(primary, keyID).Encrypt([]byte("test message"))
+	require.NoError(t, err)
+	plaintext, err := awskms.NewAwsKms(replica, replicaArn).Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	_, err = primary.DisableKey(ctx, &kms.DisableKeyInput{KeyId: aws.String(keyID)})
+	require.NoError(t, err)
+	plaintext, err = awskms.NewAwsKms(replica, replicaArn).Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "test message", string(plaintext))
+
+	t.Run("AlreadyReplicated", func(t *testing.T) {
+		_, err := primary.ReplicateKey(keyID, replica)
+		require.Error(t, err)
+	})
+
+	t.Run("SingleRegionKey", func(t *testing.T) {
+		singleKeyID := primary.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+		_, err := primary.ReplicateKey(singleKeyID, replica)
+		require.Error(t, err)
+	})
+}
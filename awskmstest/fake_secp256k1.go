@@ -0,0 +1,102 @@
+package awskmstest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+var (
+	oidPublicKeyEcdsa = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1} // id-ecPublicKey // id-ecPublicKey
+	oidCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}       // secp256k1 named curve // secp256k1 命名曲线
+)
+
+// secp256k1Signer is the private key of ECC_SECG_P256K1 keys, which crypto/ecdsa does not support
+// Signatures are DER encoded and, like KMS, S is not normalized to the low half of the order
+//
+// secp256k1Signer 是 ECC_SECG_P256K1 密钥的私钥，crypto/ecdsa 不支持该曲线
+// 签名为 DER 编码，并且与 KMS 一样，S 不会规范化到阶的下半部分
+type secp256k1Signer struct {
+	privateKey *secp256k1.PrivateKey // secp256k1 private key // secp256k1 私钥
+}
+
+// newSecp256k1Signer generates a fresh secp256k1 private key
+//
+// newSecp256k1Signer 生成新的 secp256k1 私钥
+func newSecp256k1Signer() (*secp256k1Signer, error) {
+	privateKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &secp256k1Signer{privateKey: privateKey}, nil
+}
+
+// Public returns the *secp256k1.PublicKey of the key
+//
+// Public 返回密钥的 *secp256k1.PublicKey
+func (s *secp256k1Signer) Public() crypto.PublicKey {
+	return s.privateKey.PubKey()
+}
+
+// Sign signs the digest and flips S into the high half at random, as KMS signatures may carry either
+//
+// Sign 对摘要签名，并随机将 S 翻转到高半部分，因为 KMS 签名两种情况都可能出现
+func (s *secp256k1Signer) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	signature := ecdsa.Sign(s.privateKey, digest)
+	r, sValue := signature.R(), signature.S()
+	var flip [1]byte
+	if _, err := rand.Read(flip[:]); err != nil {
+		return nil, err
+	}
+	if flip[0]&1 == 1 {
+		sValue.Negate()
+	}
+	rBytes, sBytes := r.Bytes(), sValue.Bytes()
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(rBytes[:]),
+		S: new(big.Int).SetBytes(sBytes[:]),
+	})
+}
+
+// verifySecp256k1 checks a DER signature with a secp256k1 public key, accepting high S as KMS does
+//
+// verifySecp256k1 使用 secp256k1 公钥校验 DER 签名，与 KMS 一样接受高位 S
+func verifySecp256k1(publicKey *secp256k1.PublicKey, digest []byte, signature []byte) bool {
+	var values struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(signature, &values)
+	if err != nil || len(rest) != 0 || values.R.Sign() <= 0 || values.S.Sign() <= 0 {
+		return false
+	}
+	if values.R.BitLen() > 256 || values.S.BitLen() > 256 {
+		return false
+	}
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(values.R.Bytes()) || s.SetByteSlice(values.S.Bytes()) {
+		return false
+	}
+	return ecdsa.NewSignature(&r, &s).Verify(digest, publicKey)
+}
+
+// marshalSecp256k1PublicKey encodes the secp256k1 public key as DER SubjectPublicKeyInfo, as KMS GetPublicKey does
+//
+// marshalSecp256k1PublicKey 与 KMS GetPublicKey 一样将 secp256k1 公钥编码为 DER SubjectPublicKeyInfo
+func marshalSecp256k1PublicKey(publicKey *secp256k1.PublicKey) ([]byte, error) {
+	curve, err := asn1.Marshal(oidCurveSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+	point := publicKey.SerializeUncompressed()
+	return asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyEcdsa, Parameters: asn1.RawValue{FullBytes: curve}},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+}
@@ -0,0 +1,199 @@
+package awskmstest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 signing hash // SHA-256 签名哈希
+	_ "crypto/sha512" // SHA-384 and SHA-512 signing hashes // SHA-384 和 SHA-512 签名哈希
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Sign signs a message or digest with the private key of a SIGN_VERIFY key
+// RAW messages up to 4096 bytes are hashed first, DIGEST messages must match the hash size
+// Signatures use the KMS formats: PSS salt equals hash size, ECDSA signatures are DER encoded
+//
+// Sign 使用 SIGN_VERIFY 密钥的私钥对消息或摘要签名
+// 不超过 4096 字节的 RAW 消息会先被哈希，DIGEST 消息长度必须等于哈希长度
+// 签名使用 KMS 的格式：PSS 盐长等于哈希长度，ECDSA 签名为 DER 编码
+func (f *FakeKms) Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeSignVerify)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.privateKey.(ed25519.PrivateKey); ok {
+		return key.signEd25519(params)
+	}
+	hash, digest, err := key.signingDigest(params.SigningAlgorithm, params.MessageType, params.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	switch privateKey := key.privateKey.(type) {
+	case *rsa.PrivateKey:
+		if isPssAlgorithm(params.SigningAlgorithm) {
+			signature, err = rsa.SignPSS(rand.Reader, privateKey, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, privateKey, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		signature, err = ecdsa.SignASN1(rand.Reader, privateKey, digest)
+	case *secp256k1Signer:
+		signature, err = privateKey.Sign(rand.Reader, digest, hash)
+	default:
+		err = fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	if err != nil {
+		return nil, &types.KMSInternalException{Message: aws.String(err.Error())}
+	}
+	return &kms.SignOutput{
+		KeyId:            key.metadata.Arn,
+		Signature:        signature,
+		SigningAlgorithm: params.SigningAlgorithm,
+	}, nil
+}
+
+// Verify checks a signature with the public key, returning KMSInvalidSignatureException when it does not match
+//
+// Verify 使用公钥校验签名，不匹配时返回 KMSInvalidSignatureException
+func (f *FakeKms) Verify(ctx context.Context, params *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error) {
+	if err := f.takeFault(); err != nil {
+		return nil, err
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	key, err := f.resolveUsableKey(aws.ToString(params.KeyId), types.KeyUsageTypeSignVerify)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.privateKey.(ed25519.PrivateKey); ok {
+		return key.verifyEd25519(params)
+	}
+	hash, digest, err := key.signingDigest(params.SigningAlgorithm, params.MessageType, params.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := false
+	switch publicKey := key.privateKey.Public().(type) {
+	case *rsa.PublicKey:
+		if isPssAlgorithm(params.SigningAlgorithm) {
+			valid = rsa.VerifyPSS(publicKey, hash, digest, params.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		} else {
+			valid = rsa.VerifyPKCS1v15(publicKey, hash, digest, params.Signature) == nil
+		}
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(publicKey, digest, params.Signature)
+	case *secp256k1.PublicKey:
+		valid = verifySecp256k1(publicKey, digest, params.Signature)
+	}
+	if !valid {
+		return nil, &types.KMSInvalidSignatureException{Message: aws.String("the signature is not valid")}
+	}
+	return &kms.VerifyOutput{
+		KeyId:            key.metadata.Arn,
+		SignatureValid:   true,
+		SigningAlgorithm: params.SigningAlgorithm,
+	}, nil
+}
+
+// signingDigest checks the algorithm against the key and returns the hash and digest to sign
+//
+// signingDigest 检查算法与密钥是否匹配，并返回用于签名的哈希和摘要
+func (k *fakeKey) signingDigest(algorithm types.SigningAlgorithmSpec, messageType types.MessageType, message []byte) (crypto.Hash, []byte, error) {
+	supported := false
+	for _, one := range k.metadata.SigningAlgorithms {
+		supported = supported || one == algorithm
+	}
+	if !supported {
+		return 0, nil, &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("algorithm %q is not valid with %s", algorithm, k.metadata.KeySpec))}
+	}
+	hash := signingHash(algorithm)
+	switch messageType {
+	case "", types.MessageTypeRaw:
+		if len(message) == 0 || len(message) > maxPlainLen {
+			return 0, nil, validationError(fmt.Sprintf("message length must be between 1 and %d bytes", maxPlainLen))
+		}
+		digest := hash.New()
+		digest.Write(message)
+		return hash, digest.Sum(nil), nil
+	case types.MessageTypeDigest:
+		if len(message) != hash.Size() {
+			return 0, nil, validationError(fmt.Sprintf("digest length must be %d bytes with %s", hash.Size(), algorithm))
+		}
+		return hash, message, nil
+	default:
+		return 0, nil, validationError(fmt.Sprintf("unknown message type %s", messageType))
+	}
+}
+
+// signingHash returns the hash of the signing algorithm
+//
+// signingHash 返回签名算法对应的哈希
+func signingHash(algorithm types.SigningAlgorithmSpec) crypto.Hash {
+	switch algorithm {
+	case types.SigningAlgorithmSpecRsassaPssSha384, types.SigningAlgorithmSpecRsassaPkcs1V15Sha384, types.SigningAlgorithmSpecEcdsaSha384:
+		return crypto.SHA384
+	case types.SigningAlgorithmSpecRsassaPssSha512, types.SigningAlgorithmSpecRsassaPkcs1V15Sha512, types.SigningAlgorithmSpecEcdsaSha512:
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+// isPssAlgorithm reports whether the signing algorithm is one of the RSASSA-PSS algorithms
+//
+// isPssAlgorithm 判断签名算法是否为 RSASSA-PSS 算法之一
+func isPssAlgorithm(algorithm types.SigningAlgorithmSpec) bool {
+	switch algorithm {
+	case types.SigningAlgorithmSpecRsassaPssSha256, types.SigningAlgorithmSpecRsassaPssSha384, types.SigningAlgorithmSpecRsassaPssSha512:
+		return true
+	default:
+		return false
+	}
+}
+
+// eccSigningAlgorithm returns the only signing algorithm KMS allows with the NIST curve spec
+//
+// eccSigningAlgorithm 返回 KMS 允许该 NIST 曲线规格使用的唯一签名算法
+func eccSigningAlgorithm(keySpec types.KeySpec) types.SigningAlgorithmSpec {
+	switch keySpec {
+	case types.KeySpecEccNistP256:
+		return types.SigningAlgorithmSpecEcdsaSha256
+	case types.KeySpecEccNistP384:
+		return types.SigningAlgorithmSpecEcdsaSha384
+	case types.KeySpecEccNistP521:
+		return types.SigningAlgorithmSpecEcdsaSha512
+	default:
+		return ""
+	}
+}
+
+// eccCurve returns the elliptic curve of the NIST curve spec
+//
+// eccCurve 返回 NIST 曲线规格对应的椭圆曲线
+func eccCurve(keySpec types.KeySpec) elliptic.Curve {
+	switch keySpec {
+	case types.KeySpecEccNistP384:
+		return elliptic.P384()
+	case types.KeySpecEccNistP521:
+		return elliptic.P521()
+	default:
+		return elliptic.P256()
+	}
+}
@@ -0,0 +1,142 @@
+package awskmstest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFakeKms_AwsKms tests AwsKms encryption and decryption fully offline using FakeKms
+// Covers bytes and base64 string operations with key ID and alias references
+//
+// TestFakeKms_AwsKms 使用 FakeKms 完全离线地测试 AwsKms 的加密和解密
+// 覆盖使用 key ID 和别名引用的字节和 base64 字符串操作
+func TestFakeKms_AwsKms(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	fake.MustCreateAlias("alias/test", keyID)
+
+	t.Run("KeyID", func(t *testing.T) {
+		awsKms := awskms.NewAwsKms(fake, keyID)
+
+		ciphertext, err := awsKms.Encrypt([]byte("test message"))
+		require.NoError(t, err)
+		require.Contains(t, string(ciphertext), keyID)
+
+		plaintext, err := awsKms.Decrypt(ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(plaintext))
+	})
+
+	t.Run("Alias", func(t *testing.T) {
+		awsKms := awskms.NewAwsKms(fake, "alias/test")
+
+		ciphertext, err := awsKms.Encrypts("test message")
+		require.NoError(t, err)
+
+		plaintext, err := awsKms.Decrypts(ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, "test message", plaintext)
+	})
+}
+
+// TestFakeKms_Decrypt tests the rejection paths of FakeKms Decrypt
+// Verifies tampered blobs, mismatched encryption context, wrong key and disabled key
+//
+// TestFakeKms_Decrypt 测试 FakeKms Decrypt 的拒绝路径
+// 验证被篡改的密文块、不匹配的加密上下文、错误的密钥以及已禁用的密钥
+func TestFakeKms_Decrypt(t *testing.T) {
+	ctx := context.Background()
+	fake := awskmstest.NewFakeKms()
+	keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	otherKeyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+
+	encryptionContext := map[string]string{"tenant": "a", "record": "1"}
+	res, err := fake.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             aws.String(keyID),
+		Plaintext:         []byte("test message"),
+		EncryptionContext: encryptionContext,
+	})
+	require.NoError(t, err)
+	blob := res.CiphertextBlob
+
+	t.Run("Success", func(t *testing.T) {
+		out, err := fake.Decrypt(ctx, &kms.DecryptInput{
+			CiphertextBlob:    blob,
+			EncryptionContext: map[string]string{"record": "1", "tenant": "a"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "test message", string(out.Plaintext))
+		require.Equal(t, aws.ToString(res.KeyId), aws.ToString(out.KeyId))
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := append([]byte(nil), blob...)
+		tampered[len(tampered)-1] ^= 0x01
+
+		_, err := fake.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: tampered, EncryptionContext: encryptionContext})
+		var invalid *types.InvalidCiphertextException
+		require.ErrorAs(t, err, &invalid)
+	})
+
+	t.Run("ContextMismatch", func(t *testing.T) {
+		_, err := fake.Decrypt(ctx, &kms.DecryptInput{
+			CiphertextBlob:    blob,
+			EncryptionContext: map[string]string{"tenant": "b", "record": "1"},
+		})
+		var invalid *types.InvalidCiphertextException
+		require.ErrorAs(t, err, &invalid)
+	})
+
+	t.Run("IncorrectKey", func(t *testing.T) {
+		_, err := fake.Decrypt(ctx, &kms.DecryptInput{
+			CiphertextBlob:    blob,
+			EncryptionContext: encryptionContext,
+			KeyId:             aws.String(otherKeyID),
+		})
+		var incorrect *types.IncorrectKeyException
+		require.ErrorAs(t, err, &incorrect)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		_, err := fake.DisableKey(ctx, &kms.DisableKeyInput{KeyId: aws.String(keyID)})
+		require.NoError(t, err)
+		defer func() {
+			_, err := fake.EnableKey(ctx, &kms.EnableKeyInput{KeyId: aws.String(keyID)})
+			require.NoError(t, err)
+		}()
+
+		_, err = fake.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: blob, EncryptionContext: encryptionContext})
+		var disabled *types.DisabledException
+		require.ErrorAs(t, err, &disabled)
+	})
+}
+
+// TestFakeKms_DescribeKey tests key lookup by key ID, key ARN and alias
+//
+// TestFakeKms_DescribeKey 测试通过 key ID、key ARN 和别名查找密钥
+func TestFakeKms_DescribeKey(t *testing.T) {
+	ctx := context.Background()
+	fake := awskmstest.NewFakeKmsWithRegion("eu-west-1")
+	keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+	fake.MustCreateAlias("alias/describe", keyID)
+
+	res, err := fake.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/describe")})
+	require.NoError(t, err)
+	require.Equal(t, keyID, aws.ToString(res.KeyMetadata.KeyId))
+	require.Equal(t, "arn:aws:kms:eu-west-1:111122223333:key/"+keyID, aws.ToString(res.KeyMetadata.Arn))
+
+	res, err = fake.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: res.KeyMetadata.Arn})
+	require.NoError(t, err)
+	require.Equal(t, keyID, aws.ToString(res.KeyMetadata.KeyId))
+
+	_, err = fake.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/missing")})
+	var notFound *types.NotFoundException
+	require.ErrorAs(t, err, &notFound)
+}
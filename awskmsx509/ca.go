@@ -0,0 +1,287 @@
+// Package awskmsx509: x509 certificate authority with the CA private key held in AWS KMS
+// Creates CSRs for KMS keys, issues leaf and intermediate certificates and signs CRLs through KMS Sign
+// Works with RSA, ECDSA and Ed25519 SIGN_VERIFY keys, the signature algorithm follows the CA key type
+//
+// awskmsx509: CA 私钥保存在 AWS KMS 中的 x509 证书颁发机构
+// 为 KMS 密钥创建 CSR，并通过 KMS Sign 签发叶子证书和中间证书以及签名 CRL
+// 支持 RSA、ECDSA 和 Ed25519 SIGN_VERIFY 密钥，签名算法跟随 CA 密钥类型
+package awskmsx509
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"time"
+
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// CertificateAuthority issues certificates and CRLs with a KMS key and its CA certificate
+// The CA certificate is either self-signed as root or issued by a parent CertificateAuthority as intermediate
+//
+// CertificateAuthority 使用 KMS 密钥及其 CA 证书签发证书和 CRL
+// CA 证书可以是自签名的根证书，也可以是上级 CertificateAuthority 签发的中间证书
+type CertificateAuthority struct {
+	signer      *awskms.AwsKmsCryptoSigner // CA key in KMS // KMS 中的 CA 密钥
+	certificate *x509.Certificate          // CA certificate of the key // 该密钥的 CA 证书
+}
+
+// NewCertificateAuthority creates CertificateAuthority from a KMS key and its existing CA certificate
+//
+// NewCertificateAuthority 使用 KMS 密钥及其已有的 CA 证书创建 CertificateAuthority
+func NewCertificateAuthority(client awskms.SignerAPI, signKeyID string, certificate *x509.Certificate) (*CertificateAuthority, error) {
+	return NewCertificateAuthorityContext(context.Background(), client, signKeyID, certificate)
+}
+
+// NewCertificateAuthorityContext creates CertificateAuthority with the given context
+// Checks the certificate is a CA certificate and matches the public key of the KMS key
+//
+// NewCertificateAuthorityContext 使用给定的上下文创建 CertificateAuthority
+// 检查证书为 CA 证书且与 KMS 密钥的公钥匹配
+func NewCertificateAuthorityContext(ctx context.Context, client awskms.SignerAPI, signKeyID string, certificate *x509.Certificate) (*CertificateAuthority, error) {
+	must.Nice(certificate)
+
+	if !certificate.BasicConstraintsValid || !certificate.IsCA {
+		return nil, erero.New("certificate is not a CA certificate")
+	}
+	signer, err := awskms.NewAwsKmsCryptoSignerContext(ctx, client, signKeyID)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	publicKey, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(certificate.PublicKey) {
+		return nil, erero.New("certificate public key does not match the KMS key")
+	}
+	return &CertificateAuthority{
+		signer:      signer,
+		certificate: certificate,
+	}, nil
+}
+
+// NewRootCertificateAuthority creates CertificateAuthority with a self-signed root certificate of the KMS key
+//
+// NewRootCertificateAuthority 使用 KMS 密钥的自签名根证书创建 CertificateAuthority
+func NewRootCertificateAuthority(client awskms.SignerAPI, signKeyID string, template *x509.Certificate) (*CertificateAuthority, error) {
+	return NewRootCertificateAuthorityContext(context.Background(), client, signKeyID, template)
+}
+
+// NewRootCertificateAuthorityContext creates CertificateAuthority with a self-signed root certificate with the given context
+// The template gets IsCA, CertSign and CRLSign set, a random serial number when absent and NotBefore of now when zero
+//
+// NewRootCertificateAuthorityContext 使用给定的上下文创建带自签名根证书的 CertificateAuthority
+// 模板会被设置 IsCA、CertSign 和 CRLSign，缺少序列号时随机生成，NotBefore 为零值时使用当前时间
+func NewRootCertificateAuthorityContext(ctx context.Context, client awskms.SignerAPI, signKeyID string, template *x509.Certificate) (*CertificateAuthority, error) {
+	must.Nice(template)
+
+	signer, err := awskms.NewAwsKmsCryptoSignerContext(ctx, client, signKeyID)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	rootTemplate, err := prepareTemplate(template, true)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	certificate, err := createCertificate(rootTemplate, rootTemplate, signer.Public(), newContextSigner(ctx, signer))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &CertificateAuthority{
+		signer:      signer,
+		certificate: certificate,
+	}, nil
+}
+
+// Certificate returns the CA certificate
+//
+// Certificate 返回 CA 证书
+func (ca *CertificateAuthority) Certificate() *x509.Certificate {
+	return ca.certificate
+}
+
+// KeyID returns the KMS key ARN of the CA key
+//
+// KeyID 返回 CA 密钥的 KMS 密钥 ARN
+func (ca *CertificateAuthority) KeyID() string {
+	return ca.signer.KeyID()
+}
+
+// IssueLeafCertificate issues an end-entity certificate for the public key
+//
+// IssueLeafCertificate 为公钥签发终端实体证书
+func (ca *CertificateAuthority) IssueLeafCertificate(template *x509.Certificate, publicKey crypto.PublicKey) (*x509.Certificate, error) {
+	return ca.IssueLeafCertificateContext(context.Background(), template, publicKey)
+}
+
+// IssueLeafCertificateContext issues an end-entity certificate with the given context
+// The template gets IsCA cleared and DigitalSignature key usage when none is set
+//
+// IssueLeafCertificateContext 使用给定的上下文签发终端实体证书
+// 模板会被清除 IsCA，未设置密钥用途时使用 DigitalSignature
+func (ca *CertificateAuthority) IssueLeafCertificateContext(ctx context.Context, template *x509.Certificate, publicKey crypto.PublicKey) (*x509.Certificate, error) {
+	must.Nice(template)
+	must.True(publicKey != nil)
+
+	leafTemplate, err := prepareTemplate(template, false)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return ca.issue(ctx, leafTemplate, publicKey)
+}
+
+// IssueIntermediateCertificate issues a subordinate CA certificate for the public key
+// Pass the result with the subordinate KMS key to NewCertificateAuthority to issue from it
+//
+// IssueIntermediateCertificate 为公钥签发下级 CA 证书
+// 将结果和下级 KMS 密钥传入 NewCertificateAuthority 即可用其签发证书
+func (ca *CertificateAuthority) IssueIntermediateCertificate(template *x509.Certificate, publicKey crypto.PublicKey) (*x509.Certificate, error) {
+	return ca.IssueIntermediateCertificateContext(context.Background(), template, publicKey)
+}
+
+// IssueIntermediateCertificateContext issues a subordinate CA certificate with the given context
+// Fails when the path length constraint of this CA forbids subordinate CAs
+// When this CA limits the path length, the template must set a MaxPathLen below that limit
+//
+// IssueIntermediateCertificateContext 使用给定的上下文签发下级 CA 证书
+// 当前 CA 的路径长度约束禁止下级 CA 时返回错误
+// 当前 CA 限制路径长度时，模板必须设置小于该限制的 MaxPathLen
+func (ca *CertificateAuthority) IssueIntermediateCertificateContext(ctx context.Context, template *x509.Certificate, publicKey crypto.PublicKey) (*x509.Certificate, error) {
+	must.Nice(template)
+	must.True(publicKey != nil)
+
+	intermediateTemplate, err := prepareTemplate(template, true)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return ca.issue(ctx, intermediateTemplate, publicKey)
+}
+
+// CreateRevocationList signs a DER encoded CRL listing the revoked certificates of this CA
+//
+// CreateRevocationList 签名 DER 编码的 CRL，列出此 CA 吊销的证书
+func (ca *CertificateAuthority) CreateRevocationList(template *x509.RevocationList) ([]byte, error) {
+	return ca.CreateRevocationListContext(context.Background(), template)
+}
+
+// CreateRevocationListContext signs a DER encoded CRL with the given context
+// The template must carry the CRL Number, ThisUpdate of zero takes the current time
+//
+// CreateRevocationListContext 使用给定的上下文签名 DER 编码的 CRL
+// 模板必须包含 CRL 编号，ThisUpdate 为零值时使用当前时间
+func (ca *CertificateAuthority) CreateRevocationListContext(ctx context.Context, template *x509.RevocationList) ([]byte, error) {
+	must.Nice(template)
+
+	if template.Number == nil {
+		return nil, erero.New("CRL number is required")
+	}
+	crlTemplate := *template
+	if crlTemplate.ThisUpdate.IsZero() {
+		crlTemplate.ThisUpdate = time.Now()
+	}
+	if !crlTemplate.NextUpdate.After(crlTemplate.ThisUpdate) {
+		return nil, erero.New("CRL NextUpdate must be after ThisUpdate")
+	}
+	crlDer, err := x509.CreateRevocationList(rand.Reader, &crlTemplate, ca.certificate, newContextSigner(ctx, ca.signer))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return crlDer, nil
+}
+
+// issue signs the prepared template with the CA key, keeping the validity inside the CA validity
+// CA templates must also keep within the path length constraint of this CA, which verifiers enforce
+//
+// issue 使用 CA 密钥签名已准备的模板，并保证有效期在 CA 有效期之内
+// CA 模板还必须符合当前 CA 的路径长度约束，校验方会强制检查该约束
+func (ca *CertificateAuthority) issue(ctx context.Context, template *x509.Certificate, publicKey crypto.PublicKey) (*x509.Certificate, error) {
+	if template.NotBefore.Before(ca.certificate.NotBefore) {
+		return nil, erero.Errorf("certificate NotBefore %s precedes CA NotBefore %s", template.NotBefore, ca.certificate.NotBefore)
+	}
+	if template.NotAfter.After(ca.certificate.NotAfter) {
+		return nil, erero.Errorf("certificate NotAfter %s exceeds CA NotAfter %s", template.NotAfter, ca.certificate.NotAfter)
+	}
+	if template.IsCA {
+		if limit, limited := pathLenLimit(ca.certificate); limited {
+			if limit == 0 {
+				return nil, erero.New("CA path length constraint forbids intermediate certificates")
+			}
+			if childLimit, childLimited := pathLenLimit(template); !childLimited || childLimit >= limit {
+				return nil, erero.Errorf("intermediate MaxPathLen must be below the CA path length limit %d", limit)
+			}
+		}
+	}
+	certificate, err := createCertificate(template, ca.certificate, publicKey, newContextSigner(ctx, ca.signer))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return certificate, nil
+}
+
+// prepareTemplate copies the template and fills the serial number, NotBefore and the CA constraints
+//
+// prepareTemplate 复制模板并填充序列号、NotBefore 和 CA 约束
+func prepareTemplate(template *x509.Certificate, isCA bool) (*x509.Certificate, error) {
+	certificateTemplate := *template
+	if certificateTemplate.SerialNumber == nil {
+		serialNumber, err := newSerialNumber()
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		certificateTemplate.SerialNumber = serialNumber
+	}
+	if certificateTemplate.NotBefore.IsZero() {
+		certificateTemplate.NotBefore = time.Now()
+	}
+	if !certificateTemplate.NotAfter.After(certificateTemplate.NotBefore) {
+		return nil, erero.New("certificate NotAfter must be after NotBefore")
+	}
+	certificateTemplate.BasicConstraintsValid = true
+	certificateTemplate.IsCA = isCA
+	if isCA {
+		certificateTemplate.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else if certificateTemplate.KeyUsage == 0 {
+		certificateTemplate.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	return &certificateTemplate, nil
+}
+
+// pathLenLimit returns the path length limit of a certificate or template, false when unlimited
+// MaxPathLen of -1, or 0 without MaxPathLenZero, means no limit as in crypto/x509
+//
+// pathLenLimit 返回证书或模板的路径长度限制，不限制时返回 false
+// 与 crypto/x509 一致，MaxPathLen 为 -1 或为 0 且未设置 MaxPathLenZero 时表示不限制
+func pathLenLimit(certificate *x509.Certificate) (int, bool) {
+	if certificate.MaxPathLen > 0 || (certificate.MaxPathLen == 0 && certificate.MaxPathLenZero) {
+		return certificate.MaxPathLen, true
+	}
+	return 0, false
+}
+
+// createCertificate creates and parses the certificate, x509 verifies the KMS signature before returning
+//
+// createCertificate 创建并解析证书，x509 在返回前会校验 KMS 签名
+func createCertificate(template *x509.Certificate, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	certificateDer, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	certificate, err := x509.ParseCertificate(certificateDer)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return certificate, nil
+}
+
+// newSerialNumber returns a random positive 128-bit serial number
+//
+// newSerialNumber 返回随机的 128 位正整数序列号
+func newSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return serialNumber.Add(serialNumber, big.NewInt(1)), nil
+}
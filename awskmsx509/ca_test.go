@@ -0,0 +1,234 @@
+package awskmsx509_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/go-xlan/go-aws-kms/awskmsx509"
+	"github.com/stretchr/testify/require"
+)
+
+// newRootCertificateAuthority creates a root CA on a new ECC_NIST_P384 key of the fake
+//
+// newRootCertificateAuthority 在假实现的新 ECC_NIST_P384 密钥上创建根 CA
+func newRootCertificateAuthority(t *testing.T, fake *awskmstest.FakeKms) *awskmsx509.CertificateAuthority {
+	root, err := awskmsx509.NewRootCertificateAuthority(fake, fake.MustCreateKey(types.KeySpecEccNistP384, types.KeyUsageTypeSignVerify), &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "Test Root CA"},
+		NotAfter: time.Now().Add(10 * 365 * 24 * time.Hour),
+	})
+	require.NoError(t, err)
+	return root
+}
+
+// TestCertificateAuthority_IssueIntermediateCertificate tests a root, intermediate and leaf chain verifies with crypto/x509
+//
+// TestCertificateAuthority_IssueIntermediateCertificate 测试根证书、中间证书和叶子证书组成的链可通过 crypto/x509 校验
+func TestCertificateAuthority_IssueIntermediateCertificate(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	root := newRootCertificateAuthority(t, fake)
+	require.True(t, root.Certificate().IsCA)
+	require.Equal(t, root.Certificate().Subject.String(), root.Certificate().Issuer.String())
+	require.NotEmpty(t, root.Certificate().SubjectKeyId)
+
+	intermediateKeyID := fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeSignVerify)
+	csrDer, err := awskmsx509.CreateCertificateRequest(fake, intermediateKeyID, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "Test Intermediate CA"},
+	})
+	require.NoError(t, err)
+	csr, err := awskmsx509.ParseCertificateRequest(csrDer)
+	require.NoError(t, err)
+	intermediateCertificate, err := root.IssueIntermediateCertificate(&x509.Certificate{
+		Subject:        csr.Subject,
+		NotAfter:       time.Now().Add(365 * 24 * time.Hour),
+		MaxPathLen:     0,
+		MaxPathLenZero: true,
+	}, csr.PublicKey)
+	require.NoError(t, err)
+	require.True(t, intermediateCertificate.IsCA)
+	require.Equal(t, root.Certificate().SubjectKeyId, intermediateCertificate.AuthorityKeyId)
+
+	intermediate, err := awskmsx509.NewCertificateAuthority(fake, intermediateKeyID, intermediateCertificate)
+	require.NoError(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafCertificate, err := intermediate.IssueLeafCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "service.internal"},
+		DNSNames:    []string{"service.internal"},
+		NotAfter:    time.Now().Add(24 * time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &leafKey.PublicKey)
+	require.NoError(t, err)
+	require.False(t, leafCertificate.IsCA)
+	require.Equal(t, x509.KeyUsageDigitalSignature, leafCertificate.KeyUsage)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Certificate())
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate.Certificate())
+	chains, err := leafCertificate.Verify(x509.VerifyOptions{
+		DNSName:       "service.internal",
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	require.NoError(t, err)
+	require.Len(t, chains, 1)
+	require.Len(t, chains[0], 3)
+
+	t.Run("PathLengthZero", func(t *testing.T) {
+		_, err := intermediate.IssueIntermediateCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "Too Deep CA"},
+			NotAfter: time.Now().Add(time.Hour),
+		}, &leafKey.PublicKey)
+		require.Error(t, err)
+	})
+
+	t.Run("PathLengthLimit", func(t *testing.T) {
+		limitedKeyID := fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify)
+		limitedPublicKey, err := awskms.NewAwsKmsCryptoSigner(fake, limitedKeyID)
+		require.NoError(t, err)
+		limitedCertificate, err := root.IssueIntermediateCertificate(&x509.Certificate{
+			Subject:    pkix.Name{CommonName: "Limited CA"},
+			NotAfter:   time.Now().Add(2 * time.Hour),
+			MaxPathLen: 1,
+		}, limitedPublicKey.Public())
+		require.NoError(t, err)
+		limited, err := awskmsx509.NewCertificateAuthority(fake, limitedKeyID, limitedCertificate)
+		require.NoError(t, err)
+
+		for _, maxPathLen := range []int{5, 1, -1} {
+			_, err := limited.IssueIntermediateCertificate(&x509.Certificate{
+				Subject:    pkix.Name{CommonName: "Too Deep CA"},
+				NotAfter:   time.Now().Add(time.Hour),
+				MaxPathLen: maxPathLen,
+			}, &leafKey.PublicKey)
+			require.Error(t, err)
+		}
+
+		_, err = limited.IssueIntermediateCertificate(&x509.Certificate{
+			Subject:        pkix.Name{CommonName: "Last CA"},
+			NotAfter:       time.Now().Add(time.Hour),
+			MaxPathLenZero: true,
+		}, &leafKey.PublicKey)
+		require.NoError(t, err)
+	})
+
+	t.Run("BeforeCaValidity", func(t *testing.T) {
+		_, err := intermediate.IssueLeafCertificate(&x509.Certificate{
+			Subject:   pkix.Name{CommonName: "service.internal"},
+			NotBefore: intermediate.Certificate().NotBefore.Add(-time.Hour),
+			NotAfter:  time.Now().Add(time.Hour),
+		}, &leafKey.PublicKey)
+		require.Error(t, err)
+
+		futureKeyID := fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify)
+		futureSigner, err := awskms.NewAwsKmsCryptoSigner(fake, futureKeyID)
+		require.NoError(t, err)
+		futureCertificate, err := root.IssueIntermediateCertificate(&x509.Certificate{
+			Subject:        pkix.Name{CommonName: "Future CA"},
+			NotBefore:      time.Now().Add(time.Hour),
+			NotAfter:       time.Now().Add(2 * time.Hour),
+			MaxPathLenZero: true,
+		}, futureSigner.Public())
+		require.NoError(t, err)
+		future, err := awskmsx509.NewCertificateAuthority(fake, futureKeyID, futureCertificate)
+		require.NoError(t, err)
+
+		// NotBefore defaults to now, before the CA becomes valid // NotBefore 默认为当前时间，早于 CA 生效时间
+		_, err = future.IssueLeafCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "service.internal"},
+			NotAfter: time.Now().Add(2 * time.Hour),
+		}, &leafKey.PublicKey)
+		require.Error(t, err)
+	})
+
+	t.Run("BeyondCaValidity", func(t *testing.T) {
+		_, err := intermediate.IssueLeafCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "service.internal"},
+			NotAfter: intermediate.Certificate().NotAfter.Add(time.Hour),
+		}, &leafKey.PublicKey)
+		require.Error(t, err)
+	})
+}
+
+// TestCertificateAuthority_IssueLeafCertificate tests an Ed25519 root CA issuing a certificate from a KMS key CSR
+//
+// TestCertificateAuthority_IssueLeafCertificate 测试 Ed25519 根 CA 根据 KMS 密钥的 CSR 签发证书
+func TestCertificateAuthority_IssueLeafCertificate(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	root, err := awskmsx509.NewRootCertificateAuthority(fake, fake.MustCreateKey(awskms.KeySpecEccNistEdwards25519, types.KeyUsageTypeSignVerify), &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "Test Ed25519 CA"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, x509.PureEd25519, root.Certificate().SignatureAlgorithm)
+
+	leafKeyID := fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify)
+	csrDer, err := awskmsx509.CreateCertificateRequest(fake, leafKeyID, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "client"},
+	})
+	require.NoError(t, err)
+	csr, err := awskmsx509.ParseCertificateRequest(csrDer)
+	require.NoError(t, err)
+
+	leafCertificate, err := root.IssueLeafCertificate(&x509.Certificate{
+		Subject:     csr.Subject,
+		NotAfter:    time.Now().Add(time.Minute),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, csr.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, leafCertificate.CheckSignatureFrom(root.Certificate()))
+
+	t.Run("NotCaCertificate", func(t *testing.T) {
+		_, err := awskmsx509.NewCertificateAuthority(fake, leafKeyID, leafCertificate)
+		require.Error(t, err)
+	})
+
+	t.Run("MismatchedKey", func(t *testing.T) {
+		_, err := awskmsx509.NewCertificateAuthority(fake, leafKeyID, root.Certificate())
+		require.Error(t, err)
+	})
+}
+
+// TestCertificateAuthority_CreateRevocationList tests the CRL is signed by the CA and lists the revoked serial numbers
+//
+// TestCertificateAuthority_CreateRevocationList 测试 CRL 由 CA 签名并列出被吊销的序列号
+func TestCertificateAuthority_CreateRevocationList(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	root := newRootCertificateAuthority(t, fake)
+
+	crlDer, err := root.CreateRevocationList(&x509.RevocationList{
+		Number:     big.NewInt(7),
+		NextUpdate: time.Now().Add(24 * time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(12345), RevocationTime: time.Now().Add(-time.Hour)},
+		},
+	})
+	require.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(crlDer)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(root.Certificate()))
+	require.Equal(t, big.NewInt(7), crl.Number)
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	require.Equal(t, big.NewInt(12345), crl.RevokedCertificateEntries[0].SerialNumber)
+
+	t.Run("MissingNumber", func(t *testing.T) {
+		_, err := root.CreateRevocationList(&x509.RevocationList{NextUpdate: time.Now().Add(time.Hour)})
+		require.Error(t, err)
+	})
+
+	t.Run("MissingNextUpdate", func(t *testing.T) {
+		_, err := root.CreateRevocationList(&x509.RevocationList{Number: big.NewInt(8)})
+		require.Error(t, err)
+	})
+}
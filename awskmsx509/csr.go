@@ -0,0 +1,84 @@
+package awskmsx509
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"io"
+
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// CreateCertificateRequest creates a DER encoded CSR for the KMS key, signed through KMS Sign
+// The template follows x509.CreateCertificateRequest, a zero SignatureAlgorithm picks the default of the key type
+//
+// CreateCertificateRequest 为 KMS 密钥创建 DER 编码的 CSR，通过 KMS Sign 签名
+// 模板遵循 x509.CreateCertificateRequest，SignatureAlgorithm 为零值时按密钥类型选择默认算法
+func CreateCertificateRequest(client awskms.SignerAPI, signKeyID string, template *x509.CertificateRequest) ([]byte, error) {
+	return CreateCertificateRequestContext(context.Background(), client, signKeyID, template)
+}
+
+// CreateCertificateRequestContext creates a DER encoded CSR for the KMS key with the given context
+//
+// CreateCertificateRequestContext 使用给定的上下文为 KMS 密钥创建 DER 编码的 CSR
+func CreateCertificateRequestContext(ctx context.Context, client awskms.SignerAPI, signKeyID string, template *x509.CertificateRequest) ([]byte, error) {
+	must.Nice(template)
+
+	signer, err := awskms.NewAwsKmsCryptoSignerContext(ctx, client, signKeyID)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	csrDer, err := x509.CreateCertificateRequest(rand.Reader, template, newContextSigner(ctx, signer))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return csrDer, nil
+}
+
+// ParseCertificateRequest parses a DER encoded CSR and checks its self signature
+// Issue the result with CertificateAuthority after reviewing the requested subject and names
+//
+// ParseCertificateRequest 解析 DER 编码的 CSR 并检查其自签名
+// 审核请求的主题和名称后，再使用 CertificateAuthority 签发
+func ParseCertificateRequest(csrDer []byte) (*x509.CertificateRequest, error) {
+	csr, err := x509.ParseCertificateRequest(csrDer)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return csr, nil
+}
+
+// contextSigner binds a context to AwsKmsCryptoSigner, since crypto.Signer.Sign takes none
+//
+// contextSigner 为 AwsKmsCryptoSigner 绑定上下文，因为 crypto.Signer.Sign 不接受上下文
+type contextSigner struct {
+	ctx    context.Context            // Context of KMS Sign calls // KMS Sign 调用的上下文
+	signer *awskms.AwsKmsCryptoSigner // KMS key as crypto.Signer // 作为 crypto.Signer 的 KMS 密钥
+}
+
+// newContextSigner creates contextSigner with the given context and signer
+//
+// newContextSigner 使用给定的上下文和签名器创建 contextSigner
+func newContextSigner(ctx context.Context, signer *awskms.AwsKmsCryptoSigner) *contextSigner {
+	return &contextSigner{ctx: ctx, signer: signer}
+}
+
+// Public returns the public key of the KMS key
+//
+// Public 返回 KMS 密钥的公钥
+func (s *contextSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+// Sign signs the digest through KMS Sign with the bound context
+//
+// Sign 使用绑定的上下文通过 KMS Sign 对摘要签名
+func (s *contextSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.SignContext(s.ctx, digest, opts)
+}
@@ -0,0 +1,54 @@
+package awskmsx509_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/go-xlan/go-aws-kms/awskmsx509"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateCertificateRequest tests CSRs of RSA, ECDSA and Ed25519 KMS keys carry the KMS public key and a valid signature
+//
+// TestCreateCertificateRequest 测试 RSA、ECDSA 和 Ed25519 KMS 密钥的 CSR 包含 KMS 公钥和有效签名
+func TestCreateCertificateRequest(t *testing.T) {
+	fake := awskmstest.NewFakeKms()
+	for _, keySpec := range []types.KeySpec{types.KeySpecRsa2048, types.KeySpecEccNistP256, awskms.KeySpecEccNistEdwards25519} {
+		t.Run(string(keySpec), func(t *testing.T) {
+			keyID := fake.MustCreateKey(keySpec, types.KeyUsageTypeSignVerify)
+			csrDer, err := awskmsx509.CreateCertificateRequest(fake, keyID, &x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: "service.internal"},
+				DNSNames: []string{"service.internal"},
+			})
+			require.NoError(t, err)
+
+			csr, err := awskmsx509.ParseCertificateRequest(csrDer)
+			require.NoError(t, err)
+			require.Equal(t, "service.internal", csr.Subject.CommonName)
+			require.Equal(t, []string{"service.internal"}, csr.DNSNames)
+
+			signer, err := awskms.NewAwsKmsCryptoSigner(fake, keyID)
+			require.NoError(t, err)
+			require.Equal(t, signer.Public(), csr.PublicKey)
+		})
+	}
+
+	t.Run("TamperedRequest", func(t *testing.T) {
+		csrDer, err := awskmsx509.CreateCertificateRequest(fake, fake.MustCreateKey(types.KeySpecEccNistP256, types.KeyUsageTypeSignVerify), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "service.internal"},
+		})
+		require.NoError(t, err)
+		csrDer[len(csrDer)-1] ^= 0xff
+		_, err = awskmsx509.ParseCertificateRequest(csrDer)
+		require.Error(t, err)
+	})
+
+	t.Run("WrongKeyUsage", func(t *testing.T) {
+		_, err := awskmsx509.CreateCertificateRequest(fake, fake.MustCreateKey(types.KeySpecRsa2048, types.KeyUsageTypeEncryptDecrypt), &x509.CertificateRequest{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,35 @@
+// Command awskms-emulator runs a local AWS KMS compatible HTTP server backed by awskmstest.FakeKms
+// Point kms.Client (or AWS_KMS_ENDPOINT_URL with NewAwsKmsFromEnv) at the listen address
+// Keys live in memory and are lost on exit, use -alias to create a ready key on startup
+//
+// awskms-emulator 命令运行基于 awskmstest.FakeKms 的本地 AWS KMS 兼容 HTTP 服务
+// 将 kms.Client（或配合 NewAwsKmsFromEnv 使用 AWS_KMS_ENDPOINT_URL）指向监听地址
+// 密钥保存在内存中，退出即丢失，可使用 -alias 在启动时创建可用的密钥
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/go-xlan/go-aws-kms/awskmstest"
+	"github.com/yyle88/must"
+	"github.com/yyle88/zaplog"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "listen address")
+	region := flag.String("region", "us-east-1", "region reported in key ARNs")
+	alias := flag.String("alias", "alias/emulator", "alias of the symmetric key created on startup, empty to skip")
+	flag.Parse()
+
+	fake := awskmstest.NewFakeKmsWithRegion(*region)
+	if *alias != "" {
+		keyID := fake.MustCreateKey(types.KeySpecSymmetricDefault, types.KeyUsageTypeEncryptDecrypt)
+		fake.MustCreateAlias(*alias, keyID)
+		zaplog.SUG.Infof("created key %s with alias %s", keyID, *alias)
+	}
+
+	zaplog.SUG.Infof("awskms-emulator listening on http://%s", *addr)
+	must.Done(http.ListenAndServe(*addr, awskmstest.NewEmulator(fake)))
+}
@@ -8,12 +8,14 @@ require (
 	github.com/aws/aws-sdk-go-v2/credentials v1.18.16
 	github.com/aws/aws-sdk-go-v2/service/kms v1.45.6
 	github.com/aws/smithy-go v1.23.0
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.3.0
 	github.com/stretchr/testify v1.11.1
 	github.com/yyle88/erero v1.0.23
 	github.com/yyle88/must v0.0.26
 	github.com/yyle88/neatjson v0.0.12
 	github.com/yyle88/rese v0.0.11
 	github.com/yyle88/zaplog v0.0.27
+	golang.org/x/crypto v0.31.0
 )
 
 require (
@@ -36,5 +38,6 @@ require (
 	github.com/yyle88/tern v0.0.9 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
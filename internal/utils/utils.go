@@ -0,0 +1,58 @@
+// Package utils: Internal helpers shared by the awskms packages
+//
+// utils: awskms 各包共享的内部辅助函数
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"reflect"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// MustClient checks the client is set and returns it
+// Rejects nil interfaces and typed nil values held by interfaces, e.g. (*kms.Client)(nil)
+// must.Nice only compares with the zero interface value, letting typed nils through
+//
+// MustClient 检查客户端已设置并返回该客户端
+// 拒绝 nil 接口以及接口中持有的带类型 nil 值，例如 (*kms.Client)(nil)
+// must.Nice 只与接口零值比较，会放过带类型的 nil
+func MustClient[T any](client T) T {
+	must.True(!IsNil(client))
+	return client
+}
+
+// IsNil reports whether the value is nil, looking inside interfaces at pointers, maps, slices, funcs and channels
+//
+// IsNil 判断值是否为 nil，会检查接口中的指针、map、切片、函数和通道
+func IsNil(value any) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
+
+// NewAesGcm creates AES-GCM AEAD from a 16, 24 or 32 bytes key
+// Shared by envelope, stream, keyring, ECIES and JWE encryption so they all build the AEAD the same way
+//
+// NewAesGcm 使用 16、24 或 32 字节密钥创建 AES-GCM AEAD
+// 信封、流式、密钥环、ECIES 和 JWE 加密共用，以相同方式构造 AEAD
+func NewAesGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,52 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/go-xlan/go-aws-kms/awskms"
+	"github.com/go-xlan/go-aws-kms/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIsNil tests nil interfaces and typed nil pointers are both detected
+//
+// TestIsNil 测试 nil 接口和带类型的 nil 指针都能被识别
+func TestIsNil(t *testing.T) {
+	var client awskms.KmsAPI
+	require.True(t, utils.IsNil(client))
+
+	client = (*kms.Client)(nil)
+	require.True(t, utils.IsNil(client))
+
+	client = kms.New(kms.Options{Region: "us-east-1"})
+	require.False(t, utils.IsNil(client))
+	require.False(t, utils.IsNil(0))
+}
+
+// TestMustClient tests typed nil clients are rejected
+//
+// TestMustClient 测试带类型的 nil 客户端会被拒绝
+func TestMustClient(t *testing.T) {
+	require.Panics(t, func() {
+		utils.MustClient[awskms.KmsAPI]((*kms.Client)(nil))
+	})
+	require.NotPanics(t, func() {
+		utils.MustClient[awskms.KmsAPI](kms.New(kms.Options{Region: "us-east-1"}))
+	})
+}
+
+// TestNewAesGcm tests AES-GCM AEAD creation on valid key sizes and rejection of other sizes
+//
+// TestNewAesGcm 测试有效密钥长度下创建 AES-GCM AEAD 以及拒绝其它长度
+func TestNewAesGcm(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		gcm, err := utils.NewAesGcm(make([]byte, size))
+		require.NoError(t, err)
+		require.Equal(t, 12, gcm.NonceSize())
+		require.Equal(t, 16, gcm.Overhead())
+	}
+
+	_, err := utils.NewAesGcm(make([]byte, 31))
+	require.Error(t, err)
+}